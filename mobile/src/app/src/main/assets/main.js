@@ -26,6 +26,14 @@ function base64Decode(base64String) {
   }
 }
 
+function base64Encode(bytes) {
+  let binaryString = "";
+  for (const b of bytes) {
+    binaryString += String.fromCharCode(b);
+  }
+  return btoa(binaryString);
+}
+
 // -------
 // status
 // -------
@@ -36,6 +44,8 @@ const status_readyForTakeoff = 2;
 const status_flying = 3;
 const status_circling = 4;
 const status_landing = 5;
+const status_returning = 6;
+const status_manual = 7;
 
 const statusMap = {
   [status_none]: "None",
@@ -44,8 +54,15 @@ const statusMap = {
   [status_flying]: "Flying",
   [status_circling]: "Circling",
   [status_landing]: "Landing",
+  [status_returning]: "Returning",
+  [status_manual]: "Manual",
 };
 
+// bits of planeStatus.failsafe
+const failsafeFlag_linkLost = 1 << 0;
+const failsafeFlag_geofence = 1 << 1;
+const failsafeFlag_sensors = 1 << 2;
+
 function percentageToUint32(f) {
   const clamped = Math.min(Math.max(f, 0), 100);
   return Math.floor((clamped / 100) * 0xffffffff);
@@ -56,7 +73,7 @@ function percentageFromUint32(u) {
 }
 
 function planeStatusFromBytes(data) {
-  if (!(data instanceof Uint8Array) || data.byteLength !== 29) {
+  if (!(data instanceof Uint8Array) || data.byteLength !== 31) {
     return null;
   }
   const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
@@ -68,6 +85,8 @@ function planeStatusFromBytes(data) {
     altitude: view.getFloat32(9, false),
     latitude: view.getFloat64(13, false),
     longitude: view.getFloat64(21, false),
+    failsafe: view.getUint8(29),
+    missionItem: view.getUint8(30),
   };
 }
 
@@ -85,38 +104,209 @@ const payloadType_land = 6;
 // for manual control only
 const payloadType_joystick = 7;
 const payloadType_throttle = 8;
+const payloadType_ack = 9; // plane -> ground, answer to any command
+const payloadType_heartbeat = 10; // ground -> plane
+const payloadType_autotune = 11;
+const payloadType_missionUpload = 12; // ground -> plane
+const payloadType_missionRequest = 13; // ground -> plane
+const payloadType_missionChunk = 14; // plane -> ground, answers missionRequest
+const payloadType_fenceUpload = 15; // ground -> plane
+const payloadType_goAround = 16; // ground -> plane, only while landing
+const payloadType_qnhSet = 17; // ground -> plane
+const payloadType_autotuneGains = 18; // plane -> ground, repeated until confirmed
+const payloadType_autotuneConfirm = 19; // ground -> plane
+// keep pointing at the newest type, anything above is unknown
+const payloadType_last = payloadType_autotuneConfirm;
 const payloadType_errorInternal = 0xff;
 
+const packetHeaderSize = 2;
+const packetTrailerSize = 2;
+
+// crc-16/ccitt-false, must match protocol/crc.go
+function crc16(data) {
+  let crc = 0xffff;
+  for (const b of data) {
+    crc ^= b << 8;
+    for (let i = 0; i < 8; i++) {
+      crc = crc & 0x8000 ? ((crc << 1) ^ 0x1021) & 0xffff : (crc << 1) & 0xffff;
+    }
+  }
+  return crc;
+}
+
 function newPacket(payloadType, payload) {
   // these packets are meant for everything from
   // lora to usb and as such do not have to be modified when forwarded
   // packet structure:
   //  header - 2 bytes
-  //    first - length of the full packet including header
+  //    first - length of the full packet including header and trailer
   //    second - data type of payload
   //
   //  payload - n bytes
-  return [payload.length + 2, payloadType, ...payload];
+  //
+  //  trailer - 2 bytes
+  //    crc16 of header and payload, big endian
+  const packet = [
+    payload.length + packetHeaderSize + packetTrailerSize,
+    payloadType,
+    ...payload,
+  ];
+  const crc = crc16(packet);
+  return [...packet, crc >> 8, crc & 0xff];
 }
 
 function parsePacket(packet) {
-  if (packet.length === 0) {
-    return {
-      payloadType: payloadType_errorInternal,
-      payload: null,
-    };
+  const invalid = (reason) => ({
+    payloadType: payloadType_errorInternal,
+    payload: null,
+    reason: reason,
+  });
+
+  if (packet.length < packetHeaderSize + packetTrailerSize) {
+    return invalid("truncated");
+  }
+  const length = packet[0];
+  if (length < packetHeaderSize + packetTrailerSize || length > packet.length) {
+    return invalid("truncated");
+  }
+  if (length < packet.length) {
+    return invalid("bad length");
+  }
+
+  const body = packet.slice(0, length - packetTrailerSize);
+  const crc = (packet[length - 2] << 8) | packet[length - 1];
+  if (crc16(body) !== crc) {
+    return invalid("bad crc");
   }
 
-  //const packetLength = packet[0];
   const payloadType = packet[1];
-  const payload = packet.slice(2);
+  if (payloadType > payloadType_last) {
+    return invalid("unknown type");
+  }
 
   return {
     payloadType: payloadType,
-    payload: payload,
+    payload: body.slice(packetHeaderSize),
   };
 }
 
+// uplink commands carry a sequence number the plane acks, see protocol/command.go
+const ackReason_ok = 0;
+const ackReason_malformed = 1;
+const ackReason_outOfRange = 2;
+const ackReason_rejected = 3;
+const ackReason_unsupported = 4;
+const ackReason_checksum = 5;
+
+const ackReasonMap = {
+  [ackReason_ok]: "OK",
+  [ackReason_malformed]: "Malformed",
+  [ackReason_outOfRange]: "Out of range",
+  [ackReason_rejected]: "Rejected",
+  [ackReason_unsupported]: "Unsupported",
+  [ackReason_checksum]: "Checksum mismatch",
+};
+
+// autotune args, see protocol/command.go
+const autotuneAxis_roll = 0;
+const autotuneAxis_pitch = 1;
+const autotuneRule_zieglerNichols = 0;
+const autotuneRule_tyreusLuyben = 1;
+
+// random start so a restarted app does not collide with sequence numbers
+// the plane still remembers from before
+let nextSeq = Math.floor(Math.random() * 0x10000);
+
+function newCommand(payloadType, args) {
+  const seq = nextSeq;
+  nextSeq = (nextSeq + 1) & 0xffff;
+  return newPacket(payloadType, [seq >> 8, seq & 0xff, ...args]);
+}
+
+// -------
+// framing
+// -------
+
+// packets over usb are cobs encoded and zero delimited, must match protocol/frame.go
+const maxFrameSize = 0xff + Math.floor(0xff / 254) + 2;
+
+function encodeFrame(packet) {
+  const frame = [0];
+  let codeIdx = 0;
+  let code = 1;
+  for (const b of packet) {
+    if (b !== 0) {
+      frame.push(b);
+      code++;
+    }
+    if (b === 0 || code === 0xff) {
+      frame[codeIdx] = code;
+      codeIdx = frame.length;
+      frame.push(0);
+      code = 1;
+    }
+  }
+  frame[codeIdx] = code;
+  frame.push(0);
+  return frame;
+}
+
+function decodeCobs(encoded) {
+  if (encoded.length === 0) {
+    return null;
+  }
+  const decoded = [];
+  for (let i = 0; i < encoded.length; ) {
+    const code = encoded[i];
+    if (code === 0) {
+      return null;
+    }
+    i++;
+    if (i + code - 1 > encoded.length) {
+      return null;
+    }
+    decoded.push(...encoded.slice(i, i + code - 1));
+    i += code - 1;
+    if (code !== 0xff && i < encoded.length) {
+      decoded.push(0);
+    }
+  }
+  return Uint8Array.from(decoded);
+}
+
+// usb reads arrive in arbitrary chunks, this keeps whatever is left over between them
+const usbFrameDecoder = {
+  buf: [],
+  overflow: false,
+
+  // returns every packet completed by this chunk, invalid frames come back as null
+  feed(bytes) {
+    const packets = [];
+    for (const b of bytes) {
+      if (b !== 0) {
+        if (this.buf.length >= maxFrameSize) {
+          this.overflow = true;
+        } else {
+          this.buf.push(b);
+        }
+        continue;
+      }
+      if (this.overflow) {
+        packets.push(null);
+      } else if (this.buf.length > 0) {
+        packets.push(decodeCobs(this.buf));
+      }
+      this.buf = [];
+      this.overflow = false;
+    }
+    return packets;
+  },
+};
+
+function usbWritePacket(packet) {
+  Android.usbWrite(base64Encode(encodeFrame(packet)));
+}
+
 // -------
 // main
 // -------
@@ -134,7 +324,241 @@ function buttonRelocate() {
   view.setFloat64(8, center.lng, false);
 
   const payload = Array.from(new Uint8Array(buffer));
-  Android.usbWrite(newPacket(payloadType_wpSet, payload));
+  usbWritePacket(newCommand(payloadType_wpSet, payload));
+}
+
+// lands on the takeoff runway, the plane picks the heading it took off on
+function buttonLand() {
+  usbWritePacket(newCommand(payloadType_land, []));
+}
+
+function buttonGoAround() {
+  usbWritePacket(newCommand(payloadType_goAround, []));
+}
+
+// sea level pressure in hectopascals for the barometric altitude,
+// 0 goes back to the field elevation from the gps
+function sendQNH(qnh) {
+  const view = new DataView(new ArrayBuffer(4));
+  view.setFloat32(0, qnh, false);
+  usbWritePacket(
+    newCommand(payloadType_qnhSet, Array.from(new Uint8Array(view.buffer)))
+  );
+}
+
+// the gentler rule, a tune mid flight should not end in big overshoots
+function buttonAutotune(axis) {
+  usbWritePacket(
+    newCommand(payloadType_autotune, [axis, autotuneRule_tyreusLuyben])
+  );
+}
+
+// the plane flies on with its old gains until these are applied, see protocol/autotune.go
+const autotuneGainsSize = 13;
+const autotuneAxisMap = {
+  [autotuneAxis_roll]: "Roll",
+  [autotuneAxis_pitch]: "Pitch",
+};
+
+function handleAutotuneGains(payload) {
+  if (payload.length !== autotuneGainsSize) {
+    Android.internalLogJS("Malformed autotune gains");
+    return;
+  }
+  const view = new DataView(payload.buffer, payload.byteOffset, autotuneGainsSize);
+  const axis = view.getUint8(0);
+  Alpine.store("autotune").proposal = {
+    axis: axis,
+    label: autotuneAxisMap[axis] ?? axis,
+    kp: view.getFloat32(1, false),
+    ki: view.getFloat32(5, false),
+    kd: view.getFloat32(9, false),
+  };
+}
+
+function buttonAutotuneConfirm(apply) {
+  const proposal = Alpine.store("autotune").proposal;
+  if (proposal == null) {
+    return;
+  }
+  usbWritePacket(
+    newCommand(payloadType_autotuneConfirm, [proposal.axis, apply ? 1 : 0])
+  );
+  Alpine.store("autotune").proposal = null;
+}
+
+// -------
+// missions, must match protocol/mission.go
+// -------
+
+const missionItemSize = 17;
+const missionHeaderSize = 4;
+const missionChunkItems = 6;
+const maxMissionItems = 100;
+const missionItem_none = 0xff;
+
+// item: {latitude, longitude, altitude, acceptRadius, loiterTime, speed}
+function encodeMissionItem(item) {
+  const buffer = new ArrayBuffer(missionItemSize);
+  const view = new DataView(buffer);
+  view.setInt32(0, Math.round(item.latitude * 1e7), false);
+  view.setInt32(4, Math.round(item.longitude * 1e7), false);
+  view.setFloat32(8, item.altitude, false);
+  view.setUint16(12, item.acceptRadius ?? 0, false);
+  view.setUint16(14, item.loiterTime ?? 0, false);
+  view.setUint8(16, item.speed ?? 0);
+  return Array.from(new Uint8Array(buffer));
+}
+
+function decodeMissionItem(bytes) {
+  const view = new DataView(bytes.buffer, bytes.byteOffset, missionItemSize);
+  return {
+    latitude: view.getInt32(0, false) / 1e7,
+    longitude: view.getInt32(4, false) / 1e7,
+    altitude: view.getFloat32(8, false),
+    acceptRadius: view.getUint16(12, false),
+    loiterTime: view.getUint16(14, false),
+    speed: view.getUint8(16),
+  };
+}
+
+function missionChecksum(items) {
+  return crc16(items.flatMap(encodeMissionItem));
+}
+
+// queues one upload command per chunk, an empty list clears the mission
+function uploadMission(items) {
+  if (items.length > maxMissionItems) {
+    Android.internalLogJS("Mission too long: " + items.length);
+    return;
+  }
+  const checksum = missionChecksum(items);
+  let index = 0;
+  do {
+    const chunk = items.slice(index, index + missionChunkItems);
+    usbWritePacket(
+      newCommand(payloadType_missionUpload, [
+        items.length,
+        checksum >> 8,
+        checksum & 0xff,
+        index,
+        ...chunk.flatMap(encodeMissionItem),
+      ]),
+    );
+    index += missionChunkItems;
+  } while (index < items.length);
+}
+
+// chunks come back one request at a time, see handleMissionChunk
+let missionDownload = null;
+
+function downloadMission() {
+  missionDownload = { items: [] };
+  usbWritePacket(newCommand(payloadType_missionRequest, [0]));
+}
+
+function handleMissionChunk(payload) {
+  // sequence number, count, checksum, index, items
+  const header = 2 + missionHeaderSize;
+  if (
+    payload.length < header ||
+    (payload.length - header) % missionItemSize !== 0
+  ) {
+    Android.internalLogJS("Malformed mission chunk");
+    return;
+  }
+  if (missionDownload == null) {
+    return;
+  }
+  const count = payload[2];
+  const checksum = (payload[3] << 8) | payload[4];
+  const index = payload[5];
+  if (index !== missionDownload.items.length) {
+    return; // a retried request answered twice
+  }
+  for (let i = header; i < payload.length; i += missionItemSize) {
+    missionDownload.items.push(
+      decodeMissionItem(payload.subarray(i, i + missionItemSize)),
+    );
+  }
+
+  if (missionDownload.items.length < count) {
+    usbWritePacket(
+      newCommand(payloadType_missionRequest, [missionDownload.items.length]),
+    );
+    return;
+  }
+  const items = missionDownload.items;
+  missionDownload = null;
+  if (missionChecksum(items) !== checksum) {
+    Android.internalLogJS("Downloaded mission checksum mismatch");
+    return;
+  }
+  Alpine.store("mission").items = items;
+  Android.internalLogJS("Downloaded mission of " + items.length + " items");
+}
+
+// -------
+// geofence, must match protocol/fence.go
+// -------
+
+const fenceItemSize = 12;
+const fenceChunkItems = 8;
+const maxFenceItems = 80;
+
+const fenceItem_inclusion = 0;
+const fenceItem_exclusion = 1;
+const fenceItem_exclusionCircle = 2;
+
+const fenceAction_rtl = 0;
+const fenceAction_loiter = 1;
+const fenceAction_land = 2;
+
+// limits: {minAltitude, maxAltitude, action}, equal altitudes disable them
+function encodeFenceLimits(limits) {
+  const buffer = new ArrayBuffer(9);
+  const view = new DataView(buffer);
+  view.setFloat32(0, limits.minAltitude, false);
+  view.setFloat32(4, limits.maxAltitude, false);
+  view.setUint8(8, limits.action);
+  return Array.from(new Uint8Array(buffer));
+}
+
+// item: {type, zone, latitude, longitude, radius}
+function encodeFenceItem(item) {
+  const buffer = new ArrayBuffer(fenceItemSize);
+  const view = new DataView(buffer);
+  view.setUint8(0, item.type);
+  view.setUint8(1, item.zone ?? 0);
+  view.setInt32(2, Math.round(item.latitude * 1e7), false);
+  view.setInt32(6, Math.round(item.longitude * 1e7), false);
+  view.setUint16(10, item.radius ?? 0, false);
+  return Array.from(new Uint8Array(buffer));
+}
+
+// queues one upload command per chunk, no items and equal altitudes clear the fence
+function uploadFence(limits, items) {
+  if (items.length > maxFenceItems) {
+    Android.internalLogJS("Fence too long: " + items.length);
+    return;
+  }
+  const encodedLimits = encodeFenceLimits(limits);
+  const checksum = crc16([...encodedLimits, ...items.flatMap(encodeFenceItem)]);
+  let index = 0;
+  do {
+    const chunk = items.slice(index, index + fenceChunkItems);
+    usbWritePacket(
+      newCommand(payloadType_fenceUpload, [
+        items.length,
+        checksum >> 8,
+        checksum & 0xff,
+        index,
+        ...encodedLimits,
+        ...chunk.flatMap(encodeFenceItem),
+      ]),
+    );
+    index += fenceChunkItems;
+  } while (index < items.length);
 }
 
 window.updateUsbStatusText = function (text) {
@@ -147,10 +571,20 @@ window.onNewData = function (base64) {
     return;
   }
 
-  let result = parsePacket(base64Decode(base64));
+  for (const packet of usbFrameDecoder.feed(base64Decode(base64))) {
+    if (packet == null) {
+      Android.internalLogJS("Frame error");
+      continue;
+    }
+    handlePacket(packet);
+  }
+};
+
+function handlePacket(packet) {
+  let result = parsePacket(packet);
 
   if (result.payloadType == payloadType_errorInternal) {
-    Android.internalLogJS("Parse error");
+    Android.internalLogJS("Parse error: " + result.reason);
   } else {
     switch (result.payloadType) {
       case payloadType_error:
@@ -162,6 +596,19 @@ window.onNewData = function (base64) {
         }
 
         Alpine.store("telemetry").Status = statusMap[planeStatus.status];
+        if (planeStatus.failsafe & failsafeFlag_linkLost) {
+          Alpine.store("telemetry").Status += " (link lost)";
+        }
+        if (planeStatus.failsafe & failsafeFlag_geofence) {
+          Alpine.store("telemetry").Status += " (outside fence)";
+        }
+        if (planeStatus.failsafe & failsafeFlag_sensors) {
+          Alpine.store("telemetry").Status += " (sensor fault)";
+        }
+        if (planeStatus.missionItem !== missionItem_none) {
+          Alpine.store("telemetry").Status +=
+            " (wp " + (planeStatus.missionItem + 1) + ")";
+        }
         Alpine.store("telemetry").Battery =
           planeStatus.battery.toFixed(1).toString() + "%";
         Alpine.store("telemetry").Speed =
@@ -179,11 +626,30 @@ window.onNewData = function (base64) {
         const rssi = dataView.getInt32(0, false);
         Alpine.store("connections").lora = rssi.toFixed(0) + "dBm";
         break;
+      case payloadType_ack:
+        if (result.payload.length !== 3) {
+          Android.internalLogJS("Malformed ack");
+          break;
+        }
+        const seq = (result.payload[0] << 8) | result.payload[1];
+        const reason = result.payload[2];
+        if (reason !== ackReason_ok) {
+          Android.internalLogJS(
+            "Command " + seq + " refused: " + (ackReasonMap[reason] ?? reason),
+          );
+        }
+        break;
+      case payloadType_missionChunk:
+        handleMissionChunk(result.payload);
+        break;
+      case payloadType_autotuneGains:
+        handleAutotuneGains(result.payload);
+        break;
       default:
         Android.internalLogJS("Invalid packet");
     }
   }
-};
+}
 
 const alt = "..."; // default string displayed before stuff loads in
 document.addEventListener("alpine:init", () => {
@@ -206,6 +672,14 @@ document.addEventListener("alpine:init", () => {
   Alpine.store("map", {
     map: null,
   });
+
+  Alpine.store("mission", {
+    items: [],
+  });
+
+  Alpine.store("autotune", {
+    proposal: null,
+  });
 });
 
 if (typeof window.Android !== "object") {
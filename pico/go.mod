@@ -9,9 +9,11 @@ require (
 //	runtime/interrupt v0.0.0-00010101000000-000000000000 // indirect
 //	runtime/volatile v0.0.0-00010101000000-000000000000 // indirect
 	tinygo.org/x/drivers v0.32.0
+	protocol v0.0.0-00010101000000-000000000000
 )
 //
 replace (
+	protocol => ../protocol
 //	device => ./modules/device
 //	machine => ./modules/machine
 //
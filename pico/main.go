@@ -2,10 +2,14 @@ package main
 
 import (
 	"encoding/binary"
+	"fmt"
 	"machine"
 	"pico/lora"
+	"sync"
 	"time"
 
+	"protocol"
+
 	"tinygo.org/x/drivers/hd44780i2c"
 )
 
@@ -19,44 +23,26 @@ func formatErrorPacket(while string, err error) []byte {
 }
 */
 
-func readUsbPacket() ([]byte, error) {
-	buf := make([]byte, maxPacketSize)
-	start := time.Now()
-	n := 0
-
-	for {
-		if n >= len(buf) {
-			break
-		}
-		if machine.USBCDC.Buffered() > 0 {
-			b, err := machine.USBCDC.ReadByte()
-			if err != nil {
-				return buf[:n], err
-			}
-			buf[n] = b
-			n++
-			start = time.Now()
-			continue
-		}
-		if time.Since(start) >= usbByteTimeout {
-			break
-		}
-		time.Sleep(2 * time.Millisecond)
-	}
-
-	return buf[:n], nil
+// frames and writes a packet, everything sent over usb has to go through here
+func usbWritePacket(packet []byte) {
+	machine.USBCDC.Write(protocol.EncodeFrame(packet))
 }
 
 const (
-	mainFrequency  = 433.36e6
-	maxPacketSize  = 1 << 8
-	usbByteTimeout = 25 * time.Millisecond
+	mainFrequency = 433.36e6
+	usbPollRate   = 2 * time.Millisecond
 )
 
 var (
 	onboardLed machine.Pin
 	lcd        hd44780i2c.Device
 	radio      *lora.LoRa
+
+	// commands from the phone waiting for the plane to ack them
+	uplink   = protocol.NewRetryQueue()
+	uplinkMu sync.Mutex
+
+	heartbeatFrame = protocol.EncodeFrame(protocol.NewPacket(protocol.PayloadType_heartbeat, nil))
 )
 
 func init() {
@@ -96,7 +82,7 @@ func init() {
 	if err != nil {
 		lcd.ClearDisplay()
 		lcd.Print([]byte(err.Error()))
-		machine.USBCDC.Write(formatErrorPacket("initializing lora", err))
+		usbWritePacket(protocol.FormatErrorPacket("initializing lora", err))
 
 		time.Sleep(time.Second)
 		panic(err)
@@ -107,7 +93,7 @@ func init() {
 	if err = radio.SetTxPower(true, 0, 9); err != nil {
 		lcd.ClearDisplay()
 		lcd.Print([]byte(err.Error()))
-		machine.USBCDC.Write(formatErrorPacket("setting tx power on init", err))
+		usbWritePacket(protocol.FormatErrorPacket("setting tx power on init", err))
 
 		time.Sleep(time.Second)
 		panic(err)
@@ -126,32 +112,53 @@ func main() {
 }
 
 func usbReceiveLoop() {
+	decoder := protocol.NewFrameDecoder()
 	for {
-		data, err := readUsbPacket()
-		if len(data) == 0 {
-			time.Sleep(3 * time.Second)
+		if machine.USBCDC.Buffered() == 0 {
+			time.Sleep(usbPollRate)
 			continue
 		}
+		b, err := machine.USBCDC.ReadByte()
 		if err != nil {
 			lcd.ClearDisplay()
 			lcd.Print([]byte(err.Error()))
-			machine.USBCDC.Write(formatErrorPacket("receiving usb", err))
+			usbWritePacket(protocol.FormatErrorPacket("receiving usb", err))
+			continue
+		}
+		packet, err := decoder.Feed(b)
+		if err != nil {
+			lcd.ClearDisplay()
+			lcd.Print([]byte(err.Error()))
+			usbWritePacket(protocol.FormatErrorPacket("decoding usb frame", err))
+			continue
+		}
+		if packet == nil {
+			continue
+		}
+		payloadType, payload, err := protocol.ParsePacket(packet)
+		if err != nil {
+			lcd.ClearDisplay()
+			lcd.Print([]byte(err.Error()))
+			usbWritePacket(protocol.FormatErrorPacket("parsing usb packet", err))
+			continue
+		}
+		if !protocol.IsCommand(payloadType) {
+			continue
+		}
+		seq, _, err := protocol.ParseCommand(payload)
+		if err != nil {
+			usbWritePacket(protocol.FormatErrorPacket("parsing usb command", err))
 			continue
 		}
 		lcd.ClearDisplay()
 		lcd.Print([]byte("USB:"))
 		lcd.SetCursor(0, 1)
-		lcd.Print(data)
-
-		/*
-			err = radio.Transmit(data)
-			if err != nil {
-				lcd.ClearDisplay()
-				lcd.Print([]byte(err.Error()))
-				machine.USBCDC.Write(formatErrorPacket("forwarding data", err))
-				continue
-			}
-		*/
+		lcd.Print(packet)
+
+		// sent by radioLoop once the plane is listening
+		uplinkMu.Lock()
+		uplink.Push(seq, protocol.EncodeFrame(packet), time.Now())
+		uplinkMu.Unlock()
 	}
 }
 
@@ -162,33 +169,90 @@ func usbTransmitLoop() {
 		if err != nil {
 			lcd.ClearDisplay()
 			lcd.Print([]byte(err.Error()))
-			machine.USBCDC.Write(formatErrorPacket("getting signal strength", err))
+			usbWritePacket(protocol.FormatErrorPacket("getting signal strength", err))
 			continue
 		}
 		rssiBytes := make([]byte, 4)
 		binary.BigEndian.PutUint32(rssiBytes, uint32(rssi))
-		machine.USBCDC.Write(newPacket(payloadType_rssi, rssiBytes))
+		usbWritePacket(protocol.NewPacket(protocol.PayloadType_rssi, rssiBytes))
 		time.Sleep(updateInterval)
 	}
 }
 
 func radioLoop() {
 	for {
-		data, err := radio.Receive(maxPacketSize, 800)
+		data, err := radio.Receive(protocol.MaxFrameSize, 800)
 		if err != nil {
 			lcd.ClearDisplay()
 			lcd.Print([]byte(err.Error()))
 			// TODO: do something when timed out
 			if err.Error() != "rx timeout" {
-				machine.USBCDC.Write(formatErrorPacket("receiving lora", err))
+				usbWritePacket(protocol.FormatErrorPacket("receiving lora", err))
 			}
 			continue
 		}
+		// never forward anything the phone would have to second guess
+		packet, err := protocol.DecodeFrame(data)
+		if err != nil {
+			lcd.ClearDisplay()
+			lcd.Print([]byte(err.Error()))
+			usbWritePacket(protocol.FormatErrorPacket("decoding lora frame", err))
+			continue
+		}
+		payloadType, payload, err := protocol.ParsePacket(packet)
+		if err != nil {
+			lcd.ClearDisplay()
+			lcd.Print([]byte(err.Error()))
+			usbWritePacket(protocol.FormatErrorPacket("parsing lora packet", err))
+			continue
+		}
 		lcd.ClearDisplay()
 		lcd.Print([]byte("forwarding"))
-		lcd.SetCursor(0, 1)
-		lcd.Print(data[13:29])
-		// forward the data
+		switch payloadType {
+		case protocol.PayloadType_bulk:
+			if len(payload) == len(protocol.PlaneStatusCompressed{}) {
+				lcd.SetCursor(0, 1)
+				lcd.Print(payload[11:27])
+			}
+			// the plane listens right after sending its status
+			sendUplink()
+		case protocol.PayloadType_ack:
+			if seq, _, err := protocol.ParseAck(payload); err == nil {
+				uplinkMu.Lock()
+				uplink.Ack(seq)
+				uplinkMu.Unlock()
+			}
+		case protocol.PayloadType_missionChunk:
+			// answers a mission request in place of an ack
+			if seq, _, err := protocol.ParseMissionChunkReply(payload); err == nil {
+				uplinkMu.Lock()
+				uplink.Ack(seq)
+				uplinkMu.Unlock()
+			}
+		}
+		// forward the frame as is
 		machine.USBCDC.Write(data)
 	}
 }
+
+// transmits the next due command, or a heartbeat so the plane knows we are still here,
+// and reports the commands the plane never answered
+func sendUplink() {
+	uplinkMu.Lock()
+	now := time.Now()
+	gaveUp := uplink.Expire(now)
+	_, frame, ok := uplink.Next(now)
+	uplinkMu.Unlock()
+
+	for _, seq := range gaveUp {
+		usbWritePacket(protocol.FormatErrorPacket("delivering command", fmt.Errorf("no ack for seq %d", seq)))
+	}
+	if !ok {
+		frame = heartbeatFrame
+	}
+	if err := radio.Transmit(frame); err != nil {
+		lcd.ClearDisplay()
+		lcd.Print([]byte(err.Error()))
+		usbWritePacket(protocol.FormatErrorPacket("transmitting command", err))
+	}
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// a finished autotune doesn't touch the flying loop. the plane sends the gains it came up with
+// in an autotuneGains packet ahead of its status every radio cycle, until the ground answers
+// with an autotuneConfirm command for that axis that either applies them or discards them.
+// gains structure, all big endian:
+//  axis - 1 byte, AutotuneAxis_*
+//  kp, ki, kd - float32 each
+
+const (
+	autotuneGainsSize   = 13
+	autotuneConfirmSize = 2
+)
+
+type AutotuneGains struct {
+	Axis       byte
+	Kp, Ki, Kd float32
+}
+
+func (g AutotuneGains) Validate() error {
+	if g.Axis >= autotuneAxis_count {
+		return fmt.Errorf("%w: autotune axis %d", ErrOutOfRange, g.Axis)
+	}
+	for _, k := range [...]float32{g.Kp, g.Ki, g.Kd} {
+		if math.IsNaN(float64(k)) || math.IsInf(float64(k), 0) || k < 0 {
+			return fmt.Errorf("%w: autotune gain %v", ErrOutOfRange, k)
+		}
+	}
+	return nil
+}
+
+func EncodeAutotuneGains(g AutotuneGains) []byte {
+	buf := make([]byte, 0, autotuneGainsSize)
+	buf = append(buf, g.Axis)
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(g.Kp))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(g.Ki))
+	return binary.BigEndian.AppendUint32(buf, math.Float32bits(g.Kd))
+}
+
+func DecodeAutotuneGains(buf []byte) (AutotuneGains, error) {
+	if len(buf) != autotuneGainsSize {
+		return AutotuneGains{}, fmt.Errorf("%w: autotune gains of %d bytes", ErrBadLength, len(buf))
+	}
+	g := AutotuneGains{
+		Axis: buf[0],
+		Kp:   math.Float32frombits(binary.BigEndian.Uint32(buf[1:5])),
+		Ki:   math.Float32frombits(binary.BigEndian.Uint32(buf[5:9])),
+		Kd:   math.Float32frombits(binary.BigEndian.Uint32(buf[9:13])),
+	}
+	if err := g.Validate(); err != nil {
+		return AutotuneGains{}, err
+	}
+	return g, nil
+}
+
+func NewAutotuneGains(g AutotuneGains) []byte {
+	return NewPacket(PayloadType_autotuneGains, EncodeAutotuneGains(g))
+}
+
+func NewAutotuneConfirmArgs(axis byte, apply bool) []byte {
+	if apply {
+		return []byte{axis, 1}
+	}
+	return []byte{axis, 0}
+}
+
+func ParseAutotuneConfirmArgs(args []byte) (axis byte, apply bool, err error) {
+	if len(args) != autotuneConfirmSize {
+		return 0, false, fmt.Errorf("%w: autotune confirm args of %d bytes", ErrBadLength, len(args))
+	}
+	axis = args[0]
+	if axis >= autotuneAxis_count || args[1] > 1 {
+		return 0, false, fmt.Errorf("%w: autotune confirm axis %d apply %d", ErrOutOfRange, axis, args[1])
+	}
+	return axis, args[1] == 1, nil
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestAutotuneGains(t *testing.T) {
+	g := AutotuneGains{Axis: AutotuneAxis_pitch, Kp: 1.5, Ki: 0.25, Kd: 0.125}
+	want := []byte{0x01, 0x3F, 0xC0, 0x00, 0x00, 0x3E, 0x80, 0x00, 0x00, 0x3E, 0x00, 0x00, 0x00}
+	buf := EncodeAutotuneGains(g)
+	if !bytes.Equal(buf, want) {
+		t.Fatalf("EncodeAutotuneGains = % X, want % X", buf, want)
+	}
+	got, err := DecodeAutotuneGains(buf)
+	if err != nil || got != g {
+		t.Fatalf("DecodeAutotuneGains = %+v, %v", got, err)
+	}
+
+	payloadType, payload, err := ParsePacket(NewAutotuneGains(g))
+	if err != nil || payloadType != PayloadType_autotuneGains || !bytes.Equal(payload, want) {
+		t.Errorf("NewAutotuneGains parsed to %d % X, %v", payloadType, payload, err)
+	}
+	if IsCommand(PayloadType_autotuneGains) {
+		t.Error("autotuneGains is telemetry, not a command")
+	}
+
+	nan := float32(math.NaN())
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"short", buf[:12], ErrBadLength},
+		{"yaw", EncodeAutotuneGains(AutotuneGains{Axis: autotuneAxis_count, Kp: 1}), ErrOutOfRange},
+		{"nan", EncodeAutotuneGains(AutotuneGains{Kp: 1, Ki: nan}), ErrOutOfRange},
+		{"negative", EncodeAutotuneGains(AutotuneGains{Kp: -1}), ErrOutOfRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeAutotuneGains(tc.buf); !errors.Is(err, tc.err) {
+				t.Errorf("DecodeAutotuneGains(% X) = %v, want %v", tc.buf, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestParseAutotuneConfirmArgs(t *testing.T) {
+	if !IsCommand(PayloadType_autotuneConfirm) {
+		t.Error("autotuneConfirm is not a command")
+	}
+	for _, tc := range []struct {
+		name  string
+		args  []byte
+		axis  byte
+		apply bool
+		err   error
+	}{
+		{"apply roll", NewAutotuneConfirmArgs(AutotuneAxis_roll, true), AutotuneAxis_roll, true, nil},
+		{"discard pitch", NewAutotuneConfirmArgs(AutotuneAxis_pitch, false), AutotuneAxis_pitch, false, nil},
+		{"yaw", NewAutotuneConfirmArgs(autotuneAxis_count, true), 0, false, ErrOutOfRange},
+		{"apply 2", []byte{AutotuneAxis_roll, 2}, 0, false, ErrOutOfRange},
+		{"no apply", []byte{AutotuneAxis_roll}, 0, false, ErrBadLength},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			axis, apply, err := ParseAutotuneConfirmArgs(tc.args)
+			if !errors.Is(err, tc.err) || axis != tc.axis || apply != tc.apply {
+				t.Errorf("ParseAutotuneConfirmArgs(% X) = %d %v %v", tc.args, axis, apply, err)
+			}
+		})
+	}
+}
+func TestParseAutotuneArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []byte
+		err  error
+	}{
+		{"roll", NewAutotuneArgs(AutotuneAxis_roll, AutotuneRule_zieglerNichols), nil},
+		{"pitch", NewAutotuneArgs(AutotuneAxis_pitch, AutotuneRule_tyreusLuyben), nil},
+		{"yaw", NewAutotuneArgs(autotuneAxis_count, AutotuneRule_tyreusLuyben), ErrOutOfRange},
+		{"unknown rule", NewAutotuneArgs(AutotuneAxis_roll, autotuneRule_count), ErrOutOfRange},
+		{"no rule", []byte{AutotuneAxis_roll}, ErrBadLength},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := ParseAutotuneArgs(tc.args); !errors.Is(err, tc.err) {
+				t.Errorf("err %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
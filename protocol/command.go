@@ -0,0 +1,230 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// uplink commands are everything the ground sends to the plane, the plane
+// answers each one with an ack carrying the same sequence number
+// command payload structure:
+//  sequence number - 2 bytes, big endian
+//  arguments - n bytes, layout depends on the payload type
+//
+// ack payload structure:
+//  sequence number of the answered command - 2 bytes, big endian
+//  reason - 1 byte, AckReason_ok for an ack and anything else for a nack
+
+const (
+	AckReason_ok          byte = iota
+	AckReason_malformed        // arguments have the wrong length
+	AckReason_outOfRange       // arguments decoded but are not sane
+	AckReason_rejected         // valid, but not allowed in the current state
+	AckReason_unsupported      // the plane does not implement this command
+	AckReason_checksum         // a mission or fence upload completed but its checksum did not match
+)
+
+// command argument layouts, all big endian:
+//  wpSet - latitude float64, longitude float64
+//  altSet - altitude float32, meters
+//  takeoff - no arguments
+//  land - no arguments, or the runway heading uint16 in degrees [0..359], the takeoff heading is used without it
+//  joystick - roll int16, pitch int16, yaw int16, each [-ManualAxisMax..ManualAxisMax]
+//  throttle - throttle uint16 [0..ManualThrottleMax]
+//  autotune - axis byte (AutotuneAxis_*), tuning rule byte (AutotuneRule_*)
+//  missionUpload - a mission chunk, see mission.go
+//  missionRequest - index byte of the first item wanted
+//  fenceUpload - a fence chunk, see fence.go
+//  goAround - no arguments
+//  qnhSet - sea level pressure float32, hectopascals [MinQNH..MaxQNH], 0 goes back to the field elevation from the gps
+//  autotuneConfirm - axis byte (AutotuneAxis_*), apply byte, 1 applies the proposed gains and 0 discards them
+
+const (
+	seqSize = 2
+	ackSize = seqSize + 1
+
+	joystickSize = 6
+	throttleSize = 2
+	autotuneSize = 2
+	landSize     = 2
+	qnhSize      = 4
+
+	// manual inputs are in per mille of full deflection / full power
+	ManualAxisMax     = 1000
+	ManualThrottleMax = 1000
+
+	// the lowest and highest sea level pressures on record, rounded out, hectopascals
+	MinQNH = 870
+	MaxQNH = 1085
+)
+
+const (
+	AutotuneAxis_roll byte = iota
+	AutotuneAxis_pitch
+	autotuneAxis_count
+)
+
+const (
+	AutotuneRule_zieglerNichols byte = iota // faster, more overshoot
+	AutotuneRule_tyreusLuyben               // gentler, less overshoot
+	autotuneRule_count
+)
+
+var ErrOutOfRange = errors.New("argument out of range")
+
+func IsCommand(payloadType byte) bool {
+	switch payloadType {
+	case PayloadType_wpSet,
+		PayloadType_altSet,
+		PayloadType_takeoff,
+		PayloadType_land,
+		PayloadType_joystick,
+		PayloadType_throttle,
+		PayloadType_autotune,
+		PayloadType_missionUpload,
+		PayloadType_missionRequest,
+		PayloadType_fenceUpload,
+		PayloadType_goAround,
+		PayloadType_qnhSet,
+		PayloadType_autotuneConfirm:
+		return true
+	}
+	return false
+}
+
+func NewCommand(payloadType byte, seq uint16, args []byte) []byte {
+	payload := binary.BigEndian.AppendUint16(make([]byte, 0, seqSize+len(args)), seq)
+	return NewPacket(payloadType, append(payload, args...))
+}
+
+func ParseCommand(payload []byte) (seq uint16, args []byte, err error) {
+	if len(payload) < seqSize {
+		return 0, nil, fmt.Errorf("%w: command without sequence number", ErrTruncated)
+	}
+	return binary.BigEndian.Uint16(payload[:seqSize]), payload[seqSize:], nil
+}
+
+func NewAck(seq uint16, reason byte) []byte {
+	payload := binary.BigEndian.AppendUint16(make([]byte, 0, ackSize), seq)
+	return NewPacket(PayloadType_ack, append(payload, reason))
+}
+
+func ParseAck(payload []byte) (seq uint16, reason byte, err error) {
+	if len(payload) != ackSize {
+		return 0, 0, fmt.Errorf("%w: ack of %d bytes", ErrBadLength, len(payload))
+	}
+	return binary.BigEndian.Uint16(payload[:seqSize]), payload[seqSize], nil
+}
+
+// remembers the answer given to the last few sequence numbers so a command
+// the ground retried because our ack got lost is answered again, not applied again
+type SeqWindow struct {
+	seqs    [32]uint16
+	reasons [32]byte
+	n, next int
+}
+
+func (w *SeqWindow) Lookup(seq uint16) (reason byte, seen bool) {
+	for i := range w.n {
+		if w.seqs[i] == seq {
+			return w.reasons[i], true
+		}
+	}
+	return 0, false
+}
+
+func (w *SeqWindow) Record(seq uint16, reason byte) {
+	w.seqs[w.next] = seq
+	w.reasons[w.next] = reason
+	w.next = (w.next + 1) % len(w.seqs)
+	w.n = min(w.n+1, len(w.seqs))
+}
+
+func NewJoystickArgs(roll, pitch, yaw int16) []byte {
+	args := make([]byte, 0, joystickSize)
+	args = binary.BigEndian.AppendUint16(args, uint16(roll))
+	args = binary.BigEndian.AppendUint16(args, uint16(pitch))
+	return binary.BigEndian.AppendUint16(args, uint16(yaw))
+}
+
+func ParseJoystickArgs(args []byte) (roll, pitch, yaw int16, err error) {
+	if len(args) != joystickSize {
+		return 0, 0, 0, fmt.Errorf("%w: joystick args of %d bytes", ErrBadLength, len(args))
+	}
+	roll = int16(binary.BigEndian.Uint16(args[0:2]))
+	pitch = int16(binary.BigEndian.Uint16(args[2:4]))
+	yaw = int16(binary.BigEndian.Uint16(args[4:6]))
+	for _, axis := range [...]int16{roll, pitch, yaw} {
+		if axis < -ManualAxisMax || axis > ManualAxisMax {
+			return 0, 0, 0, fmt.Errorf("%w: joystick axis %d", ErrOutOfRange, axis)
+		}
+	}
+	return roll, pitch, yaw, nil
+}
+
+func NewThrottleArgs(throttle uint16) []byte {
+	return binary.BigEndian.AppendUint16(make([]byte, 0, throttleSize), throttle)
+}
+
+func ParseThrottleArgs(args []byte) (throttle uint16, err error) {
+	if len(args) != throttleSize {
+		return 0, fmt.Errorf("%w: throttle args of %d bytes", ErrBadLength, len(args))
+	}
+	throttle = binary.BigEndian.Uint16(args)
+	if throttle > ManualThrottleMax {
+		return 0, fmt.Errorf("%w: throttle %d", ErrOutOfRange, throttle)
+	}
+	return throttle, nil
+}
+
+func NewAutotuneArgs(axis, rule byte) []byte {
+	return []byte{axis, rule}
+}
+
+func ParseAutotuneArgs(args []byte) (axis, rule byte, err error) {
+	if len(args) != autotuneSize {
+		return 0, 0, fmt.Errorf("%w: autotune args of %d bytes", ErrBadLength, len(args))
+	}
+	axis, rule = args[0], args[1]
+	if axis >= autotuneAxis_count || rule >= autotuneRule_count {
+		return 0, 0, fmt.Errorf("%w: autotune axis %d rule %d", ErrOutOfRange, axis, rule)
+	}
+	return axis, rule, nil
+}
+
+func NewLandArgs(runwayHeading uint16) []byte {
+	return binary.BigEndian.AppendUint16(make([]byte, 0, landSize), runwayHeading)
+}
+
+// ok is false for a land command that leaves the runway to the plane
+func ParseLandArgs(args []byte) (runwayHeading uint16, ok bool, err error) {
+	if len(args) == 0 {
+		return 0, false, nil
+	}
+	if len(args) != landSize {
+		return 0, false, fmt.Errorf("%w: land args of %d bytes", ErrBadLength, len(args))
+	}
+	runwayHeading = binary.BigEndian.Uint16(args)
+	if runwayHeading >= 360 {
+		return 0, false, fmt.Errorf("%w: runway heading %d", ErrOutOfRange, runwayHeading)
+	}
+	return runwayHeading, true, nil
+}
+
+func NewQNHArgs(qnh float32) []byte {
+	return binary.BigEndian.AppendUint32(make([]byte, 0, qnhSize), math.Float32bits(qnh))
+}
+
+// qnh is 0 when the ground clears it
+func ParseQNHArgs(args []byte) (qnh float32, err error) {
+	if len(args) != qnhSize {
+		return 0, fmt.Errorf("%w: qnh args of %d bytes", ErrBadLength, len(args))
+	}
+	qnh = math.Float32frombits(binary.BigEndian.Uint32(args))
+	if qnh != 0 && !(qnh >= MinQNH && qnh <= MaxQNH) {
+		return 0, fmt.Errorf("%w: qnh %v", ErrOutOfRange, qnh)
+	}
+	return qnh, nil
+}
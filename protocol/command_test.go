@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseManualArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []byte
+		err  error
+	}{
+		{"centred", NewJoystickArgs(0, 0, 0), nil},
+		{"full deflection", NewJoystickArgs(ManualAxisMax, -ManualAxisMax, ManualAxisMax), nil},
+		{"past full", NewJoystickArgs(0, ManualAxisMax+1, 0), ErrOutOfRange},
+		{"short", NewJoystickArgs(0, 0, 0)[:4], ErrBadLength},
+	} {
+		t.Run("joystick "+tc.name, func(t *testing.T) {
+			if _, _, _, err := ParseJoystickArgs(tc.args); !errors.Is(err, tc.err) {
+				t.Errorf("err %v, want %v", err, tc.err)
+			}
+		})
+	}
+	for _, tc := range []struct {
+		name string
+		args []byte
+		err  error
+	}{
+		{"idle", NewThrottleArgs(0), nil},
+		{"full", NewThrottleArgs(ManualThrottleMax), nil},
+		{"past full", NewThrottleArgs(ManualThrottleMax + 1), ErrOutOfRange},
+		{"long", []byte{0, 0, 0}, ErrBadLength},
+	} {
+		t.Run("throttle "+tc.name, func(t *testing.T) {
+			if _, err := ParseThrottleArgs(tc.args); !errors.Is(err, tc.err) {
+				t.Errorf("err %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCommandAck(t *testing.T) {
+	packet := NewCommand(PayloadType_qnhSet, 0xBEEF, NewQNHArgs(1013))
+	payloadType, payload, err := ParsePacket(packet)
+	if err != nil || payloadType != PayloadType_qnhSet || !IsCommand(payloadType) {
+		t.Fatalf("ParsePacket = %d %v", payloadType, err)
+	}
+	seq, args, err := ParseCommand(payload)
+	if err != nil || seq != 0xBEEF {
+		t.Fatalf("ParseCommand = %04X %v", seq, err)
+	}
+	if qnh, err := ParseQNHArgs(args); err != nil || qnh != 1013 {
+		t.Errorf("ParseQNHArgs = %v %v", qnh, err)
+	}
+	if _, _, err := ParseCommand(payload[:1]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("command without seq: %v", err)
+	}
+
+	_, payload, _ = ParsePacket(NewAck(0xBEEF, AckReason_checksum))
+	if seq, reason, err := ParseAck(payload); err != nil || seq != 0xBEEF || reason != AckReason_checksum {
+		t.Errorf("ParseAck = %04X %d %v", seq, reason, err)
+	}
+	if _, _, err := ParseAck(payload[:2]); !errors.Is(err, ErrBadLength) {
+		t.Errorf("short ack: %v", err)
+	}
+}
+
+func TestSeqWindow(t *testing.T) {
+	var w SeqWindow
+	w.Record(1, AckReason_ok)
+	w.Record(2, AckReason_outOfRange)
+	if reason, seen := w.Lookup(2); !seen || reason != AckReason_outOfRange {
+		t.Errorf("Lookup(2) = %d %v", reason, seen)
+	}
+	for seq := uint16(3); seq < 3+32; seq++ {
+		w.Record(seq, AckReason_ok)
+	}
+	if _, seen := w.Lookup(1); seen {
+		t.Error("seq 1 still remembered 33 commands later")
+	}
+	if _, seen := w.Lookup(34); !seen {
+		t.Error("latest seq forgotten")
+	}
+}
+
+func TestParseLandArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		args    []byte
+		heading uint16
+		ok      bool
+		err     error
+	}{
+		{"no runway", nil, 0, false, nil},
+		{"north", NewLandArgs(0), 0, true, nil},
+		{"last degree", NewLandArgs(359), 359, true, nil},
+		{"full circle", NewLandArgs(360), 0, false, ErrOutOfRange},
+		{"one byte", []byte{0x01}, 0, false, ErrBadLength},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			heading, ok, err := ParseLandArgs(tc.args)
+			if !errors.Is(err, tc.err) || heading != tc.heading || ok != tc.ok {
+				t.Errorf("got %d %v %v, want %d %v %v", heading, ok, err, tc.heading, tc.ok, tc.err)
+			}
+		})
+	}
+}
+
+func float32Args(v float32) []byte {
+	return binary.BigEndian.AppendUint32(nil, math.Float32bits(v))
+}
+
+func TestParseQNHArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []byte
+		want float32
+		err  error
+	}{
+		{"standard", NewQNHArgs(1013.25), 1013.25, nil},
+		{"cleared", NewQNHArgs(0), 0, nil},
+		{"lowest", NewQNHArgs(MinQNH), MinQNH, nil},
+		{"highest", NewQNHArgs(MaxQNH), MaxQNH, nil},
+		{"too low", NewQNHArgs(MinQNH - 1), 0, ErrOutOfRange},
+		{"too high", NewQNHArgs(MaxQNH + 1), 0, ErrOutOfRange},
+		{"pascals by mistake", NewQNHArgs(101325), 0, ErrOutOfRange},
+		{"negative", NewQNHArgs(-1013), 0, ErrOutOfRange},
+		{"nan", float32Args(float32(math.NaN())), 0, ErrOutOfRange},
+		{"inf", float32Args(float32(math.Inf(1))), 0, ErrOutOfRange},
+		{"short", []byte{0x44, 0x7D, 0x50}, 0, ErrBadLength},
+		{"long", append(NewQNHArgs(1013), 0), 0, ErrBadLength},
+		{"empty", nil, 0, ErrBadLength},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseQNHArgs(tc.args)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err %v, want %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("qnh %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
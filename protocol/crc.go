@@ -0,0 +1,18 @@
+package protocol
+
+// crc-16/ccitt-false (poly 0x1021, init 0xFFFF, no reflection, no xorout)
+// bitwise on purpose, the packets are tiny and the pico does not need the table
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
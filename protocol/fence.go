@@ -0,0 +1,216 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// geofences are uploaded in chunks like missions
+// chunk structure:
+//  item count of the whole fence - 1 byte
+//  fence checksum - 2 bytes, big endian, CRC16 over the encoded limits and all encoded items in order
+//  index of the first item in this chunk - 1 byte
+//  limits - 9 bytes, repeated in every chunk, the plane goes by the ones at index 0
+//  items - up to FenceChunkItems, fenceItemSize bytes each
+//
+// limits structure, all big endian:
+//  min altitude, max altitude - float32 each, meters like altSet, equal values disable the altitude limits
+//  breach action - 1 byte, FenceAction_*
+//
+// item structure, all big endian:
+//  type - 1 byte, FenceItem_*
+//  zone - 1 byte, vertices of the same polygon share it, listed in order around the polygon
+//  latitude, longitude - int32 each, degrees * 1e7
+//  radius - uint16, meters, circles only
+//
+// the plane has to stay inside every inclusion polygon and outside every exclusion zone.
+// uploading is a fenceUpload command per chunk, in any order and acked like a mission
+// upload. an upload with a count of 0 and equal altitudes clears the fence
+
+const (
+	fenceItemSize   = 12
+	fenceLimitsSize = 9
+	fenceHeaderSize = 4 + fenceLimitsSize
+
+	// keeps a chunk command plus cobs overhead under 127 bytes
+	FenceChunkItems = 8
+	MaxFenceItems   = 80
+)
+
+const (
+	FenceItem_inclusion       byte = iota // vertex of an inclusion polygon
+	FenceItem_exclusion                   // vertex of an exclusion polygon
+	FenceItem_exclusionCircle             // center of an exclusion circle
+	fenceItem_count
+)
+
+const (
+	FenceAction_rtl byte = iota
+	FenceAction_loiter
+	FenceAction_land
+	fenceAction_count
+)
+
+var ErrBadFenceChunk = errors.New("bad fence chunk")
+
+type FenceLimits struct {
+	MinAltitude, MaxAltitude float32
+	Action                   byte
+}
+
+type FenceItem struct {
+	Type, Zone          byte
+	Latitude, Longitude float64
+	Radius              uint16
+}
+
+type FenceChunk struct {
+	Count    byte
+	Checksum uint16
+	Index    byte
+	Limits   FenceLimits
+	Items    []FenceItem
+}
+
+func (l FenceLimits) Validate() error {
+	for _, alt := range [...]float32{l.MinAltitude, l.MaxAltitude} {
+		if math.IsNaN(float64(alt)) || math.IsInf(float64(alt), 0) {
+			return fmt.Errorf("%w: fence altitude %v", ErrOutOfRange, alt)
+		}
+	}
+	if l.MinAltitude > l.MaxAltitude {
+		return fmt.Errorf("%w: fence altitudes %v..%v", ErrOutOfRange, l.MinAltitude, l.MaxAltitude)
+	}
+	if l.Action >= fenceAction_count {
+		return fmt.Errorf("%w: fence action %d", ErrOutOfRange, l.Action)
+	}
+	return nil
+}
+
+func (f FenceItem) Validate() error {
+	if f.Type >= fenceItem_count {
+		return fmt.Errorf("%w: fence item type %d", ErrOutOfRange, f.Type)
+	}
+	if math.IsNaN(f.Latitude) || math.Abs(f.Latitude) > 90 ||
+		math.IsNaN(f.Longitude) || math.Abs(f.Longitude) > 180 {
+		return fmt.Errorf("%w: fence item at %v/%v", ErrOutOfRange, f.Latitude, f.Longitude)
+	}
+	if f.Type == FenceItem_exclusionCircle && f.Radius == 0 {
+		return fmt.Errorf("%w: fence circle without a radius", ErrOutOfRange)
+	}
+	return nil
+}
+
+func appendFenceLimits(buf []byte, l FenceLimits) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(l.MinAltitude))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(l.MaxAltitude))
+	return append(buf, l.Action)
+}
+
+func parseFenceLimits(b []byte) FenceLimits {
+	return FenceLimits{
+		MinAltitude: math.Float32frombits(binary.BigEndian.Uint32(b[0:4])),
+		MaxAltitude: math.Float32frombits(binary.BigEndian.Uint32(b[4:8])),
+		Action:      b[8],
+	}
+}
+
+func AppendFenceItem(buf []byte, f FenceItem) []byte {
+	buf = append(buf, f.Type, f.Zone)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(f.Latitude*coordScale))))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(f.Longitude*coordScale))))
+	return binary.BigEndian.AppendUint16(buf, f.Radius)
+}
+
+func parseFenceItem(b []byte) FenceItem {
+	return FenceItem{
+		Type:      b[0],
+		Zone:      b[1],
+		Latitude:  float64(int32(binary.BigEndian.Uint32(b[2:6]))) / coordScale,
+		Longitude: float64(int32(binary.BigEndian.Uint32(b[6:10]))) / coordScale,
+		Radius:    binary.BigEndian.Uint16(b[10:12]),
+	}
+}
+
+// limits followed by the items, also what the checksum is computed over
+func EncodeFence(limits FenceLimits, items []FenceItem) []byte {
+	buf := make([]byte, 0, fenceLimitsSize+len(items)*fenceItemSize)
+	buf = appendFenceLimits(buf, limits)
+	for _, f := range items {
+		buf = AppendFenceItem(buf, f)
+	}
+	return buf
+}
+
+func DecodeFence(data []byte) (FenceLimits, []FenceItem, error) {
+	if len(data) < fenceLimitsSize || (len(data)-fenceLimitsSize)%fenceItemSize != 0 {
+		return FenceLimits{}, nil, fmt.Errorf("%w: %d bytes of fence", ErrBadLength, len(data))
+	}
+	items := make([]FenceItem, 0, (len(data)-fenceLimitsSize)/fenceItemSize)
+	for i := fenceLimitsSize; i < len(data); i += fenceItemSize {
+		items = append(items, parseFenceItem(data[i:i+fenceItemSize]))
+	}
+	return parseFenceLimits(data), items, nil
+}
+
+// coordinates are rounded to what the encoding carries first, like MissionChecksum
+func FenceChecksum(limits FenceLimits, items []FenceItem) uint16 {
+	return CRC16(EncodeFence(limits, items))
+}
+
+func NewFenceChunk(c FenceChunk) []byte {
+	if len(c.Items) > FenceChunkItems {
+		panic("protocol: too many items in a fence chunk")
+	}
+	buf := make([]byte, 0, fenceHeaderSize+len(c.Items)*fenceItemSize)
+	buf = append(buf, c.Count)
+	buf = binary.BigEndian.AppendUint16(buf, c.Checksum)
+	buf = append(buf, c.Index)
+	return append(buf, EncodeFence(c.Limits, c.Items)...)
+}
+
+func ParseFenceChunk(b []byte) (FenceChunk, error) {
+	if len(b) < fenceHeaderSize || (len(b)-fenceHeaderSize)%fenceItemSize != 0 {
+		return FenceChunk{}, fmt.Errorf("%w: fence chunk of %d bytes", ErrBadLength, len(b))
+	}
+	c := FenceChunk{
+		Count:    b[0],
+		Checksum: binary.BigEndian.Uint16(b[1:3]),
+		Index:    b[3],
+	}
+	c.Limits, c.Items, _ = DecodeFence(b[4:])
+	if len(c.Items) > FenceChunkItems || c.Count > MaxFenceItems ||
+		int(c.Index)+len(c.Items) > int(c.Count) {
+		return FenceChunk{}, fmt.Errorf("%w: %d items at %d of %d", ErrBadFenceChunk, len(c.Items), c.Index, c.Count)
+	}
+	if err := c.Limits.Validate(); err != nil {
+		return FenceChunk{}, err
+	}
+	for _, f := range c.Items {
+		if err := f.Validate(); err != nil {
+			return FenceChunk{}, err
+		}
+	}
+	return c, nil
+}
+
+// splits a fence into the chunks to upload, a fence without items is one empty chunk
+func SplitFence(limits FenceLimits, items []FenceItem) ([]FenceChunk, error) {
+	if len(items) > MaxFenceItems {
+		return nil, fmt.Errorf("%w: %d fence items", ErrOutOfRange, len(items))
+	}
+	checksum := FenceChecksum(limits, items)
+	var chunks []FenceChunk
+	for i := 0; i == 0 || i < len(items); i += FenceChunkItems {
+		chunks = append(chunks, FenceChunk{
+			Count:    byte(len(items)),
+			Checksum: checksum,
+			Index:    byte(i),
+			Limits:   limits,
+			Items:    items[i:min(i+FenceChunkItems, len(items))],
+		})
+	}
+	return chunks, nil
+}
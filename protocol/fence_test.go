@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testFenceLimits = FenceLimits{MinAltitude: 20, MaxAltitude: 120, Action: FenceAction_rtl}
+
+// on the 1e-7 degree grid like missionItems
+func fenceItems(n int) []FenceItem {
+	items := make([]FenceItem, n)
+	for i := range items {
+		items[i] = FenceItem{Type: FenceItem_inclusion, Latitude: float64(481000000+i*10000) / coordScale, Longitude: 11.5}
+	}
+	return items
+}
+
+func TestFenceRoundTrip(t *testing.T) {
+	items := append(fenceItems(10), FenceItem{Type: FenceItem_exclusionCircle, Zone: 1, Latitude: 48.105, Longitude: 11.505, Radius: 50})
+	chunks, err := SplitFence(testFenceLimits, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("%d chunks for 11 items, want 2", len(chunks))
+	}
+	var back []FenceItem
+	for _, c := range chunks {
+		parsed, err := ParseFenceChunk(NewFenceChunk(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Limits != testFenceLimits || parsed.Checksum != FenceChecksum(testFenceLimits, items) {
+			t.Errorf("chunk header %+v %04X", parsed.Limits, parsed.Checksum)
+		}
+		back = append(back, parsed.Items...)
+	}
+	if !reflect.DeepEqual(back, items) {
+		t.Errorf("got back %v, want %v", back, items)
+	}
+
+	if _, err := SplitFence(testFenceLimits, fenceItems(MaxFenceItems+1)); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("oversized fence: %v", err)
+	}
+}
+
+func TestParseFenceChunk(t *testing.T) {
+	chunk := func(count, index byte, limits FenceLimits, items []FenceItem) []byte {
+		return NewFenceChunk(FenceChunk{Count: count, Index: index, Limits: limits, Items: items})
+	}
+	item := func(f FenceItem) []FenceItem { return []FenceItem{f} }
+
+	for _, tc := range []struct {
+		name  string
+		chunk []byte
+		err   error
+	}{
+		{"cleared", chunk(0, 0, FenceLimits{}, nil), nil},
+		{"full chunk", chunk(8, 0, testFenceLimits, fenceItems(8)), nil},
+		{"last chunk", chunk(MaxFenceItems, MaxFenceItems-2, testFenceLimits, fenceItems(2)), nil},
+		{"limits cut short", chunk(0, 0, testFenceLimits, nil)[:fenceHeaderSize-1], ErrBadLength},
+		{"partial item", chunk(1, 0, testFenceLimits, fenceItems(1))[:fenceHeaderSize+fenceItemSize-1], ErrBadLength},
+		{"past the count", chunk(3, 2, testFenceLimits, fenceItems(2)), ErrBadFenceChunk},
+		{"count too large", chunk(MaxFenceItems+1, 0, testFenceLimits, fenceItems(1)), ErrBadFenceChunk},
+		{"too many items", append(chunk(9, 0, testFenceLimits, fenceItems(8)), AppendFenceItem(nil, fenceItems(1)[0])...), ErrBadFenceChunk},
+		{"altitudes swapped", chunk(0, 0, FenceLimits{MinAltitude: 120, MaxAltitude: 20}, nil), ErrOutOfRange},
+		{"unknown action", chunk(0, 0, FenceLimits{Action: fenceAction_count}, nil), ErrOutOfRange},
+		{"unknown item type", chunk(1, 0, testFenceLimits, item(FenceItem{Type: fenceItem_count})), ErrOutOfRange},
+		{"latitude past the pole", chunk(1, 0, testFenceLimits, item(FenceItem{Latitude: -91})), ErrOutOfRange},
+		{"circle without radius", chunk(1, 0, testFenceLimits, item(FenceItem{Type: FenceItem_exclusionCircle})), ErrOutOfRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseFenceChunk(tc.chunk); !errors.Is(err, tc.err) {
+				t.Errorf("err %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// packets travel cobs encoded and terminated by a single zero byte, so a
+// stream reader can always tell where one ends and resync after garbage
+// by waiting for the next zero
+// frame structure:
+//  cobs(packet) - n+1 bytes for n <= 254, one more byte per further 254
+//  delimiter - 1 byte, always 0x00
+
+const (
+	frameDelimiter = 0x00
+
+	MaxFrameSize = MaxPacketSize + MaxPacketSize/254 + 2
+)
+
+var (
+	ErrBadFrame     = errors.New("invalid cobs frame")
+	ErrFrameTooLong = errors.New("frame too long")
+)
+
+func EncodeFrame(packet []byte) []byte {
+	frame := make([]byte, 1, len(packet)+len(packet)/254+2)
+	codeIdx := 0
+	code := byte(1)
+	for _, b := range packet {
+		if b != 0 {
+			frame = append(frame, b)
+			code++
+		}
+		if b == 0 || code == 0xFF {
+			frame[codeIdx] = code
+			codeIdx = len(frame)
+			frame = append(frame, 0)
+			code = 1
+		}
+	}
+	frame[codeIdx] = code
+	return append(frame, frameDelimiter)
+}
+
+// decodes exactly one delimited frame, as received from lora
+func DecodeFrame(frame []byte) ([]byte, error) {
+	if len(frame) == 0 || frame[len(frame)-1] != frameDelimiter {
+		return nil, fmt.Errorf("%w: missing delimiter", ErrBadFrame)
+	}
+	return decodeCOBS(frame[:len(frame)-1])
+}
+
+func decodeCOBS(encoded []byte) ([]byte, error) {
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrBadFrame)
+	}
+	decoded := make([]byte, 0, len(encoded))
+	for i := 0; i < len(encoded); {
+		code := int(encoded[i])
+		if code == 0 {
+			return nil, fmt.Errorf("%w: zero inside frame", ErrBadFrame)
+		}
+		i++
+		if i+code-1 > len(encoded) {
+			return nil, fmt.Errorf("%w: block overruns frame", ErrBadFrame)
+		}
+		decoded = append(decoded, encoded[i:i+code-1]...)
+		i += code - 1
+		if code != 0xFF && i < len(encoded) {
+			decoded = append(decoded, 0)
+		}
+	}
+	return decoded, nil
+}
+
+// incremental decoder for byte streams such as usb cdc
+type FrameDecoder struct {
+	buf      []byte
+	overflow bool
+}
+
+func NewFrameDecoder() *FrameDecoder {
+	return &FrameDecoder{buf: make([]byte, 0, MaxFrameSize)}
+}
+
+// returns the decoded packet once its delimiter arrives and nil before that.
+// errors mean a frame was dropped, the decoder is already resynced by then.
+// empty frames (repeated delimiters) are skipped silently so a sender can
+// always lead with a zero to flush whatever the receiver was holding
+func (d *FrameDecoder) Feed(b byte) ([]byte, error) {
+	if b != frameDelimiter {
+		if len(d.buf) >= MaxFrameSize {
+			d.overflow = true
+			return nil, nil
+		}
+		d.buf = append(d.buf, b)
+		return nil, nil
+	}
+
+	defer d.Reset()
+	if d.overflow {
+		return nil, ErrFrameTooLong
+	}
+	if len(d.buf) == 0 {
+		return nil, nil
+	}
+	return decodeCOBS(d.buf)
+}
+
+// drops any partially received frame
+func (d *FrameDecoder) Reset() {
+	d.buf = d.buf[:0]
+	d.overflow = false
+}
@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// missions are moved in chunks small enough for one LoRa packet
+// chunk structure:
+//  item count of the whole mission - 1 byte
+//  mission checksum - 2 bytes, big endian, CRC16 over all encoded items in order
+//  index of the first item in this chunk - 1 byte
+//  items - up to MissionChunkItems, missionItemSize bytes each
+//
+// item structure, all big endian:
+//  latitude, longitude - int32 each, degrees * 1e7
+//  altitude - float32, meters
+//  acceptance radius - uint16, meters, 0 leaves it to the plane
+//  loiter time - uint16, seconds
+//  speed - uint8, m/s, 0 leaves it to the plane
+//
+// uploading is a missionUpload command per chunk, each acked. they may arrive in any order and
+// more than once, the one that completes the mission is acked with AckReason_checksum if it
+// did not add up. an upload with a count of 0 clears the mission. downloading is a
+// missionRequest per chunk, answered with a missionChunk carrying the request's sequence
+// number in front of the chunk
+
+const (
+	missionItemSize   = 17
+	missionHeaderSize = 4
+
+	// keeps a chunk command plus cobs overhead under 127 bytes
+	MissionChunkItems = 6
+	MaxMissionItems   = 100
+
+	// PlaneStatus.MissionItem when no mission is being flown
+	MissionItem_none = 0xFF
+
+	coordScale = 1e7
+)
+
+var ErrBadChunk = errors.New("bad mission chunk")
+
+type MissionItem struct {
+	Latitude, Longitude float64
+	Altitude            float32
+	AcceptRadius        uint16
+	LoiterTime          uint16
+	Speed               uint8
+}
+
+type MissionChunk struct {
+	Count    byte
+	Checksum uint16
+	Index    byte
+	Items    []MissionItem
+}
+
+func (m MissionItem) Validate() error {
+	if math.IsNaN(m.Latitude) || math.Abs(m.Latitude) > 90 ||
+		math.IsNaN(m.Longitude) || math.Abs(m.Longitude) > 180 {
+		return fmt.Errorf("%w: mission item at %v/%v", ErrOutOfRange, m.Latitude, m.Longitude)
+	}
+	if math.IsNaN(float64(m.Altitude)) || math.IsInf(float64(m.Altitude), 0) {
+		return fmt.Errorf("%w: mission item altitude %v", ErrOutOfRange, m.Altitude)
+	}
+	return nil
+}
+
+func AppendMissionItem(buf []byte, m MissionItem) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(m.Latitude*coordScale))))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(m.Longitude*coordScale))))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(m.Altitude))
+	buf = binary.BigEndian.AppendUint16(buf, m.AcceptRadius)
+	buf = binary.BigEndian.AppendUint16(buf, m.LoiterTime)
+	return append(buf, m.Speed)
+}
+
+func parseMissionItem(b []byte) MissionItem {
+	return MissionItem{
+		Latitude:     float64(int32(binary.BigEndian.Uint32(b[0:4]))) / coordScale,
+		Longitude:    float64(int32(binary.BigEndian.Uint32(b[4:8]))) / coordScale,
+		Altitude:     math.Float32frombits(binary.BigEndian.Uint32(b[8:12])),
+		AcceptRadius: binary.BigEndian.Uint16(b[12:14]),
+		LoiterTime:   binary.BigEndian.Uint16(b[14:16]),
+		Speed:        b[16],
+	}
+}
+
+// items as they go over the air, also what the checksum is computed over
+func EncodeMission(items []MissionItem) []byte {
+	buf := make([]byte, 0, len(items)*missionItemSize)
+	for _, m := range items {
+		buf = AppendMissionItem(buf, m)
+	}
+	return buf
+}
+
+func DecodeMission(data []byte) ([]MissionItem, error) {
+	if len(data)%missionItemSize != 0 {
+		return nil, fmt.Errorf("%w: %d bytes of mission items", ErrBadLength, len(data))
+	}
+	items := make([]MissionItem, 0, len(data)/missionItemSize)
+	for i := 0; i < len(data); i += missionItemSize {
+		items = append(items, parseMissionItem(data[i:i+missionItemSize]))
+	}
+	return items, nil
+}
+
+// coordinates are rounded to what the encoding carries first, so a mission checks out
+// the same on both ends
+func MissionChecksum(items []MissionItem) uint16 {
+	return CRC16(EncodeMission(items))
+}
+
+func NewMissionChunk(c MissionChunk) []byte {
+	if len(c.Items) > MissionChunkItems {
+		panic("protocol: too many items in a mission chunk")
+	}
+	buf := make([]byte, 0, missionHeaderSize+len(c.Items)*missionItemSize)
+	buf = append(buf, c.Count)
+	buf = binary.BigEndian.AppendUint16(buf, c.Checksum)
+	buf = append(buf, c.Index)
+	for _, m := range c.Items {
+		buf = AppendMissionItem(buf, m)
+	}
+	return buf
+}
+
+func ParseMissionChunk(b []byte) (MissionChunk, error) {
+	if len(b) < missionHeaderSize || (len(b)-missionHeaderSize)%missionItemSize != 0 {
+		return MissionChunk{}, fmt.Errorf("%w: mission chunk of %d bytes", ErrBadLength, len(b))
+	}
+	c := MissionChunk{
+		Count:    b[0],
+		Checksum: binary.BigEndian.Uint16(b[1:3]),
+		Index:    b[3],
+	}
+	items, _ := DecodeMission(b[missionHeaderSize:])
+	c.Items = items
+	if len(c.Items) > MissionChunkItems || c.Count > MaxMissionItems ||
+		int(c.Index)+len(c.Items) > int(c.Count) {
+		return MissionChunk{}, fmt.Errorf("%w: %d items at %d of %d", ErrBadChunk, len(c.Items), c.Index, c.Count)
+	}
+	for _, m := range c.Items {
+		if err := m.Validate(); err != nil {
+			return MissionChunk{}, err
+		}
+	}
+	return c, nil
+}
+
+// splits a mission into the chunks to upload, a cleared mission is one empty chunk
+func SplitMission(items []MissionItem) ([]MissionChunk, error) {
+	if len(items) > MaxMissionItems {
+		return nil, fmt.Errorf("%w: %d mission items", ErrOutOfRange, len(items))
+	}
+	checksum := MissionChecksum(items)
+	chunks := []MissionChunk{{Count: byte(len(items)), Checksum: checksum}}
+	for i := MissionChunkItems; i < len(items); i += MissionChunkItems {
+		chunks = append(chunks, MissionChunk{Count: byte(len(items)), Checksum: checksum, Index: byte(i)})
+	}
+	for i := range chunks {
+		start := int(chunks[i].Index)
+		chunks[i].Items = items[start:min(start+MissionChunkItems, len(items))]
+	}
+	return chunks, nil
+}
+
+func NewMissionRequestArgs(index byte) []byte {
+	return []byte{index}
+}
+
+func ParseMissionRequestArgs(args []byte) (index byte, err error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%w: mission request args of %d bytes", ErrBadLength, len(args))
+	}
+	return args[0], nil
+}
+
+// the answer to a missionRequest, acks it and carries the chunk
+func NewMissionChunkReply(seq uint16, c MissionChunk) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, seq)
+	return NewPacket(PayloadType_missionChunk, append(payload, NewMissionChunk(c)...))
+}
+
+func ParseMissionChunkReply(payload []byte) (seq uint16, c MissionChunk, err error) {
+	if len(payload) < seqSize {
+		return 0, MissionChunk{}, fmt.Errorf("%w: mission chunk without sequence number", ErrTruncated)
+	}
+	c, err = ParseMissionChunk(payload[seqSize:])
+	return binary.BigEndian.Uint16(payload[:seqSize]), c, err
+}
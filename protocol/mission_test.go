@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// on the 1e-7 degree grid the encoding carries, so they come back exactly
+func missionItems(n int) []MissionItem {
+	items := make([]MissionItem, n)
+	for i := range items {
+		items[i] = MissionItem{
+			Latitude:     float64(481000000+i*10000) / coordScale,
+			Longitude:    float64(-115000000-i*10000) / coordScale,
+			Altitude:     100 + float32(i),
+			AcceptRadius: uint16(i),
+			LoiterTime:   30,
+			Speed:        15,
+		}
+	}
+	return items
+}
+
+func TestMissionRoundTrip(t *testing.T) {
+	items := missionItems(15)
+	chunks, err := SplitMission(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks for 15 items, want 3", len(chunks))
+	}
+	var back []MissionItem
+	for _, c := range chunks {
+		parsed, err := ParseMissionChunk(NewMissionChunk(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Count != 15 || parsed.Checksum != MissionChecksum(items) || int(parsed.Index) != len(back) {
+			t.Errorf("chunk header %d/%04X/%d", parsed.Count, parsed.Checksum, parsed.Index)
+		}
+		back = append(back, parsed.Items...)
+	}
+	if !reflect.DeepEqual(back, items) {
+		t.Errorf("got back %v, want %v", back, items)
+	}
+
+	reply := NewMissionChunkReply(0x0102, chunks[1])
+	_, payload, err := ParsePacket(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, c, err := ParseMissionChunkReply(payload)
+	if err != nil || seq != 0x0102 || !reflect.DeepEqual(c.Items, items[6:12]) {
+		t.Errorf("ParseMissionChunkReply = %04X %v %v", seq, c, err)
+	}
+
+	if _, err := SplitMission(missionItems(MaxMissionItems + 1)); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("oversized mission: %v", err)
+	}
+}
+
+func TestParseMissionChunk(t *testing.T) {
+	chunk := func(count, index byte, items []MissionItem) []byte {
+		return NewMissionChunk(MissionChunk{Count: count, Index: index, Items: items})
+	}
+	badItem := func(m MissionItem) []byte {
+		buf := []byte{1, 0, 0, 0}
+		return AppendMissionItem(buf, m)
+	}
+	nanAltitude := badItem(missionItems(1)[0])
+	binary.BigEndian.PutUint32(nanAltitude[missionHeaderSize+8:], math.Float32bits(float32(math.NaN())))
+
+	for _, tc := range []struct {
+		name  string
+		chunk []byte
+		err   error
+	}{
+		{"cleared", chunk(0, 0, nil), nil},
+		{"full chunk", chunk(6, 0, missionItems(6)), nil},
+		{"last chunk", chunk(MaxMissionItems, MaxMissionItems-4, missionItems(4)), nil},
+		{"header only", []byte{1, 0, 0}, ErrBadLength},
+		{"partial item", chunk(1, 0, missionItems(1))[:missionHeaderSize+missionItemSize-1], ErrBadLength},
+		{"too many items", append(chunk(7, 0, missionItems(6)), AppendMissionItem(nil, missionItems(1)[0])...), ErrBadChunk},
+		{"past the count", chunk(5, 2, missionItems(4)), ErrBadChunk},
+		{"count too large", chunk(MaxMissionItems+1, 0, missionItems(1)), ErrBadChunk},
+		{"latitude past the pole", badItem(MissionItem{Latitude: 90.5}), ErrOutOfRange},
+		{"longitude past the antimeridian", badItem(MissionItem{Longitude: -180.5}), ErrOutOfRange},
+		{"nan altitude", nanAltitude, ErrOutOfRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseMissionChunk(tc.chunk); !errors.Is(err, tc.err) {
+				t.Errorf("err %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	PayloadType_error byte = iota
+	PayloadType_bulk       // all plane status data
+	PayloadType_rssi       // exclusive to pico -> phone
+	PayloadType_wpSet
+	PayloadType_altSet
+	PayloadType_takeoff
+	PayloadType_land
+	// for manual control only
+	PayloadType_joystick
+	PayloadType_throttle
+	PayloadType_ack       // plane -> ground, answer to any command
+	PayloadType_heartbeat // ground -> plane, sent whenever there is no command so the plane knows the link is up
+	PayloadType_autotune  // start relay autotuning of one attitude axis
+	// missions, see mission.go
+	PayloadType_missionUpload  // ground -> plane, one chunk of a new mission
+	PayloadType_missionRequest // ground -> plane, asks for the chunk starting at an index
+	PayloadType_missionChunk   // plane -> ground, answer to missionRequest in place of an ack
+	// geofence, see fence.go
+	PayloadType_fenceUpload // ground -> plane, one chunk of a new geofence
+	PayloadType_goAround    // abort a landing, climb out and loiter
+	PayloadType_qnhSet      // sea level pressure for the barometric altitude
+	// autotune results, see autotune.go
+	PayloadType_autotuneGains   // plane -> ground, gains a finished autotune proposes
+	PayloadType_autotuneConfirm // ground -> plane, applies or discards the proposed gains
+
+	payloadType_count // keep last, everything at or above this is unknown
+
+	PayloadType_errorInternal = 0xFF
+)
+
+const (
+	headerSize  = 2
+	trailerSize = 2
+
+	// the length byte is the limit
+	MaxPacketSize  = 0xFF
+	MaxPayloadSize = MaxPacketSize - headerSize - trailerSize
+)
+
+var (
+	ErrTruncated   = errors.New("packet truncated")
+	ErrBadLength   = errors.New("packet length mismatch")
+	ErrBadCRC      = errors.New("packet crc mismatch")
+	ErrUnknownType = errors.New("unknown payload type")
+)
+
+// panics if the payload is longer than MaxPayloadSize
+func NewPacket(payloadType byte, payload []byte) []byte {
+	// these packets are meant for everything from
+	// lora to usb and as such do not have to be modified when forwarded
+	// packet structure:
+	//  header - 2 bytes
+	//    first - length of the full packet including header and trailer
+	//    second - data type of payload
+	//
+	//  payload - n bytes
+	//
+	//  trailer - 2 bytes
+	//    crc16 of header and payload, big endian
+	if len(payload) > MaxPayloadSize {
+		panic("protocol: payload too large")
+	}
+	packet := make([]byte, 0, len(payload)+headerSize+trailerSize)
+	packet = append(packet, byte(len(payload)+headerSize+trailerSize), payloadType)
+	packet = append(packet, payload...)
+	return binary.BigEndian.AppendUint16(packet, CRC16(packet))
+}
+
+// returned payload aliases the packet
+func ParsePacket(packet []byte) (payloadType byte, payload []byte, err error) {
+	if len(packet) < headerSize+trailerSize {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: got %d bytes", ErrTruncated, len(packet))
+	}
+
+	length := int(packet[0])
+	if length < headerSize+trailerSize {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: stated %d", ErrBadLength, length)
+	}
+	if length > len(packet) {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: stated %d, got %d bytes", ErrTruncated, length, len(packet))
+	}
+	if length < len(packet) {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: stated %d, got %d bytes", ErrBadLength, length, len(packet))
+	}
+
+	body := packet[:length-trailerSize]
+	want := binary.BigEndian.Uint16(packet[length-trailerSize:])
+	if got := CRC16(body); got != want {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: stated 0x%04X, computed 0x%04X", ErrBadCRC, want, got)
+	}
+
+	payloadType = packet[1]
+	if payloadType >= payloadType_count {
+		return PayloadType_errorInternal, nil, fmt.Errorf("%w: 0x%02X", ErrUnknownType, payloadType)
+	}
+	return payloadType, body[headerSize:], nil
+}
+
+func FormatErrorPacket(while string, err error) []byte {
+	msg := fmt.Appendf(nil, "error while %s: %v", while, err.Error())
+	if len(msg) > MaxPayloadSize {
+		msg = msg[:MaxPayloadSize]
+	}
+	return NewPacket(PayloadType_error, msg)
+}
@@ -0,0 +1,236 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// the same bytes come out of crc16, newPacket and encodeFrame in the mobile main.js, a change
+// on either side breaks the link
+
+func TestCRC16(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		want uint16
+	}{
+		{nil, 0xFFFF},
+		{[]byte("123456789"), 0x29B1}, // the crc-16/ccitt-false check value
+		{[]byte{0x06, 0x0A, 0x12, 0x34}, 0x775E},
+	} {
+		if got := CRC16(tc.data); got != tc.want {
+			t.Errorf("CRC16(% X) = 0x%04X, want 0x%04X", tc.data, got, tc.want)
+		}
+	}
+}
+
+var packetVectors = []struct {
+	name        string
+	payloadType byte
+	payload     []byte
+	packet      []byte
+	frame       []byte
+}{
+	{
+		name:        "heartbeat",
+		payloadType: PayloadType_heartbeat,
+		payload:     []byte{0x12, 0x34},
+		packet:      []byte{0x06, 0x0A, 0x12, 0x34, 0x77, 0x5E},
+		frame:       []byte{0x07, 0x06, 0x0A, 0x12, 0x34, 0x77, 0x5E, 0x00},
+	},
+	{
+		name:        "altSet 120.5m",
+		payloadType: PayloadType_altSet,
+		payload:     []byte{0x00, 0x07, 0x42, 0xF1, 0x00, 0x00},
+		packet:      []byte{0x0A, 0x04, 0x00, 0x07, 0x42, 0xF1, 0x00, 0x00, 0x51, 0xC6},
+		frame:       []byte{0x03, 0x0A, 0x04, 0x04, 0x07, 0x42, 0xF1, 0x01, 0x03, 0x51, 0xC6, 0x00},
+	},
+	{
+		name:        "ack out of range",
+		payloadType: PayloadType_ack,
+		payload:     []byte{0xBE, 0xEF, AckReason_outOfRange},
+		packet:      []byte{0x07, 0x09, 0xBE, 0xEF, 0x02, 0x40, 0x9F},
+		frame:       []byte{0x08, 0x07, 0x09, 0xBE, 0xEF, 0x02, 0x40, 0x9F, 0x00},
+	},
+}
+
+func TestPacketVectors(t *testing.T) {
+	for _, tc := range packetVectors {
+		t.Run(tc.name, func(t *testing.T) {
+			packet := NewPacket(tc.payloadType, tc.payload)
+			if !bytes.Equal(packet, tc.packet) {
+				t.Fatalf("NewPacket = % X, want % X", packet, tc.packet)
+			}
+			frame := EncodeFrame(packet)
+			if !bytes.Equal(frame, tc.frame) {
+				t.Fatalf("EncodeFrame = % X, want % X", frame, tc.frame)
+			}
+
+			decoded, err := DecodeFrame(tc.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payloadType, payload, err := ParsePacket(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payloadType != tc.payloadType || !bytes.Equal(payload, tc.payload) {
+				t.Errorf("ParsePacket = %d % X, want %d % X", payloadType, payload, tc.payloadType, tc.payload)
+			}
+		})
+	}
+}
+
+func TestCOBS(t *testing.T) {
+	run := func(from, to byte) []byte {
+		var b []byte
+		for i := int(from); i <= int(to); i++ {
+			b = append(b, byte(i))
+		}
+		return b
+	}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	for _, tc := range []struct {
+		name          string
+		packet, frame []byte
+	}{
+		{"zero", []byte{0x00}, []byte{0x01, 0x01, 0x00}},
+		{"two zeros", []byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01, 0x00}},
+		{"zero inside", []byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33, 0x00}},
+		{"no zeros", []byte{0x11, 0x22, 0x33, 0x44}, []byte{0x05, 0x11, 0x22, 0x33, 0x44, 0x00}},
+		{"trailing zeros", []byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01, 0x00}},
+		// a full block at the very end is followed by an empty one, a byte more than the
+		// shortest encoding but what main.js sends too
+		{"254 non zero", run(0x01, 0xFE), cat([]byte{0xFF}, run(0x01, 0xFE), []byte{0x01, 0x00})},
+		{"255 from zero", run(0x00, 0xFE), cat([]byte{0x01, 0xFF}, run(0x01, 0xFE), []byte{0x01, 0x00})},
+		{"255 non zero", run(0x01, 0xFF), cat([]byte{0xFF}, run(0x01, 0xFE), []byte{0x02, 0xFF, 0x00})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if frame := EncodeFrame(tc.packet); !bytes.Equal(frame, tc.frame) {
+				t.Errorf("EncodeFrame = % X, want % X", frame, tc.frame)
+			}
+			packet, err := DecodeFrame(tc.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(packet, tc.packet) {
+				t.Errorf("DecodeFrame = % X, want % X", packet, tc.packet)
+			}
+		})
+	}
+}
+
+// other encoders leave the empty block out, that decodes the same
+func TestCOBSShortest(t *testing.T) {
+	var packet []byte
+	for i := 1; i <= 0xFE; i++ {
+		packet = append(packet, byte(i))
+	}
+	frame := append(append([]byte{0xFF}, packet...), 0x00)
+	decoded, err := DecodeFrame(frame)
+	if err != nil || !bytes.Equal(decoded, packet) {
+		t.Errorf("DecodeFrame = % X, %v", decoded, err)
+	}
+}
+
+func TestBadFrames(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"no delimiter", []byte{0x03, 0x11, 0x22}},
+		{"only delimiter", []byte{0x00}},
+		{"zero inside", []byte{0x03, 0x11, 0x00, 0x22, 0x00}},
+		{"block overruns", []byte{0x05, 0x11, 0x22, 0x00}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeFrame(tc.frame); !errors.Is(err, ErrBadFrame) {
+				t.Errorf("DecodeFrame(% X) = %v, want ErrBadFrame", tc.frame, err)
+			}
+		})
+	}
+}
+
+func TestBadPackets(t *testing.T) {
+	good := packetVectors[0].packet
+	corrupt := func(i int, b byte) []byte {
+		p := bytes.Clone(good)
+		p[i] = b
+		return p
+	}
+	// a well formed packet of a type from a newer ground station
+	unknown := []byte{0x04, payloadType_count}
+	crc := CRC16(unknown)
+	unknown = append(unknown, byte(crc>>8), byte(crc))
+
+	for _, tc := range []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"header only", good[:2], ErrTruncated},
+		{"cut short", good[:len(good)-1], ErrTruncated},
+		{"length too small", corrupt(0, 3), ErrBadLength},
+		{"trailing bytes", append(bytes.Clone(good), 0x00), ErrBadLength},
+		{"payload bit flip", corrupt(2, good[2]^0x01), ErrBadCRC},
+		{"crc bit flip", corrupt(len(good)-1, good[len(good)-1]^0x80), ErrBadCRC},
+		{"type changed", corrupt(1, PayloadType_ack), ErrBadCRC},
+		{"unknown type", unknown, ErrUnknownType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			payloadType, _, err := ParsePacket(tc.packet)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("ParsePacket(% X) = %v, want %v", tc.packet, err, tc.want)
+			}
+			if payloadType != PayloadType_errorInternal {
+				t.Errorf("payload type %d, want errorInternal", payloadType)
+			}
+		})
+	}
+}
+
+func TestFrameDecoder(t *testing.T) {
+	// garbage, a repeated delimiter, two good frames and a broken one, all in one stream
+	var stream []byte
+	stream = append(stream, 0x42, 0x17, 0x00, 0x00)
+	stream = append(stream, packetVectors[0].frame...)
+	stream = append(stream, packetVectors[2].frame...)
+	stream = append(stream, 0x05, 0x11, 0x00)
+
+	d := NewFrameDecoder()
+	var packets [][]byte
+	var errs int
+	for _, b := range stream {
+		packet, err := d.Feed(b)
+		if err != nil {
+			errs++
+		}
+		if packet != nil {
+			packets = append(packets, packet)
+		}
+	}
+	if len(packets) != 2 || !bytes.Equal(packets[0], packetVectors[0].packet) || !bytes.Equal(packets[1], packetVectors[2].packet) {
+		t.Errorf("decoded % X", packets)
+	}
+	if errs != 2 {
+		t.Errorf("%d errors, want 2 for the garbage and the broken frame", errs)
+	}
+
+	long := bytes.Repeat([]byte{0x01}, MaxFrameSize+1)
+	for _, b := range long {
+		d.Feed(b)
+	}
+	if _, err := d.Feed(0x00); !errors.Is(err, ErrFrameTooLong) {
+		t.Errorf("overlong frame: %v, want ErrFrameTooLong", err)
+	}
+	packet, err := d.Feed(packetVectors[1].frame[0])
+	for _, b := range packetVectors[1].frame[1:] {
+		packet, err = d.Feed(b)
+	}
+	if err != nil || !bytes.Equal(packet, packetVectors[1].packet) {
+		t.Errorf("after an overlong frame: % X %v", packet, err)
+	}
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import "time"
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 2 * time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// commands waiting for an ack, resent with exponential backoff
+// not safe for concurrent use
+type RetryQueue struct {
+	MaxAttempts                int
+	InitialBackoff, MaxBackoff time.Duration
+
+	pending []pendingCommand
+}
+
+type pendingCommand struct {
+	seq      uint16
+	frame    []byte
+	attempts int
+	backoff  time.Duration
+	next     time.Time
+}
+
+func NewRetryQueue() *RetryQueue {
+	return &RetryQueue{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// queues a framed command, due immediately
+// pushing a sequence number that is already queued replaces it
+func (q *RetryQueue) Push(seq uint16, frame []byte, now time.Time) {
+	q.Ack(seq)
+	q.pending = append(q.pending, pendingCommand{
+		seq:     seq,
+		frame:   frame,
+		backoff: q.InitialBackoff,
+		next:    now,
+	})
+}
+
+// returns the oldest command that is due for (re)sending and schedules its next attempt
+func (q *RetryQueue) Next(now time.Time) (seq uint16, frame []byte, ok bool) {
+	for i := range q.pending {
+		c := &q.pending[i]
+		if c.attempts >= q.MaxAttempts || now.Before(c.next) {
+			continue
+		}
+		c.attempts++
+		c.next = now.Add(c.backoff)
+		c.backoff = min(c.backoff*2, q.MaxBackoff)
+		return c.seq, c.frame, true
+	}
+	return 0, nil, false
+}
+
+// removes an answered command, reports whether it was still queued
+func (q *RetryQueue) Ack(seq uint16) bool {
+	for i := range q.pending {
+		if q.pending[i].seq == seq {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// drops and returns every command whose last attempt went unanswered
+func (q *RetryQueue) Expire(now time.Time) (gaveUp []uint16) {
+	kept := q.pending[:0]
+	for _, c := range q.pending {
+		if c.attempts >= q.MaxAttempts && !now.Before(c.next) {
+			gaveUp = append(gaveUp, c.seq)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	q.pending = kept
+	return gaveUp
+}
+
+func (q *RetryQueue) Len() int {
+	return len(q.pending)
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	start := time.Unix(0, 0)
+	at := func(s float64) time.Time { return start.Add(time.Duration(s * float64(time.Second))) }
+	q := &RetryQueue{MaxAttempts: 6, InitialBackoff: 2 * time.Second, MaxBackoff: 10 * time.Second}
+	q.Push(7, []byte{0x07}, start)
+
+	// doubling from 2s up to the 10s cap
+	for i, due := range []float64{0, 2, 6, 14, 24, 34} {
+		if i > 0 {
+			if _, _, ok := q.Next(at(due - 0.1)); ok {
+				t.Fatalf("attempt %d sent before %vs", i+1, due)
+			}
+		}
+		if seq, frame, ok := q.Next(at(due)); !ok || seq != 7 || !bytes.Equal(frame, []byte{0x07}) {
+			t.Fatalf("attempt %d at %vs = %d % X %v", i+1, due, seq, frame, ok)
+		}
+	}
+	if _, _, ok := q.Next(at(100)); ok {
+		t.Error("sent a seventh attempt")
+	}
+
+	// the last attempt gets its backoff to be answered before it's given up
+	if gaveUp := q.Expire(at(43.9)); len(gaveUp) != 0 || q.Len() != 1 {
+		t.Errorf("gave up %v while the last attempt could still be acked", gaveUp)
+	}
+	if gaveUp := q.Expire(at(44)); !slices.Equal(gaveUp, []uint16{7}) || q.Len() != 0 {
+		t.Errorf("gave up %v, %d left, want [7] and none", gaveUp, q.Len())
+	}
+}
+
+func TestRetryReplace(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := NewRetryQueue()
+	q.Push(1, []byte("first"), now)
+	q.Next(now)
+	q.Next(now.Add(DefaultInitialBackoff))
+
+	// the same seq again starts over with the new frame, due at once
+	q.Push(1, []byte("second"), now.Add(time.Second+DefaultInitialBackoff))
+	if q.Len() != 1 {
+		t.Fatalf("%d queued, want 1", q.Len())
+	}
+	later := now.Add(time.Second + DefaultInitialBackoff)
+	if _, frame, ok := q.Next(later); !ok || string(frame) != "second" {
+		t.Fatalf("Next = %q %v, want the replacement", frame, ok)
+	}
+	if _, _, ok := q.Next(later.Add(DefaultInitialBackoff)); !ok {
+		t.Error("backoff not reset by the replacement")
+	}
+}
+
+func TestRetryAck(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := NewRetryQueue()
+	q.Push(1, []byte{1}, now)
+	q.Push(2, []byte{2}, now)
+	q.Push(3, []byte{3}, now)
+
+	// oldest first
+	if seq, _, _ := q.Next(now); seq != 1 {
+		t.Errorf("sent %d first, want 1", seq)
+	}
+	if !q.Ack(2) || q.Ack(2) {
+		t.Error("Ack(2) should report queued once")
+	}
+	if q.Ack(9) {
+		t.Error("acked a seq that was never queued")
+	}
+	if seq, _, _ := q.Next(now); seq != 3 {
+		t.Errorf("sent %d after acking 2, want 3", seq)
+	}
+	if _, _, ok := q.Next(now); ok {
+		t.Error("sent again before the backoff")
+	}
+	q.Ack(1)
+	q.Ack(3)
+	if q.Len() != 0 {
+		t.Errorf("%d left after acking everything", q.Len())
+	}
+}
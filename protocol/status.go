@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	Status_none = iota
+	Status_idle
+	Status_readyForTakeoff
+	Status_flying
+	Status_circling
+	Status_landing
+	Status_returning
+	Status_manual
+)
+
+// bits of PlaneStatus.Failsafe
+const (
+	FailsafeFlag_linkLost byte = 1 << iota
+	FailsafeFlag_geofence      // outside the geofence
+	FailsafeFlag_sensors       // the navigation filter distrusts a sensor
+)
+
+type PlaneStatus struct {
+	Status   byte    // 1 byte
+	Battery  float32 // 4 bytes, here it's a float32 [0..100], but compressed, it's an uint32 [0..2^32]
+	Speed    float32 // 4 bytes
+	Altitude float32 // 4 bytes, meters, barometric once the plane has been armed
+
+	Latitude, Longitude float64 // 16 bytes
+
+	Failsafe byte // 1 byte, FailsafeFlag_* bits
+
+	MissionItem byte // 1 byte, index of the mission item being flown or MissionItem_none
+	// total: 31 bytes
+}
+type PlaneStatusCompressed [31]byte
+
+func (p PlaneStatus) ToBytes() PlaneStatusCompressed {
+	var buf PlaneStatusCompressed
+	buf[0] = p.Status
+	binary.BigEndian.PutUint32(buf[1:5], percentageToUint32(p.Battery))
+	binary.BigEndian.PutUint32(buf[5:9], math.Float32bits(p.Speed))
+	binary.BigEndian.PutUint32(buf[9:13], math.Float32bits(p.Altitude))
+	binary.BigEndian.PutUint64(buf[13:21], math.Float64bits(p.Latitude))
+	binary.BigEndian.PutUint64(buf[21:29], math.Float64bits(p.Longitude))
+	buf[29] = p.Failsafe
+	buf[30] = p.MissionItem
+	return buf
+}
+
+func PlaneStatusFromBytes(buf PlaneStatusCompressed) PlaneStatus {
+	return PlaneStatus{
+		Status:      buf[0],
+		Battery:     percentageFromUint32(binary.BigEndian.Uint32(buf[1:5])),
+		Speed:       math.Float32frombits(binary.BigEndian.Uint32(buf[5:9])),
+		Altitude:    math.Float32frombits(binary.BigEndian.Uint32(buf[9:13])),
+		Latitude:    math.Float64frombits(binary.BigEndian.Uint64(buf[13:21])),
+		Longitude:   math.Float64frombits(binary.BigEndian.Uint64(buf[21:29])),
+		Failsafe:    buf[29],
+		MissionItem: buf[30],
+	}
+}
+
+func percentageToUint32(f float32) uint32 {
+	// clamp [0..100]
+	f = min(max(f, 0), 100)
+	return uint32(float64(f/100) * math.MaxUint32)
+}
+
+func percentageFromUint32(u uint32) float32 {
+	return float32((float64(u) / math.MaxUint32) * 100)
+}
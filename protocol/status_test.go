@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the offsets the pico forwards and decodeStatus in the mobile main.js reads, big endian
+func TestStatusLayout(t *testing.T) {
+	status := PlaneStatus{
+		Status:      Status_flying,
+		Battery:     100,
+		Speed:       18.5,
+		Altitude:    120.5,
+		Latitude:    48.5,
+		Longitude:   -122.25,
+		Failsafe:    FailsafeFlag_linkLost | FailsafeFlag_sensors,
+		MissionItem: 4,
+	}
+	buf := status.ToBytes()
+	if len(buf) != 31 {
+		t.Fatalf("%d bytes, want 31", len(buf))
+	}
+
+	for _, tc := range []struct {
+		field  string
+		offset int
+		want   []byte
+	}{
+		{"status", 0, []byte{Status_flying}},
+		{"battery", 1, []byte{0xFF, 0xFF, 0xFF, 0xFF}},
+		{"speed", 5, []byte{0x41, 0x94, 0x00, 0x00}},
+		{"altitude", 9, []byte{0x42, 0xF1, 0x00, 0x00}},
+		{"latitude", 13, []byte{0x40, 0x48, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"longitude", 21, []byte{0xC0, 0x5E, 0x90, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"failsafe", 29, []byte{0x05}},
+		{"mission item", 30, []byte{0x04}},
+	} {
+		if got := buf[tc.offset : tc.offset+len(tc.want)]; !bytes.Equal(got, tc.want) {
+			t.Errorf("%s at %d = % X, want % X", tc.field, tc.offset, got, tc.want)
+		}
+	}
+
+	if got := PlaneStatusFromBytes(buf); got != status {
+		t.Errorf("decoded %+v, want %+v", got, status)
+	}
+}
+
+func TestStatusBattery(t *testing.T) {
+	for _, tc := range []struct {
+		battery, want float32
+	}{
+		{0, 0},
+		{100, 100},
+		{-5, 0},
+		{150, 100},
+	} {
+		buf := PlaneStatus{Battery: tc.battery}.ToBytes()
+		if got := PlaneStatusFromBytes(buf).Battery; got != tc.want {
+			t.Errorf("battery %v came back %v, want %v", tc.battery, got, tc.want)
+		}
+	}
+}
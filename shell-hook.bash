@@ -91,6 +91,7 @@ alias pico_term='sudo picocom -b 115200 /dev/ttyACM0'
 
 mod_build_mode_on() {
     # comments out the necessary lines from go.mod (breaks gopls but fixes tinygo)
+    # the shared protocol module is a real sibling module and is left alone
     awk '
     BEGIN { in_replace = 0 }
     /^[[:space:]]*replace \(/ {
@@ -98,6 +99,10 @@ mod_build_mode_on() {
         print
         next
     }
+    $1 == "protocol" {
+        print
+        next
+    }
     in_replace {
         if (/^[[:space:]]*\)/) {
             in_replace = 0
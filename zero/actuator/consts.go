@@ -0,0 +1,46 @@
+package actuator
+
+import "time"
+
+const (
+	PCA9685_Address = 0x40
+
+	pca9685OscHz   = 25_000_000
+	pca9685Steps   = 4096
+	pca9685Outputs = 16
+)
+
+// registers
+const (
+	regMode1     = 0x00
+	regLed0OnL   = 0x06 // each channel has 4 registers: on l/h, off l/h
+	regPrescale  = 0xFE
+	regAllLedOnL = 0xFA
+)
+
+// mode1 bits
+const (
+	mode1Restart = 1 << 7
+	mode1AutoInc = 1 << 5
+	mode1Sleep   = 1 << 4
+)
+
+type Mixer byte
+
+const (
+	// aileron, elevator, rudder
+	MixConventional Mixer = iota
+	// left elevon, right elevon, rudder
+	MixElevon
+	// aileron, left ruddervator, right ruddervator
+	MixVTail
+)
+
+// standard rc servo / esc pulses
+const (
+	DefaultMinPulse    = 1000 * time.Microsecond
+	DefaultCenterPulse = 1500 * time.Microsecond
+	DefaultMaxPulse    = 2000 * time.Microsecond
+
+	DefaultFrequency = 50 // Hz
+)
@@ -0,0 +1,30 @@
+package actuator
+
+import (
+	"sync"
+	"time"
+)
+
+// in memory backend that records the last pulse of every channel, for tests and the simulator
+type Fake struct {
+	mu     sync.Mutex
+	pulses map[int]time.Duration
+}
+
+func NewFake() *Fake {
+	return &Fake{pulses: make(map[int]time.Duration)}
+}
+
+func (f *Fake) SetPulse(channel int, pulse time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pulses[channel] = pulse
+	return nil
+}
+
+// zero if the channel was never set
+func (f *Fake) Pulse(channel int) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pulses[channel]
+}
@@ -0,0 +1,140 @@
+package actuator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// anything that can produce servo pulses
+type Backend interface {
+	SetPulse(channel int, pulse time.Duration) error
+}
+
+type Channel struct {
+	Output int // backend channel
+
+	// endpoint limits, pulses never leave [Min..Max]
+	Min, Center, Max time.Duration
+	Trim             time.Duration
+	Reversed         bool
+}
+
+type Config struct {
+	Mixer    Mixer
+	Surfaces [3]Channel // in the order documented on the mixer
+	Throttle Channel    // Center is not used, [0..1] maps onto Min..Max
+}
+
+type Actuators struct {
+	mu      sync.Mutex
+	backend Backend
+	config  Config
+}
+
+func New(backend Backend, config Config) (*Actuators, error) {
+	if backend == nil {
+		return nil, errors.New("no backend")
+	}
+	if config.Mixer > MixVTail {
+		return nil, fmt.Errorf("unknown mixer %d", config.Mixer)
+	}
+	for i, c := range config.Surfaces {
+		if err := c.validate(true); err != nil {
+			return nil, fmt.Errorf("surface %d: %w", i, err)
+		}
+	}
+	if err := config.Throttle.validate(false); err != nil {
+		return nil, fmt.Errorf("throttle: %w", err)
+	}
+	return &Actuators{backend: backend, config: config}, nil
+}
+
+func DefaultChannel(output int) Channel {
+	return Channel{
+		Output: output,
+		Min:    DefaultMinPulse,
+		Center: DefaultCenterPulse,
+		Max:    DefaultMaxPulse,
+	}
+}
+
+func (c Channel) validate(centered bool) error {
+	if c.Min <= 0 || c.Min >= c.Max {
+		return fmt.Errorf("bad endpoints %v..%v", c.Min, c.Max)
+	}
+	if centered {
+		center := c.Center + c.Trim
+		if center <= c.Min || center >= c.Max {
+			return fmt.Errorf("trimmed center %v outside of %v..%v", center, c.Min, c.Max)
+		}
+	}
+	return nil
+}
+
+// value is [-1..1], clamped
+func (c Channel) Pulse(value float32) time.Duration {
+	value = max(-1, min(value, 1))
+	if c.Reversed {
+		value = -value
+	}
+	center := c.Center + c.Trim
+	var pulse time.Duration
+	if value >= 0 {
+		pulse = center + time.Duration(value*float32(c.Max-center))
+	} else {
+		pulse = center + time.Duration(value*float32(center-c.Min))
+	}
+	return max(c.Min, min(pulse, c.Max))
+}
+
+// value is [0..1], clamped
+func (c Channel) ThrottlePulse(value float32) time.Duration {
+	value = max(0, min(value, 1))
+	if c.Reversed {
+		value = 1 - value
+	}
+	return c.Min + time.Duration(value*float32(c.Max-c.Min))
+}
+
+// turns roll, pitch and yaw demands [-1..1] into surface deflections
+// positive roll is right wing down, positive pitch is nose up, positive yaw is nose right
+func (m Mixer) Mix(roll, pitch, yaw float32) [3]float32 {
+	clamp := func(v float32) float32 { return max(-1, min(v, 1)) }
+	switch m {
+	case MixElevon:
+		return [3]float32{clamp(pitch + roll), clamp(pitch - roll), clamp(yaw)}
+	case MixVTail:
+		return [3]float32{clamp(roll), clamp(pitch + yaw), clamp(pitch - yaw)}
+	}
+	return [3]float32{clamp(roll), clamp(pitch), clamp(yaw)}
+}
+
+func (a *Actuators) SetAttitude(roll, pitch, yaw float32) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, deflection := range a.config.Mixer.Mix(roll, pitch, yaw) {
+		c := a.config.Surfaces[i]
+		if err := a.backend.SetPulse(c.Output, c.Pulse(deflection)); err != nil {
+			return fmt.Errorf("surface %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// throttle is [0..1]
+func (a *Actuators) SetThrottle(throttle float32) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.config.Throttle
+	return a.backend.SetPulse(c.Output, c.ThrottlePulse(throttle))
+}
+
+// centers every surface and cuts the throttle
+func (a *Actuators) Neutral() error {
+	if err := a.SetThrottle(0); err != nil {
+		return err
+	}
+	return a.SetAttitude(0, 0, 0)
+}
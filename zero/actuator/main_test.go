@@ -0,0 +1,180 @@
+package actuator
+
+import (
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+const us = time.Microsecond
+
+func newTestActuators(t *testing.T, mixer Mixer) (*Actuators, *Fake) {
+	t.Helper()
+	fake := NewFake()
+	a, err := New(fake, Config{
+		Mixer:    mixer,
+		Surfaces: [3]Channel{DefaultChannel(0), DefaultChannel(1), DefaultChannel(2)},
+		Throttle: DefaultChannel(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, fake
+}
+
+func TestSetAttitude(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		mixer            Mixer
+		roll, pitch, yaw float32
+		want             [3]time.Duration
+	}{
+		{"neutral", MixConventional, 0, 0, 0, [3]time.Duration{1500 * us, 1500 * us, 1500 * us}},
+		{"full right roll", MixConventional, 1, 0, 0, [3]time.Duration{2000 * us, 1500 * us, 1500 * us}},
+		{"half nose down", MixConventional, 0, -0.5, 0, [3]time.Duration{1500 * us, 1250 * us, 1500 * us}},
+		{"full left yaw", MixConventional, 0, 0, -1, [3]time.Duration{1500 * us, 1500 * us, 1000 * us}},
+		{"clamped above 1", MixConventional, 1.5, 3, 10, [3]time.Duration{2000 * us, 2000 * us, 2000 * us}},
+		{"clamped below -1", MixConventional, -1.5, -3, -10, [3]time.Duration{1000 * us, 1000 * us, 1000 * us}},
+		{"elevon roll", MixElevon, 0.5, 0, 0, [3]time.Duration{1750 * us, 1250 * us, 1500 * us}},
+		{"elevon pitch", MixElevon, 0, 0.5, 0, [3]time.Duration{1750 * us, 1750 * us, 1500 * us}},
+		{"elevon clamped mix", MixElevon, 0.8, 0.8, 0, [3]time.Duration{2000 * us, 1500 * us, 1500 * us}},
+		{"vtail yaw", MixVTail, 0, 0, 0.5, [3]time.Duration{1500 * us, 1750 * us, 1250 * us}},
+		{"vtail pitch and yaw clamped", MixVTail, 0, -1, -1, [3]time.Duration{1500 * us, 1000 * us, 1500 * us}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, fake := newTestActuators(t, tc.mixer)
+			if err := a.SetAttitude(tc.roll, tc.pitch, tc.yaw); err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tc.want {
+				if got := fake.Pulse(i); got != want {
+					t.Errorf("channel %d pulse %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetThrottle(t *testing.T) {
+	a, fake := newTestActuators(t, MixConventional)
+	for _, tc := range []struct {
+		throttle float32
+		want     time.Duration
+	}{
+		{0, 1000 * us},
+		{0.25, 1250 * us},
+		{1, 2000 * us},
+		{-0.5, 1000 * us},
+		{2, 2000 * us},
+	} {
+		if err := a.SetThrottle(tc.throttle); err != nil {
+			t.Fatal(err)
+		}
+		if got := fake.Pulse(3); got != tc.want {
+			t.Errorf("throttle %v pulse %v, want %v", tc.throttle, got, tc.want)
+		}
+	}
+}
+
+func TestChannelPulse(t *testing.T) {
+	asymmetric := Channel{Min: 900 * us, Center: 1400 * us, Max: 2100 * us}
+	trimmed := DefaultChannel(0)
+	trimmed.Trim = 100 * us
+	reversed := DefaultChannel(0)
+	reversed.Reversed = true
+
+	for _, tc := range []struct {
+		name    string
+		channel Channel
+		value   float32
+		want    time.Duration
+	}{
+		{"asymmetric up", asymmetric, 1, 2100 * us},
+		{"asymmetric half up", asymmetric, 0.5, 1750 * us},
+		{"asymmetric half down", asymmetric, -0.5, 1150 * us},
+		{"trimmed center", trimmed, 0, 1600 * us},
+		{"trimmed full up stays at the endpoint", trimmed, 1, 2000 * us},
+		{"trimmed full down", trimmed, -1, 1000 * us},
+		{"reversed", reversed, 0.5, 1250 * us},
+		{"reversed clamped", reversed, -2, 2000 * us},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.channel.Pulse(tc.value); got != tc.want {
+				t.Errorf("pulse %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// the pulses as they land in the PCA9685 registers at 50Hz, prescale 121 makes a period of
+// 19.988ms so one step is about 4.88us
+func TestPCA9685SetPulse(t *testing.T) {
+	bus := &i2ctest.Record{}
+	p := &PCA9685{dev: i2c.Dev{Bus: bus, Addr: PCA9685_Address}}
+	if err := p.Init(DefaultFrequency); err != nil {
+		t.Fatal(err)
+	}
+	if prescale := bus.Ops[1].W; prescale[0] != regPrescale || prescale[1] != 121 {
+		t.Fatalf("prescale write % X", prescale)
+	}
+
+	for _, tc := range []struct {
+		channel int
+		pulse   time.Duration
+		off     int
+	}{
+		{0, 1000 * us, 204},
+		{1, 1500 * us, 307},
+		{2, 2000 * us, 409},
+		{15, 0, 0},
+		{3, time.Second, 4095}, // past the period is always on
+	} {
+		bus.Ops = nil
+		if err := p.SetPulse(tc.channel, tc.pulse); err != nil {
+			t.Fatal(err)
+		}
+		want := []byte{byte(regLed0OnL + 4*tc.channel), 0, 0, byte(tc.off), byte(tc.off >> 8)}
+		if len(bus.Ops) != 1 || string(bus.Ops[0].W) != string(want) {
+			t.Errorf("channel %d pulse %v wrote %v, want % X", tc.channel, tc.pulse, bus.Ops, want)
+		}
+	}
+
+	if err := p.SetPulse(pca9685Outputs, DefaultCenterPulse); err == nil {
+		t.Error("channel 16 accepted")
+	}
+}
+
+// roll, pitch, yaw and throttle all the way into the registers, clamped at full deflection
+func TestActuatorsOnPCA9685(t *testing.T) {
+	bus := &i2ctest.Record{}
+	p := &PCA9685{dev: i2c.Dev{Bus: bus, Addr: PCA9685_Address}}
+	if err := p.Init(DefaultFrequency); err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(p, Config{
+		Surfaces: [3]Channel{DefaultChannel(0), DefaultChannel(1), DefaultChannel(2)},
+		Throttle: DefaultChannel(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Ops = nil
+	if err := a.SetAttitude(2, -2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetThrottle(1.5); err != nil {
+		t.Fatal(err)
+	}
+	offs := map[byte]int{}
+	for _, op := range bus.Ops {
+		offs[op.W[0]] = int(op.W[3]) | int(op.W[4])<<8
+	}
+	for channel, want := range []int{409, 204, 307, 409} {
+		if got := offs[byte(regLed0OnL+4*channel)]; got != want {
+			t.Errorf("channel %d off at %d, want %d", channel, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package actuator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+)
+
+// 16 channel 12 bit pwm driver
+type PCA9685 struct {
+	dev    i2c.Dev
+	period time.Duration
+}
+
+// make sure to call host.Init() before calling this
+func NewPCA9685(busName string, freqHz float64) (*PCA9685, error) {
+	bus, err := i2creg.Open(busName)
+	if err != nil {
+		return nil, err
+	}
+	p := &PCA9685{
+		dev: i2c.Dev{
+			Bus:  bus,
+			Addr: PCA9685_Address,
+		},
+	}
+	if err := p.Init(freqHz); err != nil {
+		return nil, fmt.Errorf("failed to initialize PCA9685: %w", err)
+	}
+	return p, nil
+}
+
+func (p *PCA9685) Init(freqHz float64) error {
+	if freqHz < 24 || freqHz > 1526 {
+		return fmt.Errorf("frequency %vHz outside of 24..1526Hz", freqHz)
+	}
+	prescale := math.Round(pca9685OscHz/(pca9685Steps*freqHz)) - 1
+
+	// prescale can only be written while asleep
+	if err := p.writeReg(regMode1, mode1Sleep); err != nil {
+		return err
+	}
+	if err := p.writeReg(regPrescale, byte(prescale)); err != nil {
+		return err
+	}
+	if err := p.writeReg(regMode1, mode1AutoInc); err != nil {
+		return err
+	}
+	// oscillator needs 500us to come up
+	time.Sleep(time.Millisecond)
+	if err := p.writeReg(regMode1, mode1AutoInc|mode1Restart); err != nil {
+		return err
+	}
+
+	// the real period follows from the rounded prescale
+	p.period = time.Duration(float64(time.Second) * (prescale + 1) * pca9685Steps / pca9685OscHz)
+	return nil
+}
+
+func (p *PCA9685) SetPulse(channel int, pulse time.Duration) error {
+	if channel < 0 || channel >= pca9685Outputs {
+		return fmt.Errorf("channel %d out of range", channel)
+	}
+	if p.period == 0 {
+		return errors.New("PCA9685 not initialized")
+	}
+	off := int64(pulse) * pca9685Steps / int64(p.period)
+	off = min(max(off, 0), pca9685Steps-1)
+
+	reg := byte(regLed0OnL + 4*channel)
+	// on at 0, off after the pulse
+	return p.dev.Tx([]byte{reg, 0, 0, byte(off), byte(off >> 8)}, nil)
+}
+
+// turns every output fully off
+func (p *PCA9685) Off() error {
+	// bit 4 of ALL_LED_OFF_H forces everything off
+	return p.dev.Tx([]byte{regAllLedOnL, 0, 0, 0, 1 << 4}, nil)
+}
+
+func (p *PCA9685) writeReg(reg, value byte) error {
+	return p.dev.Tx([]byte{reg, value}, nil)
+}
@@ -0,0 +1,15 @@
+package altitude
+
+const (
+	// the states, indices into Estimate.Covariance
+	StateAltitude = iota
+	StateVerticalSpeed
+	StateBaroDrift
+	StateAccelBias
+	stateCount
+)
+
+const (
+	// a gap this long between predictions means the estimate is stale, start over
+	maxPredictGap = 1 // seconds
+)
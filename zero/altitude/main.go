@@ -0,0 +1,238 @@
+package altitude
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// kalman filter over altitude, vertical speed, the drift of the barometric altitude and the bias
+// of the vertical acceleration. the accelerometer drives the prediction, the barometer corrects
+// it quickly but wanders with the weather, the gps is noisy but stays put, so over time the
+// barometer's drift is measured against it
+
+type Config struct {
+	// standard deviation of the vertical acceleration, m/s^2
+	AccelNoise float64
+	// random walk of the accelerometer bias, m/s^2 per sqrt(s)
+	AccelBiasDrift float64
+	// standard deviation of one barometric altitude, m
+	BaroNoise float64
+	// random walk of the barometric altitude against the true one, m per sqrt(s)
+	BaroDrift float64
+	// standard deviation of one gps altitude, m
+	GPSNoise float64
+	// measurements further off the prediction than this many standard deviations are
+	// rejected, 0 takes everything
+	Gate float64
+
+	// standard deviations at a reset, m and m/s^2
+	InitialBaroDrift, InitialAccelBias float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AccelNoise:     0.5,
+		AccelBiasDrift: 0.005,
+		BaroNoise:      0.5,
+		BaroDrift:      0.05,
+		GPSNoise:       4,
+		Gate:           5,
+
+		InitialBaroDrift: 2,
+		InitialAccelBias: 0.2,
+	}
+}
+
+var ErrBadConfig = errors.New("altitude: noises must be positive and drifts and the gate not negative")
+
+type Estimate struct {
+	Altitude      float64 // m
+	VerticalSpeed float64 // m/s, up
+	// the barometric altitude minus the true one, m
+	BaroDrift float64
+	// the measured vertical acceleration minus the true one, m/s^2
+	AccelBias float64
+	// indexed by the State* constants
+	Covariance [stateCount][stateCount]float64
+}
+
+// standard deviations of the altitude and vertical speed
+func (e Estimate) AltitudeStdDev() float64 {
+	return math.Sqrt(e.Covariance[StateAltitude][StateAltitude])
+}
+
+func (e Estimate) VerticalSpeedStdDev() float64 {
+	return math.Sqrt(e.Covariance[StateVerticalSpeed][StateVerticalSpeed])
+}
+
+// how a measurement compared to the prediction
+type Innovation struct {
+	Value float64 // measured minus predicted, m
+	// in standard deviations of what was expected
+	Ratio    float64
+	Accepted bool
+}
+
+type matrix = [stateCount][stateCount]float64
+
+type Estimator struct {
+	config Config
+
+	x       [stateCount]float64
+	p       matrix
+	last    time.Time
+	started bool
+}
+
+func New(config Config) (*Estimator, error) {
+	if !(config.AccelNoise > 0 && config.BaroNoise > 0 && config.GPSNoise > 0) ||
+		config.AccelBiasDrift < 0 || config.BaroDrift < 0 || config.Gate < 0 ||
+		config.InitialBaroDrift < 0 || config.InitialAccelBias < 0 {
+		return nil, ErrBadConfig
+	}
+	return &Estimator{config: config}, nil
+}
+
+// starts over at an altitude known to within stdDev (m), level and with no drift or bias
+func (e *Estimator) Reset(alt, stdDev float64, now time.Time) {
+	e.x = [stateCount]float64{StateAltitude: alt}
+	e.p = matrix{}
+	e.p[StateAltitude][StateAltitude] = stdDev * stdDev
+	e.p[StateVerticalSpeed][StateVerticalSpeed] = 1
+	e.p[StateBaroDrift][StateBaroDrift] = e.config.InitialBaroDrift * e.config.InitialBaroDrift
+	e.p[StateAccelBias][StateAccelBias] = e.config.InitialAccelBias * e.config.InitialAccelBias
+	e.last = now
+	e.started = true
+}
+
+// false before the first Reset or after a gap in the predictions, Reset again then
+func (e *Estimator) Running(now time.Time) bool {
+	return e.started && now.Sub(e.last).Seconds() < maxPredictGap
+}
+
+// takes the barometer's current offset as its drift, for a barometer that jumped. the altitude
+// stays with the gps and the accelerometer
+func (e *Estimator) ResetBaroDrift(baroAlt float64) {
+	e.x[StateBaroDrift] = baroAlt - e.x[StateAltitude]
+	for i := range e.p {
+		e.p[i][StateBaroDrift], e.p[StateBaroDrift][i] = 0, 0
+	}
+	e.p[StateBaroDrift][StateBaroDrift] = e.config.InitialBaroDrift * e.config.InitialBaroDrift
+}
+
+// moves the estimate to now with the vertical acceleration (m/s^2, up, gravity removed)
+func (e *Estimator) Predict(verticalAccel float64, now time.Time) {
+	dt := now.Sub(e.last).Seconds()
+	e.last = now
+	if !e.started || dt <= 0 {
+		return
+	}
+
+	accel := verticalAccel - e.x[StateAccelBias]
+	e.x[StateAltitude] += e.x[StateVerticalSpeed]*dt + accel*dt*dt/2
+	e.x[StateVerticalSpeed] += accel * dt
+
+	// P = F P F' + Q
+	var f matrix
+	for i := range f {
+		f[i][i] = 1
+	}
+	f[StateAltitude][StateVerticalSpeed] = dt
+	f[StateAltitude][StateAccelBias] = -dt * dt / 2
+	f[StateVerticalSpeed][StateAccelBias] = -dt
+	e.p = multiply(multiply(f, e.p), transpose(f))
+
+	// acceleration noise enters through the same path as the acceleration
+	g := [stateCount]float64{StateAltitude: dt * dt / 2, StateVerticalSpeed: dt}
+	accelVar := e.config.AccelNoise * e.config.AccelNoise
+	for i := range g {
+		for j := range g {
+			e.p[i][j] += g[i] * g[j] * accelVar
+		}
+	}
+	e.p[StateBaroDrift][StateBaroDrift] += e.config.BaroDrift * e.config.BaroDrift * dt
+	e.p[StateAccelBias][StateAccelBias] += e.config.AccelBiasDrift * e.config.AccelBiasDrift * dt
+}
+
+// a barometric altitude, m
+func (e *Estimator) UpdateBaro(alt float64) Innovation {
+	var h [stateCount]float64
+	h[StateAltitude], h[StateBaroDrift] = 1, 1
+	return e.update(h, alt, e.config.BaroNoise)
+}
+
+// a gps altitude, m. only once per fix, the same fix twice counts as twice the certainty
+func (e *Estimator) UpdateGPS(alt float64) Innovation {
+	var h [stateCount]float64
+	h[StateAltitude] = 1
+	return e.update(h, alt, e.config.GPSNoise)
+}
+
+// one scalar measurement z = h x with standard deviation stdDev
+func (e *Estimator) update(h [stateCount]float64, z, stdDev float64) Innovation {
+	if !e.started {
+		return Innovation{}
+	}
+	var ph [stateCount]float64 // P h'
+	for i := range ph {
+		for j := range h {
+			ph[i] += e.p[i][j] * h[j]
+		}
+	}
+	s := stdDev * stdDev // h P h' + R
+	predicted := 0.0
+	for i := range h {
+		s += h[i] * ph[i]
+		predicted += h[i] * e.x[i]
+	}
+	in := Innovation{Value: z - predicted}
+	in.Ratio = math.Abs(in.Value) / math.Sqrt(s)
+	if e.config.Gate > 0 && in.Ratio > e.config.Gate {
+		return in
+	}
+	in.Accepted = true
+
+	// x += K y, P -= K h P with K = P h' / s
+	for i := range e.x {
+		e.x[i] += ph[i] / s * in.Value
+	}
+	for i := range e.p {
+		for j := range e.p[i] {
+			e.p[i][j] -= ph[i] * ph[j] / s
+		}
+	}
+	return in
+}
+
+func (e *Estimator) Estimate() Estimate {
+	return Estimate{
+		Altitude:      e.x[StateAltitude],
+		VerticalSpeed: e.x[StateVerticalSpeed],
+		BaroDrift:     e.x[StateBaroDrift],
+		AccelBias:     e.x[StateAccelBias],
+		Covariance:    e.p,
+	}
+}
+
+func multiply(a, b matrix) matrix {
+	var m matrix
+	for i := range a {
+		for j := range b[0] {
+			for k := range b {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func transpose(a matrix) matrix {
+	var m matrix
+	for i := range a {
+		for j := range a[i] {
+			m[j][i] = a[i][j]
+		}
+	}
+	return m
+}
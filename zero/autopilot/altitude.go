@@ -0,0 +1,109 @@
+package autopilot
+
+import (
+	"log"
+	"time"
+	"zero/flightmode"
+)
+
+// the altitude everything flies by. on the ground the flight loop keeps a smoothed pressure and
+// gps altitude, arming takes them as the ground reference, so in the air the altitude is the
+// field elevation from the gps plus the barometric height above it. a qnh from the ground puts
+// the barometer on its own. without a barometer, or before arming, it's the gps altitude.
+// in the air the navigation filter fuses both with the accelerometer, see navigation.go
+
+// the flight loop's idle step, keeps the ground reference fresh
+func (a *Autopilot) smoothGround(gpsAlt float64, now time.Time) {
+	pressure, ok := a.readPressure(now)
+	if !ok {
+		return
+	}
+	a.baroMu.Lock()
+	defer a.baroMu.Unlock()
+	if a.groundPressure == 0 {
+		a.groundPressure = pressure
+	}
+	a.groundPressure += (pressure - a.groundPressure) * groundPressureSmoothing
+	if !a.haveGroundAlt {
+		a.groundAlt, a.haveGroundAlt = gpsAlt, true
+	}
+	a.groundAlt += (gpsAlt - a.groundAlt) * groundAltSmoothing
+}
+
+// OnEnter hook for armed
+func (a *Autopilot) captureGround(flightmode.Transition) {
+	a.baroMu.Lock()
+	defer a.baroMu.Unlock()
+	if a.groundPressure == 0 || !a.haveGroundAlt {
+		log.Println("no barometer ground reference, flying by the gps altitude")
+		return
+	}
+	a.altimeter.SetGround(a.groundPressure, a.groundAlt)
+	log.Printf("barometer ground reference %.0fPa at %.1fm\n", a.groundPressure, a.groundAlt)
+}
+
+// pascals, 0 clears it. home moves along with the ground so heights above it stay right
+func (a *Autopilot) setQNH(qnh float64) {
+	a.baroMu.Lock()
+	before, grounded := a.groundAltitude()
+	a.altimeter.SetQNH(qnh)
+	after, _ := a.groundAltitude()
+	a.baroMu.Unlock()
+
+	if grounded {
+		a.targetMu.Lock()
+		if a.homeSet {
+			a.homeAlt += after - before
+		}
+		a.targetMu.Unlock()
+		log.Printf("qnh %.0fPa, the field is at %.1fm\n", qnh, after)
+	}
+}
+
+// the altitude of the ground reference, baroMu must be held
+func (a *Autopilot) groundAltitude() (alt float64, ok bool) {
+	pressure, _, ok := a.altimeter.Ground()
+	if !ok {
+		return 0, false
+	}
+	return a.altimeter.Altitude(pressure)
+}
+
+// the barometric altitude, or gpsAlt without one
+func (a *Autopilot) readAltitude(gpsAlt float64, now time.Time) float64 {
+	if alt, ok := a.baroAltitude(now); ok {
+		return alt
+	}
+	return gpsAlt
+}
+
+// ok is false without a barometer, a reading or a reference for it
+func (a *Autopilot) baroAltitude(now time.Time) (alt float64, ok bool) {
+	pressure, ok := a.readPressure(now)
+	if !ok {
+		return 0, false
+	}
+	a.baroMu.Lock()
+	defer a.baroMu.Unlock()
+	return a.altimeter.Altitude(pressure)
+}
+
+// a read is two transactions on the bus and the flight loop runs far more often than the
+// barometer measures, so within baroInterval of the last read its pressure is handed out again
+func (a *Autopilot) readPressure(now time.Time) (pressure float64, ok bool) {
+	if a.hw.Barometer == nil {
+		return 0, false
+	}
+	if !a.lastBaroRead.IsZero() && now.Sub(a.lastBaroRead) < baroInterval {
+		return a.lastPressure, a.havePressure
+	}
+	a.lastBaroRead = now
+	pressure, err := a.hw.Barometer.ReadPressure()
+	if err != nil {
+		log.Printf("flightLoop: barometer read error: %v", err)
+		a.havePressure = false
+		return 0, false
+	}
+	a.lastPressure, a.havePressure = pressure, true
+	return pressure, true
+}
@@ -0,0 +1,202 @@
+package autopilot
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+	"zero/pid"
+
+	"protocol"
+)
+
+// relay autotuning of one attitude axis, requested from the ground and run by the flight loop
+// in place of that axis' pid until it finishes, fails or the mode changes. the result is only
+// proposed: the radio loop reports it until the ground applies or discards it, applied gains
+// are stored and loaded again at startup
+
+type tuneRequest struct {
+	axis byte
+	rule pid.TuneRule
+}
+
+type tuneSession struct {
+	axis   byte
+	rule   pid.TuneRule
+	tuner  *pid.Autotuner
+	target *pid.PID
+}
+
+func (a *Autopilot) requestAutotune(axis, rule byte) {
+	tuneRule := pid.ZieglerNichols
+	if rule == protocol.AutotuneRule_tyreusLuyben {
+		tuneRule = pid.TyreusLuyben
+	}
+	a.tuneMu.Lock()
+	a.tuneRequest = &tuneRequest{axis: axis, rule: tuneRule}
+	a.tuneMu.Unlock()
+}
+
+// swaps the angle loop output (a rate target) of the axis being tuned for the relay output,
+// the rate loop stays closed and becomes part of the tuned plant. only called by the flight loop
+func (a *Autopilot) autotuneStep(roll, pitch, rollControl, pitchControl float32, now time.Time) (float32, float32) {
+	a.tuneMu.Lock()
+	request := a.tuneRequest
+	a.tuneRequest = nil
+	a.tuneMu.Unlock()
+	if request != nil {
+		a.startAutotune(*request, rollControl, pitchControl, now)
+	}
+
+	a.tuneMu.Lock()
+	accepted := a.acceptedGains
+	a.acceptedGains = nil
+	a.tuneMu.Unlock()
+	if accepted != nil {
+		a.angleController(accepted.Axis).SetGains(pid.Gains{Kp: accepted.Kp, Ki: accepted.Ki, Kd: accepted.Kd})
+		log.Printf("autotune axis %v: flying with %+v\n", accepted.Axis, *accepted)
+	}
+
+	session := a.tuning
+	if session == nil {
+		return rollControl, pitchControl
+	}
+	measurement, control := roll, &rollControl
+	if session.axis == protocol.AutotuneAxis_pitch {
+		measurement, control = pitch, &pitchControl
+	}
+
+	output, done, err := session.tuner.Update(measurement, now)
+	*control = output
+	switch {
+	case err != nil:
+		log.Printf("autotune axis %v: %v, keeping the old gains\n", session.axis, err)
+		a.tuning = nil
+		session.target.Prime(measurement, output, now)
+	case done:
+		result := session.tuner.Result()
+		gains := result.Gains(session.rule)
+		log.Printf("autotune axis %v: Ku %v Tu %vs -> %+v, waiting for the ground\n", session.axis, result.Ku, result.Tu, gains)
+		a.tuning = nil
+		a.tuneMu.Lock()
+		a.proposedGains = &protocol.AutotuneGains{Axis: session.axis, Kp: gains.Kp, Ki: gains.Ki, Kd: gains.Kd}
+		a.tuneMu.Unlock()
+		session.target.Prime(measurement, output, now)
+	}
+	return rollControl, pitchControl
+}
+
+func (a *Autopilot) startAutotune(request tuneRequest, rollControl, pitchControl float32, now time.Time) {
+	target, bias, deviation := a.angleController(request.axis), rollControl, float32(rollTuneDeviation)
+	if request.axis == protocol.AutotuneAxis_pitch {
+		bias, deviation = pitchControl, pitchTuneDeviation
+	}
+	tuner, err := pid.NewAutotuner(pid.AutotuneConfig{
+		Setpoint:     target.Setpoint,
+		Bias:         bias,
+		Amplitude:    tuneAmplitude,
+		Hysteresis:   tuneHysteresis,
+		MaxDeviation: deviation,
+		Cycles:       tuneCycles,
+		Timeout:      tuneTimeout,
+	}, now)
+	if err != nil {
+		log.Println("autotune:", err)
+		return
+	}
+	log.Printf("autotune axis %v started around %v\n", request.axis, target.Setpoint)
+	a.tuning = &tuneSession{axis: request.axis, rule: request.rule, tuner: tuner, target: target}
+}
+
+// only called by the flight loop
+func (a *Autopilot) cancelAutotune(reason string) {
+	a.tuneMu.Lock()
+	a.tuneRequest = nil
+	a.tuneMu.Unlock()
+	if a.tuning != nil {
+		log.Printf("autotune axis %v cancelled: %s\n", a.tuning.axis, reason)
+		a.tuning = nil
+	}
+}
+
+// the loop autotune tunes, AutotuneAxis_* in
+func (a *Autopilot) angleController(axis byte) *pid.PID {
+	if axis == protocol.AutotuneAxis_pitch {
+		return a.pitchCtl.Angle
+	}
+	return a.rollCtl.Angle
+}
+
+// answers an autotuneConfirm, applying is left to the flight loop
+func (a *Autopilot) handleAutotuneConfirm(args []byte) byte {
+	axis, apply, err := protocol.ParseAutotuneConfirmArgs(args)
+	if err != nil {
+		log.Println("autotuneConfirm:", err)
+		return argsErrorReason(err)
+	}
+	a.tuneMu.Lock()
+	proposed := a.proposedGains
+	if proposed == nil || proposed.Axis != axis {
+		a.tuneMu.Unlock()
+		log.Printf("autotuneConfirm: no gains proposed for axis %v\n", axis)
+		return protocol.AckReason_rejected
+	}
+	a.proposedGains = nil
+	if apply {
+		a.acceptedGains = proposed
+	}
+	a.tuneMu.Unlock()
+
+	if !apply {
+		log.Printf("autotune axis %v: gains discarded\n", axis)
+		return protocol.AckReason_ok
+	}
+	if a.hw.Storage != nil {
+		if err := a.hw.Storage.Save(gainsStorageName(axis), protocol.EncodeAutotuneGains(*proposed)); err != nil {
+			// flown anyway, they just won't survive a reboot
+			log.Println("autotune: could not save gains:", err)
+		}
+	}
+	return protocol.AckReason_ok
+}
+
+// the proposal to report this radio cycle, if any
+func (a *Autopilot) proposal() (protocol.AutotuneGains, bool) {
+	a.tuneMu.Lock()
+	defer a.tuneMu.Unlock()
+	if a.proposedGains == nil {
+		return protocol.AutotuneGains{}, false
+	}
+	return *a.proposedGains, true
+}
+
+// gains applied in an earlier flight, only called by New
+func (a *Autopilot) loadGains() {
+	if a.hw.Storage == nil {
+		return
+	}
+	for _, axis := range [...]byte{protocol.AutotuneAxis_roll, protocol.AutotuneAxis_pitch} {
+		data, err := a.hw.Storage.Load(gainsStorageName(axis))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Println("autotune: could not load gains:", err)
+			continue
+		}
+		g, err := protocol.DecodeAutotuneGains(data)
+		if err != nil || g.Axis != axis {
+			log.Printf("autotune: stored gains for axis %v are broken: %v\n", axis, err)
+			continue
+		}
+		a.angleController(axis).SetGains(pid.Gains{Kp: g.Kp, Ki: g.Ki, Kd: g.Kd})
+		log.Printf("autotune axis %v: loaded %+v\n", axis, g)
+	}
+}
+
+func gainsStorageName(axis byte) string {
+	if axis == protocol.AutotuneAxis_pitch {
+		return pitchGainsStorageName
+	}
+	return rollGainsStorageName
+}
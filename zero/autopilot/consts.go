@@ -0,0 +1,130 @@
+package autopilot
+
+import (
+	"time"
+	"zero/navfilter"
+	"zero/pid"
+	"zero/tecs"
+)
+
+const (
+	// degrees
+	rollTargetMax = 30
+
+	// L1 lateral guidance, seconds and damping ratio, see guidance.L1
+	l1Period  = 17
+	l1Damping = 0.75
+	// circles around a reached target, the loiter point and home, meters
+	loiterRadius = 60
+
+	// a loiter after a fence breach circles a point at least this far inside, meters
+	fenceLoiterClearance = loiterRadius + 20
+
+	// a takeoff without the accelerometer for this long lands instead
+	takeoffAccelTimeout = time.Second
+
+	// landing, final starts finalLength meters out from home and is captured within finalCapture
+	glideSlope      = 6 // degrees
+	finalLength     = 400
+	finalCapture    = 60
+	landingAirspeed = 12 // m/s
+	// height above home (m) to flare at, and the nose up pitch and bank limit (degrees) through it
+	flareHeight  = 3
+	flarePitch   = 4
+	flareBankMax = 10
+	// a vertical jolt (m/s^2) means the wheels are down. so does a ground speed (m/s) too slow
+	// to fly at, but only within touchdownHeight (m) of home, a headwind slows the plane over
+	// the ground as much in the air
+	touchdownAccel  = 4
+	touchdownSpeed  = 6
+	touchdownHeight = 1
+	// landing is done below this ground speed, m/s
+	stoppedSpeed = 1
+	// a go-around climbs this high above home before trying again, it is flown when further
+	// than goAroundCrossTrack off the centreline below goAroundDecisionHeight, or when the
+	// plane is goAroundOverrun past home without having flared, meters
+	goAroundHeight         = 30
+	goAroundCrossTrack     = 15
+	goAroundDecisionHeight = 15
+	goAroundOverrun        = 100
+
+	// attitude control, angle error (degrees) -> body rate (degrees/s) -> surfaces
+	angleKp         = 3
+	maxAttitudeRate = 60
+	// low pass on the rate pids' D term, the BNO055 gyro output is noisy
+	rateDFilter = 20 * time.Millisecond
+	// taken as the airspeed without any velocity to go by, and flown unless a mission item
+	// asks for another speed, m/s
+	cruiseAirspeed = 15
+
+	// relay autotune of an angle loop, rate demand swing (degrees/s) and how far the axis may wander (degrees)
+	tuneAmplitude      = 20
+	tuneHysteresis     = 1
+	rollTuneDeviation  = 30
+	pitchTuneDeviation = 15
+	tuneCycles         = 4
+	tuneTimeout        = time.Minute
+	// applied autotune gains, one file per axis
+	rollGainsStorageName  = "roll-gains.bin"
+	pitchGainsStorageName = "pitch-gains.bin"
+
+	// smoothing of the barometer ground reference per idle update, the pressure settles within a
+	// second and the gps altitude averages over tens of seconds
+	groundPressureSmoothing = 0.1
+	groundAltSmoothing      = 0.01
+	// how often the barometer has a new measurement and the navigation filter is told the plane
+	// flies without sideslip
+	baroInterval     = 20 * time.Millisecond
+	sideslipInterval = 100 * time.Millisecond
+
+	flightUpdateInterval = 200 * time.Microsecond // 0.2ms
+	idleUpdateInterval   = 100 * time.Millisecond
+	radioUpdateInterval  = 366 // symbols, ~12s with current settings
+
+	// manual mode is left if the ground stops sending inputs, a bit over two radio cycles
+	manualTimeout = 30 * time.Second
+
+	// lost link escalation, the ground sends at least a heartbeat every radio cycle
+	linkLoiterAfter   = 5 * 12 * time.Second
+	linkReturnAfter   = linkLoiterAfter + 2*time.Minute
+	linkLandAfter     = linkReturnAfter + 5*time.Minute
+	linkCheckInterval = time.Second
+)
+
+var (
+	// rate loop gains at these airspeeds (m/s), the middle one is cruise. the surfaces bite with
+	// the square of the airspeed, so the gains fall with it
+	rateScheduleSpeeds = []float32{10, cruiseAirspeed, 22}
+	rollRateGains      = []pid.Gains{{Kp: 0.022, Ki: 0.011}, {Kp: 0.01, Ki: 0.005}, {Kp: 0.0046, Ki: 0.0023}}
+	pitchRateGains     = []pid.Gains{{Kp: 0.045, Ki: 0.022}, {Kp: 0.02, Ki: 0.01}, {Kp: 0.0093, Ki: 0.0046}}
+	yawRateGains       = []pid.Gains{{Kp: 0.022}, {Kp: 0.01}, {Kp: 0.0046}}
+
+	navConfig = navfilter.DefaultConfig()
+
+	// height and speed, climb and sink rates are for the airframe at cruise speed
+	tecsConfig = tecs.Config{
+		TimeConst:      8,
+		ThrottleDamp:   0.5,
+		PitchDamp:      0.3,
+		IntegratorGain: 0.1,
+		SpeedWeight:    1,
+
+		MaxClimb: 5,
+		MinSink:  2,
+		MaxSink:  4,
+
+		MinAirspeed: 10,
+		MaxAirspeed: 22,
+		MaxAccel:    2,
+
+		MinThrottle:    0,
+		MaxThrottle:    1,
+		CruiseThrottle: 0.3,
+		MinPitch:       -15,
+		MaxPitch:       20,
+
+		// the gps altitude is noisy and slow, lean on the accelerometer
+		HeightFilterOmega: 1,
+		SpeedFilterOmega:  2,
+	}
+)
@@ -0,0 +1,55 @@
+package autopilot
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"zero/failsafe"
+	"zero/flightmode"
+
+	"protocol"
+)
+
+// checks the link once and escalates if it has been silent for too long, and acts on sensor faults
+func (a *Autopilot) FailsafeStep() {
+	a.sensorHealthStep()
+
+	now := a.hw.Clock.Now()
+	stage, escalated := a.link.Update(now)
+	if !escalated {
+		return
+	}
+	silence := a.link.Silence(now).Round(time.Second)
+	log.Printf("failsafe: no link for %v, stage %v\n", silence, stage)
+	a.setFailsafeFlag(protocol.FailsafeFlag_linkLost, true)
+
+	mode := a.modes.Mode()
+	if !mode.Airborne() || mode == flightmode.Land {
+		return
+	}
+
+	var to flightmode.Mode
+	switch stage {
+	case failsafe.LinkLoiter:
+		to = flightmode.Loiter
+	case failsafe.LinkReturn:
+		to = flightmode.RTL
+	case failsafe.LinkLand:
+		to = flightmode.Land
+	default:
+		return
+	}
+	if err := a.modes.Transition(to, fmt.Sprintf("no link for %v", silence)); err != nil {
+		log.Println("failsafe:", err)
+	}
+}
+
+func (a *Autopilot) setFailsafeFlag(flag byte, set bool) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	if set {
+		a.status.Failsafe |= flag
+	} else {
+		a.status.Failsafe &^= flag
+	}
+}
@@ -0,0 +1,162 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"zero/flightmode"
+	"zero/geofence"
+
+	"protocol"
+)
+
+// picks up the fence saved before the last reboot
+func (a *Autopilot) loadFence() {
+	if a.hw.Storage == nil {
+		return
+	}
+	data, err := a.hw.Storage.Load(geofence.StorageName)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Println("geofence: could not load:", err)
+		return
+	}
+	limits, items, err := geofence.Unmarshal(data)
+	if err == nil {
+		err = a.fence.Set(limits, items)
+	}
+	if err != nil {
+		log.Println("geofence: stored fence is broken:", err)
+		return
+	}
+	log.Printf("geofence: loaded %d items, altitude %v..%v\n", len(items), limits.MinAltitude, limits.MaxAltitude)
+}
+
+func (a *Autopilot) handleFenceUpload(args []byte) byte {
+	chunk, err := protocol.ParseFenceChunk(args)
+	if err != nil {
+		log.Println("fenceUpload:", err)
+		return argsErrorReason(err)
+	}
+	limits, items, complete, err := a.fenceUpload.Add(chunk)
+	switch {
+	case errors.Is(err, geofence.ErrChecksum):
+		log.Println("fenceUpload:", err)
+		return protocol.AckReason_checksum
+	case err != nil:
+		log.Println("fenceUpload:", err)
+		return protocol.AckReason_rejected
+	case !complete:
+		return protocol.AckReason_ok
+	}
+
+	if err := a.fence.Set(limits, items); err != nil {
+		log.Println("fenceUpload:", err)
+		return protocol.AckReason_outOfRange
+	}
+	log.Printf("geofence: uploaded %d items, altitude %v..%v, checksum %04x\n",
+		len(items), limits.MinAltitude, limits.MaxAltitude, a.fence.Checksum())
+	if a.hw.Storage != nil {
+		if err := a.hw.Storage.Save(geofence.StorageName, geofence.Marshal(limits, items)); err != nil {
+			// still enforced, it just won't survive a reboot
+			log.Println("geofence: could not save:", err)
+		}
+	}
+	return protocol.AckReason_ok
+}
+
+// checks the last position against the fence and acts on new breaches, only called by the flight loop
+func (a *Autopilot) fenceStep(mode flightmode.Mode) {
+	var breach geofence.Breach
+	if mode.Airborne() && a.fence.Enabled() {
+		a.statusMu.Lock()
+		lat, long, alt := a.status.Latitude, a.status.Longitude, a.status.Altitude
+		a.statusMu.Unlock()
+		breach = a.fence.Check(lat, long, float64(alt))
+		if breach&horizontalBreach == 0 {
+			a.recordInside(lat, long)
+		}
+		// every takeoff starts below the floor, it only counts once the plane has been above it
+		if breach&geofence.BreachMinAltitude == 0 {
+			a.fenceAboveMin = true
+		} else if !a.fenceAboveMin {
+			breach &^= geofence.BreachMinAltitude
+		}
+	} else if !mode.Airborne() {
+		a.fenceAboveMin, a.fenceInsideClearance = false, 0
+	}
+
+	previous := a.fenceBreach
+	a.fenceBreach = breach
+	if breach == previous {
+		return
+	}
+	if breach == 0 {
+		log.Println("geofence: back inside")
+		a.setFailsafeFlag(protocol.FailsafeFlag_geofence, false)
+		return
+	}
+	a.setFailsafeFlag(protocol.FailsafeFlag_geofence, true)
+	// only a breach that wasn't there before is acted on, so the ground can take over
+	if breach&^previous == 0 {
+		return
+	}
+	log.Printf("geofence: breach of %v\n", breach)
+	if mode == flightmode.Land {
+		return
+	}
+
+	action := a.fence.Limits().Action
+	to := fenceActionMode(action)
+	if mode != to {
+		reason := fmt.Sprintf("geofence breach of %v", breach)
+		err := a.modes.Transition(to, reason)
+		if err != nil && to == flightmode.RTL {
+			// without a home there is nowhere to return to
+			log.Println("geofence:", err)
+			err = a.modes.Transition(flightmode.Loiter, reason)
+		}
+		if err != nil {
+			log.Println("geofence:", err)
+		}
+	}
+	if a.modes.Mode() == flightmode.Loiter && breach&horizontalBreach != 0 {
+		a.loiterInside()
+	}
+}
+
+const horizontalBreach = geofence.BreachInclusion | geofence.BreachExclusion
+
+// keeps the position for loiterInside, a point well inside is only replaced by another one
+func (a *Autopilot) recordInside(lat, long float64) {
+	clearance := a.fence.Clearance(lat, long)
+	if clearance >= fenceLoiterClearance || a.fenceInsideClearance < fenceLoiterClearance {
+		a.fenceInsideLat, a.fenceInsideLong, a.fenceInsideClearance = lat, long, max(clearance, 1)
+	}
+}
+
+// circling the breach point would take half of every circle outside, so the loiter moves back
+// to the last point inside. it stays put when the fence has changed under that point
+func (a *Autopilot) loiterInside() {
+	lat, long := a.fenceInsideLat, a.fenceInsideLong
+	if a.fenceInsideClearance == 0 || a.fence.Check(lat, long, 0)&horizontalBreach != 0 {
+		return
+	}
+	a.targetMu.Lock()
+	a.loiterLat, a.loiterLong = lat, long
+	a.targetMu.Unlock()
+	log.Printf("geofence: loitering around %v/%v, %.0fm inside\n", lat, long, a.fenceInsideClearance)
+}
+
+func fenceActionMode(action byte) flightmode.Mode {
+	switch action {
+	case protocol.FenceAction_loiter:
+		return flightmode.Loiter
+	case protocol.FenceAction_land:
+		return flightmode.Land
+	}
+	return flightmode.RTL
+}
@@ -0,0 +1,50 @@
+package autopilot
+
+import (
+	"log"
+	"zero/flightmode"
+	"zero/guidance"
+	"zero/nav"
+)
+
+// the leg being flown, only touched by the flight loop
+type leg struct {
+	fromLat, fromLong float64
+	toLat, toLong     float64
+	set               bool
+	// reached the end, circling it until the target moves
+	circling bool
+}
+
+// bank angle in degrees that keeps the plane on its leg, or on a circle around the target
+// once there. advanced tells that the mission moved on this step, so the new leg starts
+// where the previous one ended instead of wherever the plane happens to be
+func (a *Autopilot) lateralGuidance(mode flightmode.Mode, s guidance.State, targetLat, targetLong float64, advanced bool) float32 {
+	l := &a.leg
+	if !l.set || l.toLat != targetLat || l.toLong != targetLong {
+		fromLat, fromLong := s.Lat, s.Long
+		if advanced && l.set {
+			fromLat, fromLong = l.toLat, l.toLong
+		}
+		*l = leg{fromLat: fromLat, fromLong: fromLong, toLat: targetLat, toLong: targetLong, set: true}
+	}
+
+	switch {
+	case mode == flightmode.Loiter:
+		l.circling = true
+	case mode == flightmode.Cruise && a.mission.Arrived():
+		// waiting out the item's loiter time
+		l.circling = true
+	case !l.circling && nav.Distance(s.Lat, s.Long, targetLat, targetLong) < loiterRadius:
+		log.Printf("guidance: reached %v/%v, circling\n", targetLat, targetLong)
+		l.circling = true
+	}
+
+	var accel float64
+	if l.circling {
+		accel = a.l1.Loiter(s, targetLat, targetLong, loiterRadius, false)
+	} else {
+		accel = a.l1.Leg(s, l.fromLat, l.fromLong, targetLat, targetLong)
+	}
+	return float32(guidance.BankAngle(accel, rollTargetMax))
+}
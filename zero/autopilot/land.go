@@ -0,0 +1,187 @@
+package autopilot
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"zero/flightmode"
+	"zero/guidance"
+	"zero/nav"
+)
+
+// autonomous landing: fly to the start of final, follow the glide slope down the runway
+// heading towards home, flare with the throttle cut and wait for the wheels. a go-around
+// climbs out along the runway and tries again, or loiters when the ground asked for it
+
+type landingPhase byte
+
+const (
+	landApproach landingPhase = iota // to the start of final
+	landFinal                        // down the glide slope
+	landFlare                        // throttle cut, nose up
+	landRollout                      // on the ground, slowing down wings level
+	landGoAround                     // climbing out straight ahead
+)
+
+var landingPhaseNames = [...]string{
+	landApproach: "approach",
+	landFinal:    "final",
+	landFlare:    "flare",
+	landRollout:  "rollout",
+	landGoAround: "go-around",
+}
+
+func (p landingPhase) String() string {
+	if int(p) < len(landingPhaseNames) {
+		return landingPhaseNames[p]
+	}
+	return fmt.Sprintf("phase(%d)", byte(p))
+}
+
+// only touched by the flight loop
+type landing struct {
+	phase               landingPhase
+	runway              float64 // degrees
+	homeAlt             float64
+	touchLat, touchLong float64
+	finalLat, finalLong float64
+	// the ground asked for the go-around, the plane loiters after it instead of trying again
+	commanded bool
+}
+
+// one flight step in land mode
+func (a *Autopilot) landStep(prevMode flightmode.Mode) {
+	s, ok := a.readFlightState()
+	if !ok {
+		return
+	}
+	now := a.hw.Clock.Now()
+	l := &a.landing
+	if prevMode != flightmode.Land {
+		a.startLanding()
+	}
+
+	a.targetMu.Lock()
+	goAround := a.goAroundRequest
+	a.goAroundRequest = false
+	a.targetMu.Unlock()
+	if goAround {
+		if l.phase == landRollout {
+			log.Println("land: go-around ignored, already on the ground")
+		} else {
+			a.startGoAround(s, "asked for by the ground", now)
+			l.commanded = true
+		}
+	}
+
+	height, _, _ := a.energy.Estimates()
+	height -= l.homeAlt
+	glide := math.Tan(glideSlope * math.Pi / 180)
+	// metres to go to touchdown along the runway and how far off its centreline
+	toGo := finalLength - nav.AlongTrack(l.finalLat, l.finalLong, l.touchLat, l.touchLong, s.lat, s.long)
+	offCentre := nav.CrossTrack(l.finalLat, l.finalLong, l.touchLat, l.touchLong, s.lat, s.long)
+
+	switch l.phase {
+	case landApproach:
+		energy := a.energyStep(s, l.homeAlt+finalLength*glide, cruiseAirspeed, prevMode, now)
+		a.setThrust(float32(energy.Throttle))
+		roll := guidance.BankAngle(a.l1.Point(s.guidance(), l.finalLat, l.finalLong), rollTargetMax)
+		a.holdAttitude(s, float32(roll), float32(energy.Pitch), prevMode, now)
+		if nav.Distance(s.lat, s.long, l.finalLat, l.finalLong) < finalCapture {
+			a.setLandingPhase(landFinal)
+		}
+
+	case landFinal:
+		energy := a.energyStep(s, l.homeAlt+max(toGo, 0)*glide, landingAirspeed, prevMode, now)
+		a.setThrust(float32(energy.Throttle))
+		roll := guidance.BankAngle(a.l1.Leg(s.guidance(), l.finalLat, l.finalLong, l.touchLat, l.touchLong), rollTargetMax)
+		a.holdAttitude(s, float32(roll), float32(energy.Pitch), prevMode, now)
+		switch {
+		case height < goAroundDecisionHeight && math.Abs(offCentre) > goAroundCrossTrack:
+			a.startGoAround(s, fmt.Sprintf("%.0fm off the centreline", offCentre), now)
+		case toGo < -goAroundOverrun:
+			a.startGoAround(s, "too long", now)
+		case height < flareHeight:
+			a.setLandingPhase(landFlare)
+		}
+
+	case landFlare:
+		// keeps the height estimate running for a go-around
+		a.energyStep(s, l.homeAlt, landingAirspeed, prevMode, now)
+		a.setThrust(0)
+		roll := guidance.BankAngle(a.l1.Leg(s.guidance(), l.finalLat, l.finalLong, l.touchLat, l.touchLong), flareBankMax)
+		a.holdAttitude(s, float32(roll), flarePitch, prevMode, now)
+		jolt := math.Abs(verticalAccel(s.roll, s.pitch, s.accelX, s.accelY, s.accelZ))
+		if jolt > touchdownAccel || (s.haveVelocity && s.groundSpeed < touchdownSpeed && height < touchdownHeight) {
+			log.Printf("land: touchdown %.0fm from home, %.1fm off the centreline\n", toGo, offCentre)
+			a.setLandingPhase(landRollout)
+		}
+
+	case landRollout:
+		// still holding the flare attitude in case the touchdown was a bounce. the energy loops
+		// are not run any more, so the height is the navigated one
+		a.setThrust(0)
+		a.holdAttitude(s, 0, flarePitch, prevMode, now)
+		if s.haveVelocity && s.groundSpeed < stoppedSpeed && s.alt-l.homeAlt < touchdownHeight {
+			if err := a.modes.Transition(flightmode.Idle, "landed"); err != nil {
+				log.Println("land:", err)
+			}
+		}
+
+	case landGoAround:
+		energy := a.energyStep(s, l.homeAlt+goAroundHeight+tecsConfig.MaxClimb*tecsConfig.TimeConst, cruiseAirspeed, prevMode, now)
+		a.setThrust(float32(energy.Throttle))
+		// straight out along the runway, wings level until clear of the ground
+		roll := guidance.BankAngle(a.l1.Leg(s.guidance(), l.finalLat, l.finalLong, l.touchLat, l.touchLong), flareBankMax)
+		a.holdAttitude(s, float32(roll), float32(energy.Pitch), prevMode, now)
+		if height < goAroundHeight {
+			break
+		}
+		if l.commanded {
+			if err := a.modes.Transition(flightmode.Loiter, "go-around complete"); err != nil {
+				log.Println("land:", err)
+			}
+			break
+		}
+		a.setLandingPhase(landApproach)
+	}
+}
+
+// picks the runway, home along the takeoff heading unless the ground set another one
+func (a *Autopilot) startLanding() {
+	a.targetMu.Lock()
+	touchLat, touchLong, homeAlt := a.homeLat, a.homeLong, a.homeAlt
+	runway := a.homeHeading
+	if a.runwaySet {
+		runway = a.runwayHeading
+	}
+	a.goAroundRequest = false
+	a.targetMu.Unlock()
+
+	finalLat, finalLong := nav.Destination(touchLat, touchLong, nav.Wrap360(runway+180), finalLength)
+	a.landing = landing{
+		phase:     landApproach,
+		runway:    runway,
+		homeAlt:   homeAlt,
+		touchLat:  touchLat,
+		touchLong: touchLong,
+		finalLat:  finalLat,
+		finalLong: finalLong,
+	}
+	log.Printf("land: runway %.0f, touchdown at %v/%v\n", runway, touchLat, touchLong)
+}
+
+func (a *Autopilot) startGoAround(s flightState, reason string, now time.Time) {
+	log.Printf("land: go-around from %v, %s\n", a.landing.phase, reason)
+	a.setLandingPhase(landGoAround)
+	// the throttle sat at idle through the flare, the energy loops start over from there
+	a.energy.Reset(energyInput(s, cruiseAirspeed), float64(a.lastThrottle), now)
+}
+
+func (a *Autopilot) setLandingPhase(phase landingPhase) {
+	if a.landing.phase != phase {
+		log.Printf("land: %v -> %v\n", a.landing.phase, phase)
+	}
+	a.landing.phase = phase
+}
@@ -0,0 +1,666 @@
+package autopilot
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+	"zero/barometer"
+	"zero/failsafe"
+	"zero/flightmode"
+	"zero/geofence"
+	"zero/guidance"
+	"zero/hal"
+	"zero/mission"
+	"zero/navfilter"
+	"zero/pid"
+	"zero/tecs"
+
+	"protocol"
+)
+
+type Hardware struct {
+	Attitude  hal.AttitudeSensor
+	Position  hal.PositionSource
+	Barometer hal.Barometer // optional, the gps altitude is flown without it
+	Radio     hal.RadioLink
+	Actuators hal.Actuators
+	Clock     hal.Clock   // defaults to hal.SystemClock
+	Storage   hal.Storage // optional, without it the mission is lost on reboot
+}
+
+type Autopilot struct {
+	hw Hardware
+
+	radioAirtime time.Duration
+	// only touched by the radio loop
+	appliedCommands protocol.SeqWindow
+
+	status   protocol.PlaneStatus
+	statusMu sync.Mutex
+
+	// angle loops feeding body rate loops, yaw only has the rate loop
+	rollCtl, pitchCtl *pid.Cascade
+	yawRatePid        *pid.PID
+	// roll, pitch and yaw rate gains by airspeed, set every flight step
+	rateSchedules [3]*pid.Schedule
+	// height and speed through pitch and throttle
+	energy *tecs.TECS
+	// only touched by the flight loop
+	prevFlightMode flightmode.Mode
+	lastDemand     [3]float32
+	lastThrottle   float32
+	leg            leg
+	l1             guidance.L1
+	// last pid contributions, for logging and tuning
+	termsMu               sync.Mutex
+	rollTerms, pitchTerms pid.CascadeTerms
+
+	// set by the radio loop, picked up by the flight loop
+	tuneMu        sync.Mutex
+	tuneRequest   *tuneRequest
+	acceptedGains *protocol.AutotuneGains
+	// set by the flight loop, reported by the radio loop until the ground answers
+	proposedGains *protocol.AutotuneGains
+	// only touched by the flight loop
+	tuning *tuneSession
+
+	// flown in cruise, wpSet pauses it in favour of the single waypoint
+	mission *mission.Mission
+	// only touched by the radio loop
+	upload mission.Upload
+
+	// checked every flight step
+	fence *geofence.Fence
+	// only touched by the radio loop
+	fenceUpload geofence.Upload
+	// only touched by the flight loop
+	fenceBreach   geofence.Breach
+	fenceAboveMin bool
+	// where a loiter breach action circles: the last position fenceLoiterClearance inside the
+	// fence, or until there was one the last position inside at all. clearance 0 is none yet
+	fenceInsideLat, fenceInsideLong float64
+	fenceInsideClearance            float64
+
+	// only touched by the flight loop
+	landing landing
+	// when the accelerometer stopped answering during the takeoff run, zero while it answers
+	takeoffAccelLost time.Time
+
+	// see altitude.go
+	baroMu    sync.Mutex
+	altimeter barometer.Altimeter
+	// smoothed by the flight loop while on the ground
+	groundPressure float64
+	groundAlt      float64
+	haveGroundAlt  bool
+	// only touched by the flight loop
+	lastPressure float64
+	havePressure bool
+	lastBaroRead time.Time
+
+	// see navigation.go, only touched by the flight loop
+	navFilter      *navfilter.Filter
+	lastBaroUpdate time.Time
+	lastSideslip   time.Time
+	lastFix        [3]float64 // lat, long, alt
+	lastVelocity   [2]float64 // ground speed, course
+	// the last one, for the failsafe loop and the sim
+	estimateMu sync.Mutex
+	estimate   navfilter.Estimate
+	// only touched by the failsafe loop
+	reportedFaults navfilter.Faults
+
+	targetMu      sync.Mutex
+	wpLat, wpLong float64
+	targetAlt     float32
+	// recorded when entering the mode
+	loiterLat, loiterLong float64
+	// recorded when leaving the ground
+	homeLat, homeLong float64
+	homeAlt           float64
+	homeHeading       float64
+	homeSet           bool
+	// set by the land command, overrides the takeoff heading
+	runwayHeading float64
+	runwaySet     bool
+	// set by the radio loop, picked up by the flight loop while landing
+	goAroundRequest bool
+
+	link *failsafe.LinkMonitor
+
+	manualMu sync.Mutex
+	manual   manualInput
+	// mode to go back to once manual control times out
+	manualReturnMode flightmode.Mode
+
+	modes *flightmode.Machine
+}
+
+// last inputs from the ground, axes [-1..1] and throttle [0..1]
+type manualInput struct {
+	roll, pitch, yaw float32
+	throttle         float32
+	lastInput        time.Time
+}
+
+func New(hw Hardware) (*Autopilot, error) {
+	if hw.Attitude == nil || hw.Position == nil || hw.Radio == nil || hw.Actuators == nil {
+		return nil, errors.New("missing hardware")
+	}
+	if hw.Clock == nil {
+		hw.Clock = hal.SystemClock{}
+	}
+
+	a := &Autopilot{
+		hw: hw,
+
+		rollCtl:    pid.NewCascade(newAnglePid(), newRatePid()),
+		pitchCtl:   pid.NewCascade(newAnglePid(), newRatePid()),
+		yawRatePid: newRatePid(),
+		l1:         guidance.L1{Period: l1Period, Damping: l1Damping},
+
+		status: protocol.PlaneStatus{
+			Status:    protocol.Status_none,
+			Battery:   0,
+			Speed:     0,
+			Altitude:  0,
+			Latitude:  0,
+			Longitude: 0,
+		},
+
+		modes:   flightmode.New(),
+		mission: mission.New(),
+		fence:   geofence.New(),
+	}
+	a.status.MissionItem = protocol.MissionItem_none
+	a.loadMission()
+	a.loadFence()
+	a.loadGains()
+
+	// rate gain schedules, energy control and the navigation filter
+	var err error
+	for i, gains := range [][]pid.Gains{rollRateGains, pitchRateGains, yawRateGains} {
+		a.rateSchedules[i], err = pid.NewSchedule(rateScheduleSpeeds, gains)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.energy, err = tecs.New(tecsConfig)
+	if err != nil {
+		return nil, err
+	}
+	a.navFilter, err = navfilter.New(navConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// lost link failsafe
+	a.link, err = failsafe.NewLinkMonitor(failsafe.LinkConfig{
+		LoiterAfter: linkLoiterAfter,
+		ReturnAfter: linkReturnAfter,
+		LandAfter:   linkLandAfter,
+	}, hw.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// flight modes
+	a.modes.OnChange(func(t flightmode.Transition) {
+		// leaving the ground by takeoff. a pilot on the sticks counts as airborne but may still
+		// be standing on the field, home waits for a takeoff
+		if t.From.Airborne() || !t.To.Airborne() || t.To == flightmode.Manual {
+			return
+		}
+		a.statusMu.Lock()
+		lat, long, alt := a.status.Latitude, a.status.Longitude, float64(a.status.Altitude)
+		a.statusMu.Unlock()
+		// the field elevation arming measured beats a single fix
+		a.baroMu.Lock()
+		if groundAlt, ok := a.groundAltitude(); ok {
+			alt = groundAlt
+		}
+		a.baroMu.Unlock()
+		a.targetMu.Lock()
+		a.homeLat, a.homeLong, a.homeAlt, a.homeSet = lat, long, alt, true
+		a.targetMu.Unlock()
+		log.Printf("home set to %v/%v at %vm\n", lat, long, alt)
+	})
+	a.modes.OnEnter(flightmode.Armed, a.captureGround)
+	a.modes.OnEnter(flightmode.Loiter, func(flightmode.Transition) {
+		lat, long := a.currentPosition()
+		a.targetMu.Lock()
+		a.loiterLat, a.loiterLong = lat, long
+		a.targetMu.Unlock()
+		log.Printf("loitering around %v/%v\n", lat, long)
+	})
+	a.modes.AddGuard(flightmode.RTL, func(flightmode.Mode) error {
+		a.targetMu.Lock()
+		defer a.targetMu.Unlock()
+		if !a.homeSet {
+			return errors.New("no home point recorded")
+		}
+		return nil
+	})
+	a.modes.OnChange(func(t flightmode.Transition) {
+		log.Printf("flight mode %v -> %v: %s\n", t.From, t.To, t.Reason)
+		a.statusMu.Lock()
+		a.status.Status = statusForMode(t.To)
+		if t.To != flightmode.Cruise {
+			// only cruise flies the mission
+			a.status.MissionItem = protocol.MissionItem_none
+		}
+		a.statusMu.Unlock()
+	})
+	a.status.Status = statusForMode(a.modes.Mode())
+
+	return a, nil
+}
+
+// starts the flight, radio and failsafe loops, returns immediately
+func (a *Autopilot) Run() {
+	go func() {
+		for {
+			a.FlightStep()
+		}
+	}()
+	go func() {
+		for {
+			a.RadioStep()
+		}
+	}()
+	go func() {
+		for {
+			a.hw.Clock.Sleep(linkCheckInterval)
+			a.FailsafeStep()
+		}
+	}()
+}
+
+func (a *Autopilot) Modes() *flightmode.Machine {
+	return a.modes
+}
+
+// what the roll and pitch pids put out on the last flight step
+func (a *Autopilot) ControlTerms() (roll, pitch pid.CascadeTerms) {
+	a.termsMu.Lock()
+	defer a.termsMu.Unlock()
+	return a.rollTerms, a.pitchTerms
+}
+
+// the navigation filter's last output, zero until the plane flew by it
+func (a *Autopilot) NavEstimate() navfilter.Estimate {
+	a.estimateMu.Lock()
+	defer a.estimateMu.Unlock()
+	return a.estimate
+}
+
+func (a *Autopilot) Status() protocol.PlaneStatus {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	return a.status
+}
+
+// one pass of the flight loop
+func (a *Autopilot) FlightStep() {
+	mode := a.modes.Mode()
+	prevMode := a.prevFlightMode
+	a.prevFlightMode = mode
+	if mode != prevMode {
+		a.cancelAutotune("flight mode changed")
+	}
+	if mode.Airborne() && !prevMode.Airborne() && mode != flightmode.Manual {
+		// the launch is along the runway, landings come back the same way
+		if yaw, _, _, err := a.hw.Attitude.ReadEuler(); err == nil {
+			a.targetMu.Lock()
+			a.homeHeading = float64(yaw)
+			a.targetMu.Unlock()
+		}
+	}
+	a.fenceStep(mode)
+	switch mode {
+	case flightmode.Idle, flightmode.Armed:
+		// keep the position fresh so home is right at takeoff
+		lat, long, alt, err := a.hw.Position.LatLongAlt()
+		if err != nil {
+			log.Printf("flightLoop: gps read error: %v", err)
+		} else {
+			now := a.hw.Clock.Now()
+			a.smoothGround(alt, now)
+			a.setPosition(lat, long, a.readAltitude(alt, now))
+		}
+		a.setSpeed(a.gpsSpeed())
+		a.hw.Clock.Sleep(idleUpdateInterval)
+	case flightmode.Land:
+		a.landStep(prevMode)
+	case flightmode.Takeoff:
+		a.setThrust(1) // max
+		x, y, z, err := a.hw.Attitude.ReadLinearAccel()
+		if err != nil {
+			a.takeoffAccelError(err)
+			return
+		}
+		a.takeoffAccelLost = time.Time{}
+		if (x+y+z)/3 > 8 { // 8m/s
+			a.modes.Transition(flightmode.Cruise, "takeoff acceleration reached")
+		}
+
+	case flightmode.Cruise, flightmode.Loiter, flightmode.RTL:
+		state, ok := a.readFlightState()
+		if !ok {
+			return
+		}
+
+		var advanced bool
+		if mode == flightmode.Cruise {
+			advanced = a.missionStep(state.lat, state.long)
+		}
+
+		a.targetMu.Lock()
+		navLat, navLong, navAlt, navSpeed := a.navTarget(mode)
+		a.targetMu.Unlock()
+		navAlt = a.fence.ClampAltitude(navAlt)
+
+		now := a.hw.Clock.Now()
+		energy := a.energyStep(state, float64(navAlt), navSpeed, prevMode, now)
+		a.setThrust(float32(energy.Throttle))
+		rollTarget := a.lateralGuidance(mode, state.guidance(), navLat, navLong, advanced)
+		a.holdAttitude(state, rollTarget, float32(energy.Pitch), prevMode, now)
+
+	case flightmode.Manual:
+		a.manualMu.Lock()
+		input := a.manual
+		returnMode := a.manualReturnMode
+		a.manualMu.Unlock()
+
+		if a.hw.Clock.Now().Sub(input.lastInput) > manualTimeout {
+			if err := a.modes.Transition(returnMode, "manual input timed out"); err != nil {
+				log.Println("flightLoop: leaving manual:", err)
+			}
+			return
+		}
+
+		// the fence is still checked while a pilot flies
+		if lat, long, alt, err := a.hw.Position.LatLongAlt(); err == nil {
+			a.setPosition(lat, long, a.readAltitude(alt, a.hw.Clock.Now()))
+		}
+		a.setSpeed(a.gpsSpeed())
+
+		a.setThrust(input.throttle)
+		a.actuate(input.roll, input.pitch, input.yaw)
+		a.hw.Clock.Sleep(flightUpdateInterval)
+	}
+}
+
+// a bad read skips the step, the run goes on at full throttle. without the accelerometer for
+// takeoffAccelTimeout the launch can't be detected, the plane may be in the air or still on the
+// field and landing is right for both
+func (a *Autopilot) takeoffAccelError(err error) {
+	now := a.hw.Clock.Now()
+	if a.takeoffAccelLost.IsZero() {
+		log.Printf("flightLoop: accel read error while taking off: %v", err)
+		a.takeoffAccelLost = now
+		return
+	}
+	if now.Sub(a.takeoffAccelLost) < takeoffAccelTimeout {
+		return
+	}
+	a.takeoffAccelLost = time.Time{}
+	if err := a.modes.Transition(flightmode.Land, "no accelerometer during takeoff"); err != nil {
+		log.Println("flightLoop: abandoning takeoff:", err)
+		a.setThrust(0)
+	}
+}
+
+// what the flight loop reads from the sensors every step
+type flightState struct {
+	yaw, roll, pitch             float32
+	rollRate, pitchRate, yawRate float32
+	// smoothed by the navigation filter, see navigation.go
+	lat, long, alt      float64
+	groundSpeed, course float64
+	haveVelocity        bool
+	// the ground velocity less the filter's wind, only while the gps behind them is healthy
+	airspeed               float64
+	haveAirspeed           bool
+	accelX, accelY, accelZ float32
+}
+
+// m/s through the air. the ground speed stands in for it while the wind is unknown, fallback
+// without a velocity either
+func (s flightState) airspeedOr(fallback float64) float64 {
+	switch {
+	case s.haveAirspeed:
+		return s.airspeed
+	case s.haveVelocity:
+		return s.groundSpeed
+	}
+	return fallback
+}
+
+// false if there is no attitude to fly by
+func (a *Autopilot) readFlightState() (s flightState, ok bool) {
+	var err error
+	s.yaw, s.roll, s.pitch, err = a.hw.Attitude.ReadEuler()
+	if err != nil {
+		log.Printf("flightLoop: gyro read error: %v", err)
+		return s, false
+	}
+	s.rollRate, s.pitchRate, s.yawRate, err = a.hw.Attitude.ReadAngularVelocity()
+	if err != nil {
+		log.Printf("flightLoop: gyro rate read error: %v", err)
+		return s, false
+	}
+
+	s.lat, s.long, s.alt, err = a.hw.Position.LatLongAlt()
+	haveGPS := err == nil
+	if !haveGPS {
+		log.Printf("flightLoop: gps read error: %v", err)
+	}
+	s.groundSpeed, s.course, err = a.hw.Position.Velocity()
+	s.haveVelocity = err == nil
+	if !s.haveVelocity {
+		// guidance falls back to the heading
+		s.groundSpeed, s.course = 0, 0
+	}
+	s.accelX, s.accelY, s.accelZ, err = a.hw.Attitude.ReadLinearAccel()
+	if err != nil {
+		log.Printf("flightLoop: accel read error: %v", err)
+	}
+	a.navigate(&s, haveGPS, a.hw.Clock.Now())
+	a.setPosition(s.lat, s.long, s.alt)
+	a.setSpeed(s.groundSpeed)
+	return s, true
+}
+
+func (s flightState) guidance() guidance.State {
+	return guidance.State{
+		Lat:         s.lat,
+		Long:        s.long,
+		GroundSpeed: s.groundSpeed,
+		Course:      s.course,
+		Heading:     float64(s.yaw),
+	}
+}
+
+// pitch and throttle that fly towards height (m) and speed (m/s). there is no airspeed sensor,
+// the navigation filter's wind gives it, see flightState.airspeedOr. without a velocity the
+// speed is taken as on target and only height counts
+func (a *Autopilot) energyStep(s flightState, height, speed float64, prevMode flightmode.Mode, now time.Time) tecs.Output {
+	input := energyInput(s, speed)
+	if !attitudeControlled(prevMode) {
+		a.energy.Reset(input, float64(a.lastThrottle), now)
+	}
+	return a.energy.Update(input, height, speed, now)
+}
+
+func energyInput(s flightState, speed float64) tecs.Input {
+	return tecs.Input{
+		Height:        s.alt,
+		Airspeed:      s.airspeedOr(speed),
+		VerticalAccel: verticalAccel(s.roll, s.pitch, s.accelX, s.accelY, s.accelZ),
+		ForwardAccel:  float64(s.accelX),
+	}
+}
+
+// runs the attitude loops towards the roll and pitch targets (degrees) and moves the surfaces
+func (a *Autopilot) holdAttitude(s flightState, rollTarget, pitchTarget float32, prevMode flightmode.Mode, now time.Time) {
+	a.rollCtl.Angle.Setpoint = rollTarget
+	a.pitchCtl.Angle.Setpoint = pitchTarget
+	// before priming, that depends on Ki
+	a.scheduleRateGains(s)
+	if !attitudeControlled(prevMode) {
+		// the pids sat out takeoff or manual, pick up from whatever the surfaces were doing
+		a.rollCtl.Prime(s.rollRate, a.lastDemand[0], now)
+		a.pitchCtl.Prime(s.pitchRate, a.lastDemand[1], now)
+		a.yawRatePid.Prime(s.yawRate, a.lastDemand[2], now)
+	}
+	rollRateTarget := a.rollCtl.Angle.Compute(s.roll, now)
+	pitchRateTarget := a.pitchCtl.Angle.Compute(s.pitch, now)
+	rollRateTarget, pitchRateTarget = a.autotuneStep(s.roll, s.pitch, rollRateTarget, pitchRateTarget, now)
+
+	rollControl := a.rollCtl.ComputeRate(rollRateTarget, s.rollRate, now)
+	pitchControl := a.pitchCtl.ComputeRate(pitchRateTarget, s.pitchRate, now)
+	a.yawRatePid.Setpoint = coordinatedYawRate(s.roll, s.airspeedOr(cruiseAirspeed))
+	yawControl := a.yawRatePid.Compute(s.yawRate, now)
+
+	a.termsMu.Lock()
+	a.rollTerms, a.pitchTerms = a.rollCtl.Terms(), a.pitchCtl.Terms()
+	a.termsMu.Unlock()
+
+	a.actuate(rollControl, pitchControl, yawControl)
+}
+
+// degrees of error in, degrees per second out
+func newAnglePid() *pid.PID {
+	p := pid.NewPID(angleKp, 0, 0, 0)
+	p.OutMin, p.OutMax = -maxAttitudeRate, maxAttitudeRate
+	return p
+}
+
+// by the airspeed like in energyInput, without a velocity the gains are the cruise ones
+func (a *Autopilot) scheduleRateGains(s flightState) {
+	airspeed := float32(s.airspeedOr(cruiseAirspeed))
+	a.rollCtl.Rate.SetGains(a.rateSchedules[0].At(airspeed))
+	a.pitchCtl.Rate.SetGains(a.rateSchedules[1].At(airspeed))
+	a.yawRatePid.SetGains(a.rateSchedules[2].At(airspeed))
+}
+
+// degrees per second of error in, surface demand out. the gains are scheduled by the flight loop
+func newRatePid() *pid.PID {
+	p := pid.NewPID(0, 0, 0, 0)
+	p.OutMin, p.OutMax = -1, 1
+	p.DerivativeOnMeasurement = true
+	p.DFilter = rateDFilter
+	return p
+}
+
+// yaw rate of a turn without slip at an airspeed (m/s), degrees per second. below the stall
+// the plane isn't turning on its wings anyway
+func coordinatedYawRate(roll float32, airspeed float64) float32 {
+	const g = 9.81
+	rollRad := float64(roll) * math.Pi / 180
+	return float32(g * math.Tan(rollRad) / max(airspeed, tecsConfig.MinAirspeed) * 180 / math.Pi)
+}
+
+// upwards acceleration in the world frame from the body frame one, gravity already removed
+func verticalAccel(roll, pitch, x, y, z float32) float64 {
+	r, p := float64(roll)*math.Pi/180, float64(pitch)*math.Pi/180
+	down := -math.Sin(p)*float64(x) + math.Sin(r)*math.Cos(p)*float64(y) + math.Cos(r)*math.Cos(p)*float64(z)
+	return -down
+}
+
+func (a *Autopilot) setPosition(lat, long, alt float64) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	a.status.Latitude = lat
+	a.status.Longitude = long
+	a.status.Altitude = float32(alt)
+}
+
+// m/s over the ground
+func (a *Autopilot) setSpeed(speed float64) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	a.status.Speed = float32(speed)
+}
+
+// the gps ground speed for when the navigation filter isn't running, 0 without one
+func (a *Autopilot) gpsSpeed() float64 {
+	speed, _, err := a.hw.Position.Velocity()
+	if err != nil {
+		return 0
+	}
+	return speed
+}
+
+func (a *Autopilot) currentPosition() (lat, long float64) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	return a.status.Latitude, a.status.Longitude
+}
+
+// where and how fast (m/s) the plane should be flying in the given mode, targetMu must be held
+func (a *Autopilot) navTarget(mode flightmode.Mode) (lat, long float64, alt float32, speed float64) {
+	switch mode {
+	case flightmode.Loiter:
+		return a.loiterLat, a.loiterLong, a.targetAlt, cruiseAirspeed
+	case flightmode.RTL:
+		return a.homeLat, a.homeLong, a.targetAlt, cruiseAirspeed
+	case flightmode.Cruise:
+		if _, item, ok := a.mission.Current(); ok {
+			speed = cruiseAirspeed
+			if item.Speed != 0 {
+				speed = float64(item.Speed)
+			}
+			return item.Latitude, item.Longitude, item.Altitude, speed
+		}
+	}
+	return a.wpLat, a.wpLong, a.targetAlt, cruiseAirspeed
+}
+
+// modes flown by the attitude pids
+func attitudeControlled(mode flightmode.Mode) bool {
+	switch mode {
+	case flightmode.Cruise, flightmode.Loiter, flightmode.RTL, flightmode.Land:
+		return true
+	}
+	return false
+}
+
+func statusForMode(mode flightmode.Mode) byte {
+	switch mode {
+	case flightmode.Idle:
+		return protocol.Status_idle
+	case flightmode.Armed:
+		return protocol.Status_readyForTakeoff
+	case flightmode.Takeoff, flightmode.Cruise:
+		return protocol.Status_flying
+	case flightmode.Loiter:
+		return protocol.Status_circling
+	case flightmode.RTL:
+		return protocol.Status_returning
+	case flightmode.Land:
+		return protocol.Status_landing
+	case flightmode.Manual:
+		return protocol.Status_manual
+	}
+	return protocol.Status_none
+}
+
+// throttle is [0..1]
+func (a *Autopilot) setThrust(throttle float32) {
+	a.lastThrottle = throttle
+	if err := a.hw.Actuators.SetThrottle(throttle); err != nil {
+		log.Println("setThrust:", err)
+	}
+}
+
+// demands are [-1..1], mixed onto the surfaces by the actuator config
+func (a *Autopilot) actuate(roll, pitch, yaw float32) {
+	a.lastDemand = [3]float32{roll, pitch, yaw}
+	if err := a.hw.Actuators.SetAttitude(roll, pitch, yaw); err != nil {
+		log.Println("actuate:", err)
+	}
+}
@@ -0,0 +1,758 @@
+package autopilot
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+	"zero/barometer"
+	"zero/flightmode"
+	"zero/hal"
+	"zero/navfilter"
+
+	"protocol"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const testLat, testLong, testAlt = 48.1, 11.5, 500
+
+type testPlane struct {
+	*Autopilot
+	attitude  *hal.FakeAttitude
+	position  *hal.FakePosition
+	radio     *hal.FakeRadio
+	actuators *hal.FakeActuators
+	baro      *hal.FakeBarometer
+	clock     *hal.FakeClock
+	storage   *hal.FakeStorage
+	seq       uint16
+}
+
+func newTestPlane(t *testing.T) *testPlane {
+	t.Helper()
+	return newTestPlaneWith(t, hal.NewFakeStorage())
+}
+
+// with what an earlier flight stored
+func newTestPlaneWith(t *testing.T, storage *hal.FakeStorage) *testPlane {
+	t.Helper()
+	p := &testPlane{
+		attitude:  hal.NewFakeAttitude(),
+		position:  hal.NewFakePosition(testLat, testLong, testAlt),
+		radio:     hal.NewFakeRadio(),
+		actuators: hal.NewFakeActuators(),
+		baro:      hal.NewFakeBarometer(barometer.StandardPressure),
+		clock:     hal.NewFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+		storage:   storage,
+	}
+	a, err := New(Hardware{
+		Attitude:  p.attitude,
+		Position:  p.position,
+		Barometer: p.baro,
+		Radio:     p.radio,
+		Actuators: p.actuators,
+		Clock:     p.clock,
+		Storage:   p.storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Autopilot = a
+	// a step on the ground for the first fix, home is taken from it
+	p.FlightStep()
+	return p
+}
+
+// sends a command through one radio cycle and returns the reason it was acked with
+func (p *testPlane) command(t *testing.T, payloadType byte, args []byte) byte {
+	t.Helper()
+	p.seq++
+	return p.commandSeq(t, payloadType, p.seq, args)
+}
+
+func (p *testPlane) commandSeq(t *testing.T, payloadType byte, seq uint16, args []byte) byte {
+	t.Helper()
+	p.radio.Deliver(protocol.EncodeFrame(protocol.NewCommand(payloadType, seq, args)))
+	p.RadioStep()
+	for _, frame := range p.radio.TakeSent() {
+		packet, err := protocol.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloadType, payload, err := protocol.ParsePacket(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payloadType != protocol.PayloadType_ack {
+			continue
+		}
+		ackSeq, reason, err := protocol.ParseAck(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ackSeq != seq {
+			t.Fatalf("ack for %d, want %d", ackSeq, seq)
+		}
+		return reason
+	}
+	t.Fatalf("command %d was not acked", seq)
+	return 0
+}
+
+// takes off by command and flies until the launch acceleration says it's in the air
+func (p *testPlane) launch(t *testing.T) {
+	t.Helper()
+	if reason := p.command(t, protocol.PayloadType_takeoff, nil); reason != protocol.AckReason_ok {
+		t.Fatalf("takeoff acked with %d", reason)
+	}
+	p.attitude.SetLinearAccel(9, 9, 9)
+	p.FlightStep()
+	p.attitude.SetLinearAccel(0, 0, 0)
+	if mode := p.Modes().Mode(); mode != flightmode.Cruise {
+		t.Fatalf("mode %v after launch, want cruise", mode)
+	}
+}
+
+func TestTakeoffToCruise(t *testing.T) {
+	p := newTestPlane(t)
+	if reason := p.command(t, protocol.PayloadType_takeoff, []byte{0}); reason != protocol.AckReason_malformed {
+		t.Errorf("takeoff with args acked with %d, want malformed", reason)
+	}
+	if reason := p.command(t, protocol.PayloadType_takeoff, nil); reason != protocol.AckReason_ok {
+		t.Fatalf("takeoff acked with %d", reason)
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Takeoff {
+		t.Fatalf("mode %v after the takeoff command, want takeoff", mode)
+	}
+
+	// full power until the launch is felt
+	p.attitude.SetLinearAccel(2, 0, 0)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Takeoff {
+		t.Errorf("mode %v before the launch acceleration, want takeoff", mode)
+	}
+	if throttle := p.actuators.Throttle(); throttle != 1 {
+		t.Errorf("throttle %v while taking off, want 1", throttle)
+	}
+
+	p.attitude.SetLinearAccel(9, 9, 9)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Cruise {
+		t.Fatalf("mode %v after the launch acceleration, want cruise", mode)
+	}
+	p.targetMu.Lock()
+	homeSet, homeLat, homeLong := p.homeSet, p.homeLat, p.homeLong
+	p.targetMu.Unlock()
+	if !homeSet || homeLat != testLat || homeLong != testLong {
+		t.Errorf("home %v at %v/%v, want the launch point", homeSet, homeLat, homeLong)
+	}
+	if status := p.Status().Status; status != statusForMode(flightmode.Cruise) {
+		t.Errorf("status %d, want cruise", status)
+	}
+
+	// in the air a second takeoff makes no sense
+	if reason := p.command(t, protocol.PayloadType_takeoff, nil); reason != protocol.AckReason_rejected {
+		t.Errorf("takeoff in cruise acked with %d, want rejected", reason)
+	}
+}
+
+// a bad accelerometer read doesn't end the flight, losing it for good lands
+func TestTakeoffAccelLost(t *testing.T) {
+	p := newTestPlane(t)
+	if reason := p.command(t, protocol.PayloadType_takeoff, nil); reason != protocol.AckReason_ok {
+		t.Fatalf("takeoff acked with %d", reason)
+	}
+	p.attitude.SetError(errors.New("i2c timeout"))
+	p.FlightStep()
+	p.clock.Advance(takeoffAccelTimeout / 2)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Takeoff {
+		t.Fatalf("mode %v after a bad read, want takeoff", mode)
+	}
+	if throttle := p.actuators.Throttle(); throttle != 1 {
+		t.Errorf("throttle %v after a bad read, want 1", throttle)
+	}
+
+	// a good read in between starts the count over
+	p.attitude.SetError(nil)
+	p.FlightStep()
+	p.attitude.SetError(errors.New("i2c timeout"))
+	p.FlightStep()
+	p.clock.Advance(takeoffAccelTimeout / 2)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Takeoff {
+		t.Fatalf("mode %v, want takeoff", mode)
+	}
+
+	p.clock.Advance(takeoffAccelTimeout / 2)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Land {
+		t.Errorf("mode %v without the accelerometer, want land", mode)
+	}
+}
+
+func wpArgs(lat, long float64) []byte {
+	args := binary.BigEndian.AppendUint64(nil, math.Float64bits(lat))
+	return binary.BigEndian.AppendUint64(args, math.Float64bits(long))
+}
+
+func altArgs(alt float32) []byte {
+	return binary.BigEndian.AppendUint32(nil, math.Float32bits(alt))
+}
+
+func TestWaypointCommand(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, tc := range []struct {
+		name   string
+		args   []byte
+		reason byte
+	}{
+		{"valid", wpArgs(48.2, 11.6), protocol.AckReason_ok},
+		{"southwest", wpArgs(-33.9, -70.6), protocol.AckReason_ok},
+		{"short", wpArgs(48.2, 11.6)[:12], protocol.AckReason_malformed},
+		{"null island", wpArgs(0, 11.6), protocol.AckReason_outOfRange},
+		{"past the pole", wpArgs(90.1, 11.6), protocol.AckReason_outOfRange},
+		{"past the antimeridian", wpArgs(48.2, -180.1), protocol.AckReason_outOfRange},
+		{"nan latitude", wpArgs(nan, 11.6), protocol.AckReason_outOfRange},
+		{"nan longitude", wpArgs(48.2, nan), protocol.AckReason_outOfRange},
+		{"infinite latitude", wpArgs(-inf, 11.6), protocol.AckReason_outOfRange},
+		{"infinite longitude", wpArgs(48.2, inf), protocol.AckReason_outOfRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPlane(t)
+			if reason := p.command(t, protocol.PayloadType_wpSet, tc.args); reason != tc.reason {
+				t.Fatalf("acked with %d, want %d", reason, tc.reason)
+			}
+			p.targetMu.Lock()
+			lat, long := p.wpLat, p.wpLong
+			p.targetMu.Unlock()
+			if tc.reason == protocol.AckReason_ok {
+				if lat != math.Float64frombits(binary.BigEndian.Uint64(tc.args[0:8])) ||
+					long != math.Float64frombits(binary.BigEndian.Uint64(tc.args[8:16])) {
+					t.Errorf("waypoint %v/%v not taken", lat, long)
+				}
+			} else if lat != 0 || long != 0 {
+				t.Errorf("rejected waypoint %v/%v taken anyway", lat, long)
+			}
+		})
+	}
+}
+
+func TestAltitudeCommand(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []byte
+		reason byte
+	}{
+		{"valid", altArgs(620), protocol.AckReason_ok},
+		{"below sea level", altArgs(-20), protocol.AckReason_ok},
+		{"long", append(altArgs(620), 0), protocol.AckReason_malformed},
+		{"nan", altArgs(float32(math.NaN())), protocol.AckReason_outOfRange},
+		{"infinite", altArgs(float32(math.Inf(-1))), protocol.AckReason_outOfRange},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPlane(t)
+			if reason := p.command(t, protocol.PayloadType_altSet, tc.args); reason != tc.reason {
+				t.Fatalf("acked with %d, want %d", reason, tc.reason)
+			}
+			p.targetMu.Lock()
+			alt := p.targetAlt
+			p.targetMu.Unlock()
+			want := float32(0)
+			if tc.reason == protocol.AckReason_ok {
+				want = math.Float32frombits(binary.BigEndian.Uint32(tc.args))
+			}
+			if alt != want {
+				t.Errorf("target altitude %v, want %v", alt, want)
+			}
+		})
+	}
+}
+
+// the acks the plane sent since the last call, by seq
+func (p *testPlane) acks(t *testing.T) map[uint16]byte {
+	t.Helper()
+	acks := make(map[uint16]byte)
+	for _, frame := range p.radio.TakeSent() {
+		packet, err := protocol.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloadType, payload, err := protocol.ParsePacket(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payloadType == protocol.PayloadType_ack {
+			seq, reason, err := protocol.ParseAck(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			acks[seq] = reason
+		}
+	}
+	return acks
+}
+
+// the relay sends one command a radio cycle and backs off per command, with the first chunk
+// lost a few times the second one overtakes it
+func TestMissionUploadThroughRelay(t *testing.T) {
+	p := newTestPlane(t)
+	items := make([]protocol.MissionItem, 15)
+	for i := range items {
+		items[i] = protocol.MissionItem{Latitude: testLat + float64(i)*0.001, Longitude: testLong, Altitude: 100}
+	}
+	chunks, err := protocol.SplitMission(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := protocol.NewRetryQueue()
+	for i, c := range chunks {
+		seq := uint16(100 + i)
+		relay.Push(seq, protocol.EncodeFrame(protocol.NewCommand(protocol.PayloadType_missionUpload, seq, protocol.NewMissionChunk(c))), p.clock.Now())
+	}
+
+	var delivered []uint16
+	lost := 4
+	for cycle := 0; relay.Len() > 0; cycle++ {
+		if cycle > 20 {
+			t.Fatalf("upload still going after %d cycles, delivered %v", cycle, delivered)
+		}
+		now := p.clock.Now()
+		if gaveUp := relay.Expire(now); len(gaveUp) > 0 {
+			t.Fatalf("relay gave up on %v", gaveUp)
+		}
+		if seq, frame, ok := relay.Next(now); ok {
+			if seq == 100 && lost > 0 {
+				lost--
+			} else {
+				delivered = append(delivered, seq)
+				p.radio.Deliver(frame)
+				p.RadioStep()
+				for ackSeq, reason := range p.acks(t) {
+					if reason != protocol.AckReason_ok {
+						t.Fatalf("chunk %d acked with %d, delivered %v", ackSeq, reason, delivered)
+					}
+					relay.Ack(ackSeq)
+				}
+			}
+		}
+		p.clock.Advance(12 * time.Second)
+	}
+
+	if delivered[0] == 100 {
+		t.Errorf("delivered %v, want the first chunk overtaken", delivered)
+	}
+	if got := p.mission.Items(); len(got) != len(items) || p.mission.Checksum() != protocol.MissionChecksum(items) {
+		t.Errorf("mission of %d items, checksum %04x, want the uploaded %d", len(got), p.mission.Checksum(), len(items))
+	}
+}
+
+// a retried command is acked the same again without being applied twice
+// a loiter breach action circles well inside the fence, not around the breach point
+func TestFenceLoiterInside(t *testing.T) {
+	p := newTestPlane(t)
+	// about 1.1km north to south and 1.5km east to west around the field
+	var square []protocol.FenceItem
+	for _, corner := range [][2]float64{{-1, -1}, {-1, 1}, {1, 1}, {1, -1}} {
+		square = append(square, protocol.FenceItem{Type: protocol.FenceItem_inclusion,
+			Latitude: testLat + corner[0]*0.005, Longitude: testLong + corner[1]*0.01})
+	}
+	if err := p.fence.Set(protocol.FenceLimits{Action: protocol.FenceAction_loiter}, square); err != nil {
+		t.Fatal(err)
+	}
+	p.launch(t)
+
+	// north at 20m/s, out through the fence 550m away
+	p.position.SetVelocity(20, 0)
+	lat := testLat
+	for p.Modes().Mode() == flightmode.Cruise && lat < testLat+0.01 {
+		lat += 20 / 111195.
+		p.position.SetFix(lat, testLong, testAlt)
+		for range 10 {
+			p.clock.Advance(100 * time.Millisecond)
+			p.FlightStep()
+		}
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Loiter {
+		t.Fatalf("mode %v, want loiter once outside", mode)
+	}
+	p.targetMu.Lock()
+	lat, long := p.loiterLat, p.loiterLong
+	p.targetMu.Unlock()
+	if clearance := p.fence.Clearance(lat, long); p.fence.Check(lat, long, testAlt) != 0 || clearance < loiterRadius {
+		t.Errorf("loitering around %v/%v, %.0fm inside, want at least %vm", lat, long, clearance, loiterRadius)
+	}
+}
+
+func TestRetriedCommand(t *testing.T) {
+	p := newTestPlane(t)
+	if reason := p.commandSeq(t, protocol.PayloadType_altSet, 7, altArgs(620)); reason != protocol.AckReason_ok {
+		t.Fatalf("acked with %d", reason)
+	}
+	p.targetMu.Lock()
+	p.targetAlt = 700 // changed since, by a mission item say
+	p.targetMu.Unlock()
+	if reason := p.commandSeq(t, protocol.PayloadType_altSet, 7, altArgs(620)); reason != protocol.AckReason_ok {
+		t.Fatalf("retry acked with %d", reason)
+	}
+	p.targetMu.Lock()
+	defer p.targetMu.Unlock()
+	if p.targetAlt != 700 {
+		t.Errorf("retry applied again, target %v", p.targetAlt)
+	}
+}
+
+func TestLinkLostEscalation(t *testing.T) {
+	p := newTestPlane(t)
+	p.launch(t)
+
+	for _, step := range []struct {
+		after time.Duration
+		mode  flightmode.Mode
+	}{
+		{linkLoiterAfter - time.Second, flightmode.Cruise},
+		{linkLoiterAfter, flightmode.Loiter},
+		{linkReturnAfter - time.Second, flightmode.Loiter},
+		{linkReturnAfter, flightmode.RTL},
+		{linkLandAfter - time.Second, flightmode.RTL},
+		{linkLandAfter, flightmode.Land},
+	} {
+		p.clock.Advance(step.after - p.link.Silence(p.clock.Now()))
+		p.FailsafeStep()
+		if mode := p.Modes().Mode(); mode != step.mode {
+			t.Fatalf("mode %v after %v without link, want %v", mode, step.after, step.mode)
+		}
+		lost := p.Status().Failsafe&protocol.FailsafeFlag_linkLost != 0
+		if lost != (step.after >= linkLoiterAfter) {
+			t.Errorf("link lost flag %v after %v", lost, step.after)
+		}
+	}
+
+	// hearing the ground again clears the flag but doesn't undo the landing
+	p.radio.Deliver(protocol.EncodeFrame(protocol.NewCommand(protocol.PayloadType_heartbeat, 1, nil)))
+	p.RadioStep()
+	if p.Status().Failsafe&protocol.FailsafeFlag_linkLost != 0 {
+		t.Error("link lost flag still set after a heartbeat")
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Land {
+		t.Errorf("mode %v after the link came back while landing, want land", mode)
+	}
+}
+
+func TestLinkRegainedWhileLoitering(t *testing.T) {
+	p := newTestPlane(t)
+	p.launch(t)
+	p.clock.Advance(linkLoiterAfter)
+	p.FailsafeStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Loiter {
+		t.Fatalf("mode %v, want loiter", mode)
+	}
+
+	p.radio.Deliver(protocol.EncodeFrame(protocol.NewCommand(protocol.PayloadType_heartbeat, 1, nil)))
+	p.RadioStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Cruise {
+		t.Errorf("mode %v after the link came back, want cruise", mode)
+	}
+	if p.Status().Failsafe&protocol.FailsafeFlag_linkLost != 0 {
+		t.Error("link lost flag still set")
+	}
+}
+
+// a sensor the altitude can do without is only reported, losing the gps stops the mission
+func TestSensorFault(t *testing.T) {
+	p := newTestPlane(t)
+	p.launch(t)
+	fault := func(faults navfilter.Faults) {
+		p.estimateMu.Lock()
+		p.estimate.Faults = faults
+		p.estimateMu.Unlock()
+		p.FailsafeStep()
+	}
+
+	fault(navfilter.FaultBarometer)
+	if mode := p.Modes().Mode(); mode != flightmode.Cruise {
+		t.Errorf("mode %v without the barometer, want cruise", mode)
+	}
+	if p.Status().Failsafe&protocol.FailsafeFlag_sensors == 0 {
+		t.Error("sensors flag not set")
+	}
+	fault(navfilter.FaultBarometer | navfilter.FaultGPSVelocity)
+	if mode := p.Modes().Mode(); mode != flightmode.Loiter {
+		t.Errorf("mode %v without the gps velocity, want loiter", mode)
+	}
+
+	// the ground decides when to carry on, and a return home isn't stopped
+	fault(0)
+	if mode := p.Modes().Mode(); mode != flightmode.Loiter {
+		t.Errorf("mode %v with the sensors back, want loiter", mode)
+	}
+	if p.Status().Failsafe&protocol.FailsafeFlag_sensors != 0 {
+		t.Error("sensors flag still set")
+	}
+	if err := p.Modes().Transition(flightmode.RTL, "test"); err != nil {
+		t.Fatal(err)
+	}
+	fault(navfilter.FaultGPSAltitude | navfilter.FaultBarometer)
+	if mode := p.Modes().Mode(); mode != flightmode.RTL {
+		t.Errorf("mode %v without any altitude on the way home, want rtl", mode)
+	}
+}
+
+// on the ground the flag is raised but nothing takes off
+func TestLinkLostOnTheGround(t *testing.T) {
+	p := newTestPlane(t)
+	p.clock.Advance(linkLandAfter)
+	for range 3 {
+		p.FailsafeStep()
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Idle {
+		t.Errorf("mode %v, want idle", mode)
+	}
+	if p.Status().Failsafe&protocol.FailsafeFlag_linkLost == 0 {
+		t.Error("link lost flag not set")
+	}
+}
+
+// flaring into a headwind the plane is as slow over the ground as when rolling out, only the
+// height tells the two apart
+func TestTouchdownInHeadwind(t *testing.T) {
+	p := newTestPlane(t)
+	p.launch(t)
+	// north along the runway, a second and a gps fix at a time
+	lat := testLat
+	fly := func(height, groundSpeed float64) {
+		lat += groundSpeed / 111195
+		p.baro.SetPressure(barometer.AltitudePressure(height, barometer.StandardPressure))
+		p.position.SetFix(lat, testLong, testAlt+height)
+		p.position.SetVelocity(groundSpeed, 0)
+		for range 10 {
+			p.clock.Advance(100 * time.Millisecond)
+			p.FlightStep()
+		}
+	}
+	// flaring 2m up at the landing airspeed into a 9m/s wind, the navigation starts from there
+	p.baro.SetPressure(barometer.AltitudePressure(2, barometer.StandardPressure))
+	p.position.SetFix(testLat, testLong, testAlt+2)
+	p.position.SetVelocity(landingAirspeed-9, 0)
+	if err := p.Modes().Transition(flightmode.Land, "test"); err != nil {
+		t.Fatal(err)
+	}
+	p.FlightStep()
+	p.landing.phase = landFlare
+
+	for _, height := range []float64{2, 2, 1.8, 1.6, 1.4} {
+		fly(height, landingAirspeed-9)
+		if p.landing.phase != landFlare {
+			t.Fatalf("%v %vm up, want still flaring", p.landing.phase, height)
+		}
+	}
+	for _, height := range []float64{1, 0.5, 0, 0} {
+		fly(height, landingAirspeed-9)
+	}
+	if p.landing.phase != landRollout {
+		t.Fatalf("%v on the ground, want rollout", p.landing.phase)
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Land {
+		t.Fatalf("mode %v rolling out, want land", mode)
+	}
+	for _, groundSpeed := range []float64{2, 1, 0.5, 0.2, 0.1, 0.1} {
+		fly(0, groundSpeed)
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Idle {
+		t.Errorf("mode %v stopped on the ground, want idle", mode)
+	}
+}
+
+// a pilot trying the surfaces on the field doesn't make it home, the takeoff after does
+func TestManualOnTheGround(t *testing.T) {
+	p := newTestPlane(t)
+	if reason := p.command(t, protocol.PayloadType_joystick, protocol.NewJoystickArgs(0, 0, 0)); reason != protocol.AckReason_ok {
+		t.Fatalf("joystick acked with %d", reason)
+	}
+	if mode := p.Modes().Mode(); mode != flightmode.Manual {
+		t.Fatalf("mode %v, want manual", mode)
+	}
+	p.FlightStep()
+	p.targetMu.Lock()
+	homeSet := p.homeSet
+	p.targetMu.Unlock()
+	if homeSet {
+		t.Error("home set by manual on the ground")
+	}
+
+	p.clock.Advance(manualTimeout + time.Second)
+	p.FlightStep()
+	if mode := p.Modes().Mode(); mode != flightmode.Idle {
+		t.Fatalf("mode %v after the manual timeout, want idle", mode)
+	}
+	p.launch(t)
+	p.targetMu.Lock()
+	defer p.targetMu.Unlock()
+	if !p.homeSet {
+		t.Error("home not set by the takeoff")
+	}
+}
+
+// the rate gains follow the airspeed, slow flight needs more surface for the same rate
+func TestRateGainSchedule(t *testing.T) {
+	p := newTestPlane(t)
+	for _, tc := range []struct {
+		speed        float64
+		haveVelocity bool
+		want         int // index into the schedule
+	}{
+		{5, true, 0},
+		{10, true, 0},
+		{cruiseAirspeed, true, 1},
+		{22, true, 2},
+		{30, true, 2},
+		{5, false, 1}, // no velocity, flown as if at cruise
+	} {
+		p.scheduleRateGains(flightState{groundSpeed: tc.speed, haveVelocity: tc.haveVelocity})
+		if got, want := p.rollCtl.Rate.Kp, rollRateGains[tc.want].Kp; got != want {
+			t.Errorf("roll rate Kp %v at %vm/s, want %v", got, tc.speed, want)
+		}
+		if got, want := p.pitchCtl.Rate.Ki, pitchRateGains[tc.want].Ki; got != want {
+			t.Errorf("pitch rate Ki %v at %vm/s, want %v", got, tc.speed, want)
+		}
+		if got, want := p.yawRatePid.Kp, yawRateGains[tc.want].Kp; got != want {
+			t.Errorf("yaw rate Kp %v at %vm/s, want %v", got, tc.speed, want)
+		}
+	}
+
+	// with the wind known the airspeed counts, 22m/s over the ground is 10 through the air with
+	// a 12m/s tailwind
+	p.scheduleRateGains(flightState{groundSpeed: 22, haveVelocity: true, airspeed: 10, haveAirspeed: true})
+	if got, want := p.rollCtl.Rate.Kp, rollRateGains[0].Kp; got != want {
+		t.Errorf("roll rate Kp %v at 10m/s airspeed, want %v", got, want)
+	}
+
+	// halfway between cruise and the top
+	p.scheduleRateGains(flightState{groundSpeed: (cruiseAirspeed + 22) / 2.0, haveVelocity: true})
+	want := (rollRateGains[1].Kp + rollRateGains[2].Kp) / 2
+	if got := p.rollCtl.Rate.Kp; math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("roll rate Kp %v between points, want %v", got, want)
+	}
+
+	// and a flight step sets them, the plane sits still after launch
+	p.launch(t)
+	p.FlightStep()
+	if got, want := p.rollCtl.Rate.Kp, rollRateGains[0].Kp; got != want {
+		t.Errorf("roll rate Kp %v after a flight step at 0m/s, want %v", got, want)
+	}
+}
+
+// payload types of everything sent in one radio cycle, in order
+func (p *testPlane) radioCycle(t *testing.T) []byte {
+	t.Helper()
+	p.radio.Deliver(protocol.EncodeFrame(protocol.NewPacket(protocol.PayloadType_heartbeat, nil)))
+	p.RadioStep()
+	var types []byte
+	for _, frame := range p.radio.TakeSent() {
+		packet, err := protocol.DecodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloadType, _, err := protocol.ParsePacket(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, payloadType)
+	}
+	return types
+}
+
+// tuned gains wait for the ground, are flown once it applies them and survive a reboot
+func TestAutotuneConfirm(t *testing.T) {
+	p := newTestPlane(t)
+	p.launch(t)
+	confirm := func(axis byte, apply bool) byte {
+		return p.command(t, protocol.PayloadType_autotuneConfirm, protocol.NewAutotuneConfirmArgs(axis, apply))
+	}
+	if reason := confirm(protocol.AutotuneAxis_roll, true); reason != protocol.AckReason_rejected {
+		t.Errorf("confirm without a proposal acked with %d, want rejected", reason)
+	}
+	if reason := p.command(t, protocol.PayloadType_autotuneConfirm, []byte{protocol.AutotuneAxis_roll, 2}); reason != protocol.AckReason_outOfRange {
+		t.Errorf("confirm with apply 2 acked with %d, want out of range", reason)
+	}
+
+	tuned := protocol.AutotuneGains{Axis: protocol.AutotuneAxis_roll, Kp: 2, Ki: 0.5, Kd: 0.1}
+	p.tuneMu.Lock()
+	p.proposedGains = &tuned
+	p.tuneMu.Unlock()
+	for range 2 {
+		types := p.radioCycle(t)
+		if len(types) != 2 || types[0] != protocol.PayloadType_autotuneGains || types[1] != protocol.PayloadType_bulk {
+			t.Fatalf("sent %v, want the gains ahead of the status", types)
+		}
+	}
+	p.FlightStep()
+	if p.rollCtl.Angle.Kp != angleKp {
+		t.Fatalf("proposed gains flown before the ground applied them")
+	}
+
+	if reason := confirm(protocol.AutotuneAxis_pitch, true); reason != protocol.AckReason_rejected {
+		t.Errorf("confirm for the other axis acked with %d, want rejected", reason)
+	}
+	if reason := confirm(protocol.AutotuneAxis_roll, true); reason != protocol.AckReason_ok {
+		t.Fatalf("confirm acked with %d", reason)
+	}
+	p.FlightStep()
+	if angle := p.rollCtl.Angle; angle.Kp != tuned.Kp || angle.Ki != tuned.Ki || angle.Kd != tuned.Kd {
+		t.Errorf("roll angle gains %v %v %v, want %+v", angle.Kp, angle.Ki, angle.Kd, tuned)
+	}
+	if types := p.radioCycle(t); len(types) != 1 {
+		t.Errorf("sent %v after the confirm, want only the status", types)
+	}
+
+	// a discarded proposal is neither flown nor stored
+	p.tuneMu.Lock()
+	p.proposedGains = &protocol.AutotuneGains{Axis: protocol.AutotuneAxis_pitch, Kp: 3}
+	p.tuneMu.Unlock()
+	if reason := confirm(protocol.AutotuneAxis_pitch, false); reason != protocol.AckReason_ok {
+		t.Fatalf("discard acked with %d", reason)
+	}
+	p.FlightStep()
+	if p.pitchCtl.Angle.Kp != angleKp {
+		t.Errorf("discarded pitch gains flown, Kp %v", p.pitchCtl.Angle.Kp)
+	}
+
+	rebooted := newTestPlaneWith(t, p.storage)
+	if angle := rebooted.rollCtl.Angle; angle.Kp != tuned.Kp || angle.Ki != tuned.Ki || angle.Kd != tuned.Kd {
+		t.Errorf("roll angle gains after a reboot %v %v %v, want %+v", angle.Kp, angle.Ki, angle.Kd, tuned)
+	}
+	if rebooted.pitchCtl.Angle.Kp != angleKp {
+		t.Errorf("pitch angle Kp after a reboot %v, want the default", rebooted.pitchCtl.Angle.Kp)
+	}
+}
+
+// the flight loop runs every flightUpdateInterval, the barometer is only asked every baroInterval
+func TestBarometerReads(t *testing.T) {
+	p := newTestPlane(t)
+	// on the ground once per idle step, for the ground reference and the altitude alike
+	before := p.baro.Reads()
+	p.FlightStep()
+	if reads := p.baro.Reads() - before; reads != 1 {
+		t.Errorf("%d reads in an idle step, want 1", reads)
+	}
+
+	p.launch(t)
+	p.clock.Advance(baroInterval)
+	before = p.baro.Reads()
+	steps := int(10 * baroInterval / flightUpdateInterval)
+	for range steps {
+		p.FlightStep()
+		p.clock.Advance(flightUpdateInterval)
+	}
+	if reads := p.baro.Reads() - before; reads < 10 || reads > 11 {
+		t.Errorf("%d reads in %d flight steps over %v, want one per %v", reads, steps, 10*baroInterval, baroInterval)
+	}
+}
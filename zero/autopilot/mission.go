@@ -0,0 +1,111 @@
+package autopilot
+
+import (
+	"errors"
+	"log"
+	"os"
+	"zero/mission"
+
+	"protocol"
+)
+
+// picks up the mission saved before the last reboot
+func (a *Autopilot) loadMission() {
+	if a.hw.Storage == nil {
+		return
+	}
+	data, err := a.hw.Storage.Load(mission.StorageName)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Println("mission: could not load:", err)
+		return
+	}
+	items, err := mission.Unmarshal(data)
+	if err != nil {
+		log.Println("mission: stored mission is broken:", err)
+		return
+	}
+	a.mission.Set(items)
+	log.Printf("mission: loaded %d items\n", len(items))
+}
+
+func (a *Autopilot) handleMissionUpload(args []byte) byte {
+	chunk, err := protocol.ParseMissionChunk(args)
+	if err != nil {
+		log.Println("missionUpload:", err)
+		return argsErrorReason(err)
+	}
+	items, complete, err := a.upload.Add(chunk)
+	switch {
+	case errors.Is(err, mission.ErrChecksum):
+		log.Println("missionUpload:", err)
+		return protocol.AckReason_checksum
+	case err != nil:
+		log.Println("missionUpload:", err)
+		return protocol.AckReason_rejected
+	case !complete:
+		return protocol.AckReason_ok
+	}
+
+	a.mission.Set(items)
+	log.Printf("mission: uploaded %d items, checksum %04x\n", len(items), a.mission.Checksum())
+	if a.hw.Storage != nil {
+		if err := a.hw.Storage.Save(mission.StorageName, mission.Marshal(items)); err != nil {
+			// still flyable, it just won't survive a reboot
+			log.Println("mission: could not save:", err)
+		}
+	}
+	return protocol.AckReason_ok
+}
+
+// answers a missionRequest, the chunk doubles as the ack
+func (a *Autopilot) transmitMissionChunk(seq uint16, args []byte) {
+	var packet []byte
+	index, err := protocol.ParseMissionRequestArgs(args)
+	if err != nil {
+		log.Println("missionRequest:", err)
+		packet = protocol.NewAck(seq, protocol.AckReason_malformed)
+	} else if chunk, err := a.mission.Chunk(int(index)); err != nil {
+		log.Println("missionRequest:", err)
+		packet = protocol.NewAck(seq, protocol.AckReason_outOfRange)
+	} else {
+		packet = protocol.NewMissionChunkReply(seq, chunk)
+	}
+
+	start := a.hw.Clock.Now()
+	err = a.hw.Radio.Transmit(protocol.EncodeFrame(packet))
+	a.radioAirtime += a.hw.Clock.Now().Sub(start)
+	if err != nil {
+		log.Println("radioLoop: mission chunk tx error:", err)
+	}
+}
+
+// advances the mission and reports the current item, only called by the flight loop.
+// returns whether it moved on to the next item
+func (a *Autopilot) missionStep(lat, long float64) bool {
+	advanced, finished := a.mission.Update(lat, long, a.hw.Clock.Now())
+	index, item, ok := a.mission.Current()
+	switch {
+	case finished:
+		// keep heading for the last item once the mission is done
+		items := a.mission.Items()
+		last := items[len(items)-1]
+		a.targetMu.Lock()
+		a.wpLat, a.wpLong, a.targetAlt = last.Latitude, last.Longitude, last.Altitude
+		a.targetMu.Unlock()
+		log.Println("mission: finished")
+	case advanced:
+		log.Printf("mission: item %d, %v/%v at %vm\n", index, item.Latitude, item.Longitude, item.Altitude)
+	}
+
+	missionItem := byte(protocol.MissionItem_none)
+	if ok {
+		missionItem = byte(index)
+	}
+	a.statusMu.Lock()
+	a.status.MissionItem = missionItem
+	a.statusMu.Unlock()
+	return advanced
+}
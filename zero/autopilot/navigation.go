@@ -0,0 +1,125 @@
+package autopilot
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"zero/flightmode"
+	"zero/navfilter"
+
+	"protocol"
+)
+
+// in the air the flight loop flies by the navigation filter rather than the raw sensors. it
+// dead reckons from the BNO055 between gps fixes, so position and velocity move smoothly at the
+// flight loop rate instead of jumping once a second, and it learns the wind, which turns the
+// ground speed into an airspeed. the failsafe loop acts on the sensors it stopped trusting
+
+// smooths the position, altitude and velocity in s. starts over from the gps and the barometer
+// after anything that didn't fly by it, like takeoff or manual
+func (a *Autopilot) navigate(s *flightState, haveGPS bool, now time.Time) {
+	// read at most every baroInterval, see readPressure
+	baroAlt, haveBaro := a.baroAltitude(now)
+	if !a.navFilter.Running(now) {
+		if !haveGPS {
+			if haveBaro {
+				s.alt = baroAlt
+			}
+			return
+		}
+		alt, altStdDev := s.alt, navConfig.Vertical.GPSNoise
+		if haveBaro {
+			alt, altStdDev = baroAlt, navConfig.Vertical.BaroNoise
+		}
+		// without a gps velocity the plane is taken to fly its heading at cruise speed
+		speed, course := float64(cruiseAirspeed), float64(s.yaw)
+		if s.haveVelocity {
+			speed, course = s.groundSpeed, s.course
+		}
+		sin, cos := math.Sincos(course * math.Pi / 180)
+		a.navFilter.Reset(s.lat, s.long, speed*cos, speed*sin, alt, altStdDev, now)
+		a.lastBaroUpdate, a.lastSideslip = now, now
+		a.lastFix = [3]float64{s.lat, s.long, s.alt}
+		a.lastVelocity = [2]float64{s.groundSpeed, s.course}
+	}
+
+	a.navFilter.Predict(float64(s.yaw), float64(s.roll), float64(s.pitch),
+		[3]float64{float64(s.accelX), float64(s.accelY), float64(s.accelZ)}, now)
+	if haveBaro && now.Sub(a.lastBaroUpdate) >= baroInterval {
+		a.lastBaroUpdate = now
+		if in := a.navFilter.UpdateBaro(baroAlt); !in.Accepted {
+			log.Printf("navigation: barometer %.1fm off, rejected\n", in.Value)
+		}
+	}
+	// the gps holds a fix until the next one, a new fix is a new position and each is fused once
+	if fix := [3]float64{s.lat, s.long, s.alt}; haveGPS && fix != a.lastFix {
+		a.lastFix = fix
+		if in := a.navFilter.UpdatePosition(s.lat, s.long); !in.Accepted {
+			log.Printf("navigation: gps position %.1fm off, rejected\n", in.Value)
+		}
+		if in := a.navFilter.UpdateGPSAltitude(s.alt); !in.Accepted {
+			log.Printf("navigation: gps altitude %.1fm off, rejected\n", in.Value)
+		}
+	}
+	if velocity := [2]float64{s.groundSpeed, s.course}; s.haveVelocity && velocity != a.lastVelocity {
+		a.lastVelocity = velocity
+		if in := a.navFilter.UpdateVelocity(s.groundSpeed, s.course); !in.Accepted {
+			log.Printf("navigation: gps velocity %.1fm/s off, rejected\n", in.Value)
+		}
+	}
+	if now.Sub(a.lastSideslip) >= sideslipInterval {
+		a.lastSideslip = now
+		a.navFilter.UpdateSideslip(float64(s.yaw))
+	}
+
+	estimate := a.navFilter.Estimate()
+	a.estimateMu.Lock()
+	a.estimate = estimate
+	a.estimateMu.Unlock()
+
+	s.lat, s.long, s.alt = estimate.Lat, estimate.Long, estimate.Alt
+	s.groundSpeed, s.course, s.haveVelocity = estimate.GroundSpeed(), estimate.Course(), true
+	if estimate.Faults&horizontalFaults == 0 {
+		s.airspeed, s.haveAirspeed = estimate.Airspeed(), true
+	}
+}
+
+const (
+	// the gps the position, the velocity and with it the wind come from
+	horizontalFaults = navfilter.FaultGPSPosition | navfilter.FaultGPSVelocity
+	// either one keeps the altitude going
+	verticalFaults = navfilter.FaultGPSAltitude | navfilter.FaultBarometer
+)
+
+// the failsafe loop's check of the sensors the navigation filter distrusts. the filter flies on
+// without one, but without the gps or without any altitude it only dead reckons: a plane in
+// cruise stops following the mission and circles where it is until the ground decides. a
+// return home carries on, it is already the way out
+func (a *Autopilot) sensorHealthStep() {
+	a.estimateMu.Lock()
+	faults := a.estimate.Faults
+	a.estimateMu.Unlock()
+	previous := a.reportedFaults
+	if faults == previous {
+		return
+	}
+	a.reportedFaults = faults
+	if faults == 0 {
+		log.Println("failsafe: sensors healthy again")
+	} else {
+		log.Printf("failsafe: sensor fault, %v\n", faults)
+	}
+	a.setFailsafeFlag(protocol.FailsafeFlag_sensors, faults != 0)
+
+	if !navigationLost(faults) || navigationLost(previous) || a.modes.Mode() != flightmode.Cruise {
+		return
+	}
+	if err := a.modes.Transition(flightmode.Loiter, fmt.Sprintf("sensor fault, %v", faults)); err != nil {
+		log.Println("failsafe:", err)
+	}
+}
+
+func navigationLost(faults navfilter.Faults) bool {
+	return faults&horizontalFaults != 0 || faults&verticalFaults == verticalFaults
+}
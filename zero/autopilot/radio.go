@@ -0,0 +1,271 @@
+package autopilot
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"math"
+	"zero/failsafe"
+	"zero/flightmode"
+
+	"protocol"
+)
+
+// one radio cycle, sends the status and then listens for the ground
+func (a *Autopilot) RadioStep() {
+	a.statusMu.Lock()
+	bytes := a.status.ToBytes()
+	a.statusMu.Unlock()
+
+	start := a.hw.Clock.Now()
+	// ahead of the status, the ground answers that right away
+	if gains, ok := a.proposal(); ok {
+		if err := a.hw.Radio.Transmit(protocol.EncodeFrame(protocol.NewAutotuneGains(gains))); err != nil {
+			log.Println("radioLoop: autotune gains tx error:", err)
+		}
+	}
+	a.hw.Radio.Transmit(protocol.EncodeFrame(protocol.NewPacket(protocol.PayloadType_bulk, bytes[:])))
+	a.radioAirtime += a.hw.Clock.Now().Sub(start)
+
+	log.Printf("transmit: %b airtime: %dms\n", bytes, a.radioAirtime.Milliseconds())
+
+	data, err := a.hw.Radio.Receive(protocol.MaxFrameSize, radioUpdateInterval)
+	if err != nil {
+		if err.Error() != "rx timeout" {
+			log.Println("radioLoopL: rx error:", err)
+		}
+		return
+	}
+	packet, err := protocol.DecodeFrame(data)
+	if err != nil {
+		log.Println("radioLoop: dropping frame:", err)
+		return
+	}
+	payloadType, payload, err := protocol.ParsePacket(packet)
+	if err != nil {
+		log.Println("radioLoop: dropping packet:", err)
+		return
+	}
+	// only count packets that survived the crc, noise on our frequency is not the ground
+	a.linkContact()
+	if payloadType == protocol.PayloadType_heartbeat {
+		return
+	}
+	if !protocol.IsCommand(payloadType) {
+		log.Printf("radioLoop: ignoring non command payload type %v\n", payloadType)
+		return
+	}
+	seq, args, err := protocol.ParseCommand(payload)
+	if err != nil {
+		log.Println("radioLoop: dropping command:", err)
+		return
+	}
+	// reads have nothing to dedupe and a retried request needs the chunk again, not just an ack
+	if payloadType == protocol.PayloadType_missionRequest {
+		a.transmitMissionChunk(seq, args)
+		return
+	}
+
+	reason, seen := a.appliedCommands.Lookup(seq)
+	if seen {
+		log.Printf("radioLoop: command %v already handled, acking again\n", seq)
+	} else {
+		reason = a.handleCommand(payloadType, args)
+		a.appliedCommands.Record(seq, reason)
+	}
+
+	start = a.hw.Clock.Now()
+	err = a.hw.Radio.Transmit(protocol.EncodeFrame(protocol.NewAck(seq, reason)))
+	a.radioAirtime += a.hw.Clock.Now().Sub(start)
+	if err != nil {
+		log.Println("radioLoop: ack tx error:", err)
+	}
+}
+
+func (a *Autopilot) linkContact() {
+	previous := a.link.Contact(a.hw.Clock.Now())
+	if previous == failsafe.LinkOK {
+		return
+	}
+	log.Printf("link regained during failsafe stage %v\n", previous)
+	a.setFailsafeFlag(protocol.FailsafeFlag_linkLost, false)
+
+	// landing is not undone, the ground can still take over manually
+	if mode := a.modes.Mode(); mode == flightmode.Loiter || mode == flightmode.RTL {
+		if err := a.modes.Transition(flightmode.Cruise, "link regained"); err != nil {
+			log.Println("linkContact:", err)
+		}
+	}
+}
+
+// applies a command received from the ground and returns the reason code to ack with
+func (a *Autopilot) handleCommand(payloadType byte, args []byte) byte {
+	switch payloadType {
+	case protocol.PayloadType_wpSet:
+		if len(args) != 16 {
+			log.Printf("wpSet args length of %v (!=16)\n", len(args))
+			return protocol.AckReason_malformed
+		}
+		wpLatNew := math.Float64frombits(binary.BigEndian.Uint64(args[0:8]))
+		wpLongNew := math.Float64frombits(binary.BigEndian.Uint64(args[8:16]))
+
+		// probably a good practice unless youre flying directly over null island
+		if wpLatNew == 0 || wpLongNew == 0 {
+			log.Printf("new lat/long was 0: %v/%v", wpLatNew, wpLongNew)
+			return protocol.AckReason_outOfRange
+		}
+		if math.IsNaN(wpLatNew) || math.IsInf(wpLatNew, 0) || math.IsNaN(wpLongNew) || math.IsInf(wpLongNew, 0) {
+			log.Printf("new lat/long is not a number: %v/%v", wpLatNew, wpLongNew)
+			return protocol.AckReason_outOfRange
+		}
+		if math.Abs(wpLatNew) > 90 || math.Abs(wpLongNew) > 180 {
+			log.Printf("new lat/long out of range: %v/%v", wpLatNew, wpLongNew)
+			return protocol.AckReason_outOfRange
+		}
+
+		a.targetMu.Lock()
+		a.wpLat, a.wpLong = wpLatNew, wpLongNew
+		a.targetMu.Unlock()
+		// a redirect wins over the mission until the next upload
+		a.mission.SetActive(false)
+	case protocol.PayloadType_altSet:
+		if len(args) != 4 {
+			log.Printf("altSet args length of %v (!=4)\n", len(args))
+			return protocol.AckReason_malformed
+		}
+		altNew := math.Float32frombits(binary.BigEndian.Uint32(args[0:4]))
+		if math.IsNaN(float64(altNew)) || math.IsInf(float64(altNew), 0) {
+			log.Printf("new alt is not a number: %v", altNew)
+			return protocol.AckReason_outOfRange
+		}
+		a.targetMu.Lock()
+		a.targetAlt = altNew
+		a.targetMu.Unlock()
+	case protocol.PayloadType_takeoff:
+		if len(args) != 0 {
+			return protocol.AckReason_malformed
+		}
+		if a.modes.Mode() == flightmode.Idle {
+			if err := a.modes.Transition(flightmode.Armed, "takeoff command"); err != nil {
+				log.Println("takeoff:", err)
+				return protocol.AckReason_rejected
+			}
+		}
+		if err := a.modes.Transition(flightmode.Takeoff, "takeoff command"); err != nil {
+			log.Println("takeoff:", err)
+			return protocol.AckReason_rejected
+		}
+	case protocol.PayloadType_land:
+		runway, ok, err := protocol.ParseLandArgs(args)
+		if err != nil {
+			log.Println("land:", err)
+			return argsErrorReason(err)
+		}
+		if !a.modes.Mode().Airborne() {
+			log.Println("land: rejected on the ground")
+			return protocol.AckReason_rejected
+		}
+		if ok {
+			a.targetMu.Lock()
+			a.runwayHeading, a.runwaySet = float64(runway), true
+			a.targetMu.Unlock()
+		}
+		if err := a.modes.Transition(flightmode.Land, "land command"); err != nil {
+			log.Println("land:", err)
+			return protocol.AckReason_rejected
+		}
+	case protocol.PayloadType_goAround:
+		if len(args) != 0 {
+			return protocol.AckReason_malformed
+		}
+		if a.modes.Mode() != flightmode.Land {
+			log.Println("goAround: not landing")
+			return protocol.AckReason_rejected
+		}
+		a.targetMu.Lock()
+		a.goAroundRequest = true
+		a.targetMu.Unlock()
+	case protocol.PayloadType_qnhSet:
+		qnh, err := protocol.ParseQNHArgs(args)
+		if err != nil {
+			log.Println("qnhSet:", err)
+			return argsErrorReason(err)
+		}
+		a.setQNH(float64(qnh) * 100) // hectopascals
+	case protocol.PayloadType_joystick:
+		roll, pitch, yaw, err := protocol.ParseJoystickArgs(args)
+		if err != nil {
+			log.Println("joystick:", err)
+			return argsErrorReason(err)
+		}
+		a.manualMu.Lock()
+		a.manual.roll = float32(roll) / protocol.ManualAxisMax
+		a.manual.pitch = float32(pitch) / protocol.ManualAxisMax
+		a.manual.yaw = float32(yaw) / protocol.ManualAxisMax
+		a.manual.lastInput = a.hw.Clock.Now()
+		a.manualMu.Unlock()
+		if err := a.enterManual(); err != nil {
+			log.Println("manual:", err)
+			return protocol.AckReason_rejected
+		}
+	case protocol.PayloadType_throttle:
+		throttle, err := protocol.ParseThrottleArgs(args)
+		if err != nil {
+			log.Println("throttle:", err)
+			return argsErrorReason(err)
+		}
+		a.manualMu.Lock()
+		a.manual.throttle = float32(throttle) / protocol.ManualThrottleMax
+		a.manual.lastInput = a.hw.Clock.Now()
+		a.manualMu.Unlock()
+		if err := a.enterManual(); err != nil {
+			log.Println("manual:", err)
+			return protocol.AckReason_rejected
+		}
+	case protocol.PayloadType_autotune:
+		axis, rule, err := protocol.ParseAutotuneArgs(args)
+		if err != nil {
+			log.Println("autotune:", err)
+			return argsErrorReason(err)
+		}
+		// only in steady flight, not while returning or escaping a failsafe
+		if mode := a.modes.Mode(); mode != flightmode.Cruise && mode != flightmode.Loiter {
+			log.Printf("autotune: rejected in %v\n", mode)
+			return protocol.AckReason_rejected
+		}
+		a.requestAutotune(axis, rule)
+	case protocol.PayloadType_autotuneConfirm:
+		return a.handleAutotuneConfirm(args)
+	case protocol.PayloadType_missionUpload:
+		return a.handleMissionUpload(args)
+	case protocol.PayloadType_fenceUpload:
+		return a.handleFenceUpload(args)
+	default:
+		return protocol.AckReason_unsupported
+	}
+	return protocol.AckReason_ok
+}
+
+func argsErrorReason(err error) byte {
+	if errors.Is(err, protocol.ErrOutOfRange) {
+		return protocol.AckReason_outOfRange
+	}
+	return protocol.AckReason_malformed
+}
+
+func (a *Autopilot) enterManual() error {
+	current := a.modes.Mode()
+	if current == flightmode.Manual {
+		return nil
+	}
+	returnMode := current
+	if current == flightmode.Takeoff {
+		// the takeoff run is stale once a pilot took over
+		returnMode = flightmode.Cruise
+	}
+	// in place before the flight loop can see manual, it's only read there
+	a.manualMu.Lock()
+	a.manualReturnMode = returnMode
+	a.manualMu.Unlock()
+	return a.modes.Transition(flightmode.Manual, "manual input")
+}
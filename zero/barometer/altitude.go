@@ -0,0 +1,62 @@
+package barometer
+
+import "math"
+
+// meters above the level where the pressure is qnh, both in pascals
+func PressureAltitude(pressure, qnh float64) float64 {
+	return isaTemperature / isaLapseRate * (1 - math.Pow(pressure/qnh, isaExponent))
+}
+
+// the pressure at an altitude above the qnh level, the inverse of PressureAltitude
+func AltitudePressure(altitude, qnh float64) float64 {
+	return qnh * math.Pow(1-altitude*isaLapseRate/isaTemperature, 1/isaExponent)
+}
+
+// turns pressures (pascals) into altitudes (meters). the ground reference is the pressure at a
+// known elevation, heights are measured from it. with a qnh the altitude comes from the pressure
+// alone, without one it's the elevation plus the height. not safe for concurrent use
+type Altimeter struct {
+	qnh                       float64
+	groundPressure, elevation float64
+	grounded                  bool
+}
+
+// 0 clears it
+func (a *Altimeter) SetQNH(qnh float64) {
+	a.qnh = max(qnh, 0)
+}
+
+// ok is false while no qnh is set
+func (a *Altimeter) QNH() (qnh float64, ok bool) {
+	return a.qnh, a.qnh > 0
+}
+
+func (a *Altimeter) SetGround(pressure, elevation float64) {
+	a.groundPressure, a.elevation, a.grounded = pressure, elevation, true
+}
+
+// ok is false before SetGround
+func (a *Altimeter) Ground() (pressure, elevation float64, ok bool) {
+	return a.groundPressure, a.elevation, a.grounded
+}
+
+// above the ground reference, ok is false without one
+func (a *Altimeter) Height(pressure float64) (height float64, ok bool) {
+	if !a.grounded {
+		return 0, false
+	}
+	reference := float64(StandardPressure)
+	if a.qnh > 0 {
+		reference = a.qnh
+	}
+	return PressureAltitude(pressure, reference) - PressureAltitude(a.groundPressure, reference), true
+}
+
+// above sea level, ok is false with neither a qnh nor a ground reference
+func (a *Altimeter) Altitude(pressure float64) (altitude float64, ok bool) {
+	if a.qnh > 0 {
+		return PressureAltitude(pressure, a.qnh), true
+	}
+	height, ok := a.Height(pressure)
+	return a.elevation + height, ok
+}
@@ -0,0 +1,92 @@
+package barometer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrBadConfig = errors.New("bad barometer config")
+
+// samples averaged into one measurement, more is less noise and a longer measurement
+type Oversampling uint8
+
+const (
+	Oversampling1x Oversampling = iota
+	Oversampling2x
+	Oversampling4x
+	Oversampling8x
+	Oversampling16x
+	Oversampling32x
+)
+
+func (o Oversampling) Samples() int {
+	return 1 << o
+}
+
+// coefficient of the low pass on the output, IIR3 weighs a new measurement 1/4
+type IIRFilter uint8
+
+const (
+	IIROff IIRFilter = iota
+	IIR1
+	IIR3
+	IIR7
+	IIR15
+	IIR31
+	IIR63
+	IIR127
+)
+
+// halving steps down from 200Hz
+type OutputDataRate uint8
+
+const (
+	ODR200Hz OutputDataRate = iota
+	ODR100Hz
+	ODR50Hz
+	ODR25Hz
+	ODR12p5Hz
+	ODR6p25Hz
+	ODR3p1Hz
+	ODR1p5Hz
+	ODR0p78Hz
+	ODR0p39Hz
+	ODR0p2Hz
+	ODR0p1Hz
+	ODR0p05Hz
+	ODR0p02Hz
+	ODR0p01Hz
+	ODR0p006Hz
+	ODR0p003Hz
+	ODR0p0015Hz
+)
+
+func (r OutputDataRate) Period() time.Duration {
+	return 5 * time.Millisecond << r
+}
+
+func (c Config) Validate() error {
+	if c.PressureOversampling > Oversampling32x || c.TemperatureOversampling > Oversampling32x {
+		return fmt.Errorf("%w: oversampling %d/%d", ErrBadConfig, c.PressureOversampling, c.TemperatureOversampling)
+	}
+	if c.IIRFilter > IIR127 {
+		return fmt.Errorf("%w: iir filter %d", ErrBadConfig, c.IIRFilter)
+	}
+	if c.OutputDataRate > ODR0p0015Hz {
+		return fmt.Errorf("%w: output data rate %d", ErrBadConfig, c.OutputDataRate)
+	}
+	if t, period := c.MeasurementTime(), c.OutputDataRate.Period(); t > period {
+		return fmt.Errorf("%w: %dx/%dx oversampling takes %v, longer than the %v between measurements",
+			ErrBadConfig, c.PressureOversampling.Samples(), c.TemperatureOversampling.Samples(), t, period)
+	}
+	return nil
+}
+
+// how long one pressure and temperature measurement takes, from the datasheet
+func (c Config) MeasurementTime() time.Duration {
+	us := 234 +
+		392 + c.PressureOversampling.Samples()*2020 +
+		163 + c.TemperatureOversampling.Samples()*2020
+	return time.Duration(us) * time.Microsecond
+}
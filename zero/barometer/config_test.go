@@ -0,0 +1,51 @@
+package barometer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMeasurementTime(t *testing.T) {
+	for _, tc := range []struct {
+		pressure, temperature Oversampling
+		want                  time.Duration
+	}{
+		{Oversampling1x, Oversampling1x, 4829 * time.Microsecond},
+		{Oversampling8x, Oversampling1x, 18969 * time.Microsecond},
+		{Oversampling32x, Oversampling1x, 67449 * time.Microsecond},
+		{Oversampling32x, Oversampling32x, 130069 * time.Microsecond},
+	} {
+		c := Config{PressureOversampling: tc.pressure, TemperatureOversampling: tc.temperature}
+		if got := c.MeasurementTime(); got != tc.want {
+			t.Errorf("%dx/%dx takes %v, want %v", tc.pressure.Samples(), tc.temperature.Samples(), got, tc.want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"default", DefaultConfig(), true},
+		// what the default used to be, a measurement takes 67ms of the 5ms it has
+		{"32x at 200Hz", Config{PressureOversampling: Oversampling32x, TemperatureOversampling: Oversampling1x, IIRFilter: IIR3, OutputDataRate: ODR200Hz}, false},
+		{"1x at 200Hz", Config{OutputDataRate: ODR200Hz}, true},
+		{"2x at 200Hz", Config{PressureOversampling: Oversampling2x, OutputDataRate: ODR200Hz}, false},
+		{"32x at 12.5Hz", Config{PressureOversampling: Oversampling32x, OutputDataRate: ODR12p5Hz}, true},
+		{"32x both at 6.25Hz", Config{PressureOversampling: Oversampling32x, TemperatureOversampling: Oversampling32x, OutputDataRate: ODR6p25Hz}, true},
+		{"64x", Config{PressureOversampling: Oversampling32x + 1, OutputDataRate: ODR0p0015Hz}, false},
+		{"iir past 127", Config{IIRFilter: IIR127 + 1, OutputDataRate: ODR50Hz}, false},
+		{"slowest rate", Config{OutputDataRate: ODR0p0015Hz}, true},
+		{"past the slowest rate", Config{OutputDataRate: ODR0p0015Hz + 1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.ok && err != nil || !tc.ok && !errors.Is(err, ErrBadConfig) {
+				t.Errorf("got %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package barometer
 
+import "time"
+
 // random unrelated constants
 const (
 	BMP390_Address = 0x76
@@ -7,6 +9,9 @@ const (
 
 	otpStart  = 0x31
 	otpLength = 21
+
+	// ReadPressure repeats a pressure for this many output data rate periods
+	staleMeasurements = 4
 )
 
 const (
@@ -55,3 +60,40 @@ const (
 	RegConfig  = 0x1F
 	RegCmd     = 0x7E
 )
+
+// fifo, see fifo.go
+const (
+	FIFOSize = 512 // bytes
+
+	// frame headers
+	FIFOHeader_pressTemp    = 0x94 // temperature then pressure, 3 bytes each
+	FIFOHeader_temp         = 0x90 // temperature, 3 bytes
+	FIFOHeader_press        = 0x84 // pressure, 3 bytes
+	FIFOHeader_time         = 0xA0 // sensor time, 3 bytes, after the last data frame
+	FIFOHeader_empty        = 0x80 // read past the end
+	FIFOHeader_configChange = 0x48 // 1 byte
+	FIFOHeader_configError  = 0x44 // 1 byte
+
+	// RegFifoConfig1 bits
+	fifoEnable     = 1 << 0
+	fifoStopOnFull = 1 << 1
+	fifoTimeEnable = 1 << 2
+	fifoPressure   = 1 << 3
+	fifoTemp       = 1 << 4
+	// RegFifoConfig2, subsampling in the low 3 bits
+	fifoFiltered = 1 << 3
+
+	// the sensor time counts at 25.6kHz and wraps at 24 bits
+	SensorTimeTick = time.Second / 25600
+	sensorTimeMask = 1<<24 - 1
+)
+
+// international standard atmosphere, troposphere
+const (
+	StandardPressure = 101325 // pascals at sea level
+
+	isaTemperature = 288.15 // kelvin at sea level
+	isaLapseRate   = 0.0065 // kelvin per meter
+	// gas constant * lapse rate / (gravity * molar mass of air)
+	isaExponent = 0.190263
+)
@@ -0,0 +1,235 @@
+package barometer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// the fifo buffers up to FIFOSize bytes of frames so a busy reader can drain everything measured
+// since its last read in one burst. each data frame is one measurement at the output data rate,
+// the sensor time frame at the end tells when the newest one was taken
+
+var (
+	ErrBadFIFOConfig = errors.New("bad fifo config")
+	ErrBadFIFOFrame  = errors.New("bad fifo frame")
+	// the sensor rejected the fifo or measurement config it was given
+	ErrFIFOConfigError = errors.New("fifo config error frame")
+)
+
+type FIFOConfig struct {
+	// what goes into the frames, nothing turns the fifo off. pressure can't be compensated
+	// without the temperature next to it
+	Pressure, Temperature bool
+	// a sensor time frame after the newest data frame
+	Time bool
+	// stop storing instead of dropping the oldest frames
+	StopOnFull bool
+	// keeps every 2^n th measurement, up to 7
+	Subsampling uint8
+	// the iir filtered measurements instead of the raw ones
+	Filtered bool
+	// fill level in bytes that raises InterruptFIFOWatermark, up to FIFOSize
+	Watermark uint16
+}
+
+// one frame of the fifo, raw values straight from the sensor
+type FIFOFrame struct {
+	Header                      byte // FIFOHeader_*
+	RawPressure, RawTemperature uint32
+	SensorTime                  uint32
+}
+
+// a compensated measurement drained from the fifo
+type Sample struct {
+	Measurement
+	// counted back from the time of the read by the frame period
+	Time time.Time
+	// in SensorTimeTick, only with FIFOConfig.Time
+	SensorTime uint32
+}
+
+func (c FIFOConfig) Validate() error {
+	if c.Pressure && !c.Temperature {
+		return fmt.Errorf("%w: pressure without temperature", ErrBadFIFOConfig)
+	}
+	if c.Subsampling > 7 {
+		return fmt.Errorf("%w: subsampling 2^%d", ErrBadFIFOConfig, c.Subsampling)
+	}
+	if c.Watermark > FIFOSize {
+		return fmt.Errorf("%w: watermark of %d bytes", ErrBadFIFOConfig, c.Watermark)
+	}
+	return nil
+}
+
+func (b *BMP390) ConfigureFIFO(c FIFOConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if err := b.writeReg(RegFifoWatermark1, uint8(c.Watermark)); err != nil {
+		return fmt.Errorf("failed to configure fifo watermark: %w", err)
+	}
+	if err := b.writeReg(RegFifoWatermark2, uint8(c.Watermark>>8)); err != nil {
+		return fmt.Errorf("failed to configure fifo watermark: %w", err)
+	}
+
+	config2 := c.Subsampling
+	if c.Filtered {
+		config2 |= fifoFiltered
+	}
+	if err := b.writeReg(RegFifoConfig2, config2); err != nil {
+		return fmt.Errorf("failed to configure fifo subsampling: %w", err)
+	}
+
+	var config1 uint8
+	if c.Pressure || c.Temperature {
+		config1 |= fifoEnable
+	}
+	for _, bit := range []struct {
+		set   bool
+		value uint8
+	}{
+		{c.StopOnFull, fifoStopOnFull},
+		{c.Time, fifoTimeEnable},
+		{c.Pressure, fifoPressure},
+		{c.Temperature, fifoTemp},
+	} {
+		if bit.set {
+			config1 |= bit.value
+		}
+	}
+	if err := b.writeReg(RegFifoConfig1, config1); err != nil {
+		return fmt.Errorf("failed to configure fifo: %w", err)
+	}
+
+	b.fifo = c
+	return nil
+}
+
+// drops everything buffered
+func (b *BMP390) FlushFIFO() error {
+	return b.writeReg(RegCmd, Cmd_fifoFlush)
+}
+
+// bytes waiting in the fifo
+func (b *BMP390) FIFOLength() (int, error) {
+	data := make([]byte, 2)
+	if err := b.dev.Tx([]byte{RegFifoLength1}, data); err != nil {
+		return 0, fmt.Errorf("failed to read fifo length: %w", err)
+	}
+	return int(data[1]&0x01)<<8 | int(data[0]), nil
+}
+
+// drains the fifo, oldest sample first. temperature only frames come back with a zero pressure
+func (b *BMP390) ReadFIFO() ([]Sample, error) {
+	readAt := time.Now()
+	length, err := b.FIFOLength()
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if b.fifo.Time {
+		// the sensor time frame comes on top of the reported length
+		length += 4
+	}
+	data := make([]byte, length)
+	if err := b.dev.Tx([]byte{RegFifoData}, data); err != nil {
+		return nil, fmt.Errorf("failed to read fifo: %w", err)
+	}
+	frames, err := ParseFIFO(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	var sensorTime uint32
+	haveTime := false
+	for _, f := range frames {
+		switch f.Header {
+		case FIFOHeader_pressTemp:
+			temperature := b.compensateTemperature(float64(f.RawTemperature))
+			pressure := b.compensatePressure(float64(f.RawPressure))
+			samples = append(samples, Sample{Measurement: Measurement{
+				Pressure:    physic.Pressure(pressure * float64(physic.Pascal)),
+				Temperature: physic.Temperature(temperature * float64(physic.Celsius)),
+			}})
+		case FIFOHeader_temp:
+			temperature := b.compensateTemperature(float64(f.RawTemperature))
+			samples = append(samples, Sample{Measurement: Measurement{
+				Temperature: physic.Temperature(temperature * float64(physic.Celsius)),
+			}})
+		case FIFOHeader_time:
+			sensorTime, haveTime = f.SensorTime, true
+		case FIFOHeader_configError:
+			return nil, ErrFIFOConfigError
+		}
+	}
+
+	period := b.framePeriod()
+	periodTicks := uint32(period / SensorTimeTick)
+	for i := range samples {
+		back := len(samples) - 1 - i
+		samples[i].Time = readAt.Add(-time.Duration(back) * period)
+		if haveTime {
+			samples[i].SensorTime = (sensorTime - uint32(back)*periodTicks) & sensorTimeMask
+		}
+	}
+	return samples, nil
+}
+
+// how far apart the frames in the fifo are
+func (b *BMP390) framePeriod() time.Duration {
+	return b.config.OutputDataRate.Period() << b.fifo.Subsampling
+}
+
+// splits a burst read of the fifo into frames, stopping at the first empty frame. a frame cut
+// off at the end of data is an error
+func ParseFIFO(data []byte) ([]FIFOFrame, error) {
+	var frames []FIFOFrame
+	for i := 0; i < len(data); {
+		header := data[i]
+		var size int
+		switch header {
+		case FIFOHeader_pressTemp:
+			size = 6
+		case FIFOHeader_temp, FIFOHeader_press, FIFOHeader_time:
+			size = 3
+		case FIFOHeader_configChange, FIFOHeader_configError:
+			size = 1
+		case FIFOHeader_empty:
+			return frames, nil
+		default:
+			return frames, fmt.Errorf("%w: header 0x%02X at %d", ErrBadFIFOFrame, header, i)
+		}
+		if i+1+size > len(data) {
+			return frames, fmt.Errorf("%w: header 0x%02X at %d cut off", ErrBadFIFOFrame, header, i)
+		}
+
+		payload := data[i+1 : i+1+size]
+		f := FIFOFrame{Header: header}
+		switch header {
+		case FIFOHeader_pressTemp:
+			f.RawTemperature = uint24(payload[0:3])
+			f.RawPressure = uint24(payload[3:6])
+		case FIFOHeader_temp:
+			f.RawTemperature = uint24(payload)
+		case FIFOHeader_press:
+			f.RawPressure = uint24(payload)
+		case FIFOHeader_time:
+			f.SensorTime = uint24(payload)
+		}
+		frames = append(frames, f)
+		i += 1 + size
+	}
+	return frames, nil
+}
+
+// little endian
+func uint24(b []byte) uint32 {
+	return uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
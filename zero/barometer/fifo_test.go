@@ -0,0 +1,77 @@
+package barometer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFIFO(t *testing.T) {
+	pressTemp := []byte{FIFOHeader_pressTemp, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		frames []FIFOFrame
+		err    error
+	}{
+		{"nothing", nil, nil, nil},
+		// 24 bits little endian, temperature before pressure
+		{"pressure and temperature", pressTemp,
+			[]FIFOFrame{{Header: FIFOHeader_pressTemp, RawTemperature: 0x030201, RawPressure: 0x060504}}, nil},
+		{"temperature", []byte{FIFOHeader_temp, 0xFF, 0xFF, 0xFF},
+			[]FIFOFrame{{Header: FIFOHeader_temp, RawTemperature: 0xFFFFFF}}, nil},
+		{"pressure", []byte{FIFOHeader_press, 0x00, 0x80, 0x00},
+			[]FIFOFrame{{Header: FIFOHeader_press, RawPressure: 0x008000}}, nil},
+		{"sensor time last", append(pressTemp[:7:7], FIFOHeader_time, 0x10, 0x20, 0x30),
+			[]FIFOFrame{
+				{Header: FIFOHeader_pressTemp, RawTemperature: 0x030201, RawPressure: 0x060504},
+				{Header: FIFOHeader_time, SensorTime: 0x302010},
+			}, nil},
+		// reading more than the fifo holds gives empty frames, whatever follows is garbage
+		{"empty frame", append(pressTemp[:7:7], FIFOHeader_empty, 0x00, 0xAB),
+			[]FIFOFrame{{Header: FIFOHeader_pressTemp, RawTemperature: 0x030201, RawPressure: 0x060504}}, nil},
+		{"empty", []byte{FIFOHeader_empty, FIFOHeader_empty}, nil, nil},
+		// config frames carry one byte and are handed on, ReadFIFO fails on the error one
+		{"config change", []byte{FIFOHeader_configChange, 0x00, FIFOHeader_temp, 0x01, 0x00, 0x00},
+			[]FIFOFrame{{Header: FIFOHeader_configChange}, {Header: FIFOHeader_temp, RawTemperature: 1}}, nil},
+		{"config error", []byte{FIFOHeader_configError, 0x00},
+			[]FIFOFrame{{Header: FIFOHeader_configError}}, nil},
+		{"config error cut off", []byte{FIFOHeader_configError}, nil, ErrBadFIFOFrame},
+		{"pressure cut off", append(pressTemp[:7:7], FIFOHeader_press, 0x01),
+			[]FIFOFrame{{Header: FIFOHeader_pressTemp, RawTemperature: 0x030201, RawPressure: 0x060504}}, ErrBadFIFOFrame},
+		{"just a header", []byte{FIFOHeader_pressTemp}, nil, ErrBadFIFOFrame},
+		{"unknown header", []byte{0x11, 0x00}, nil, ErrBadFIFOFrame},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			frames, err := ParseFIFO(tc.data)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err %v, want %v", err, tc.err)
+			}
+			if !reflect.DeepEqual(frames, tc.frames) {
+				t.Errorf("frames %+v, want %+v", frames, tc.frames)
+			}
+		})
+	}
+}
+
+func TestFIFOConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config FIFOConfig
+		ok     bool
+	}{
+		{"off", FIFOConfig{}, true},
+		{"everything", FIFOConfig{Pressure: true, Temperature: true, Time: true, StopOnFull: true, Subsampling: 7, Filtered: true, Watermark: FIFOSize}, true},
+		{"temperature alone", FIFOConfig{Temperature: true}, true},
+		{"pressure alone", FIFOConfig{Pressure: true}, false},
+		{"subsampling 2^8", FIFOConfig{Pressure: true, Temperature: true, Subsampling: 8}, false},
+		{"watermark past the end", FIFOConfig{Pressure: true, Temperature: true, Watermark: FIFOSize + 1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.ok && err != nil || !tc.ok && !errors.Is(err, ErrBadFIFOConfig) {
+				t.Errorf("got %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package barometer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+)
+
+// the INT pin goes high when a measurement or the fifo is ready and stays latched until the
+// status is read. wired to a gpio the reader sleeps on the edge, otherwise it polls the status
+
+type Interrupt uint8
+
+// RegIntCtrl enable bits
+const (
+	InterruptFIFOWatermark Interrupt = 1 << 3
+	InterruptFIFOFull      Interrupt = 1 << 4
+	InterruptDataReady     Interrupt = 1 << 6
+)
+
+// the rest of RegIntCtrl
+const (
+	intActiveHigh = 1 << 1
+	intLatch      = 1 << 2
+)
+
+// RegIntStatus bits
+const (
+	intStatusFIFOWatermark = 1 << 0
+	intStatusFIFOFull      = 1 << 1
+	intStatusDataReady     = 1 << 3
+)
+
+const interruptPollInterval = time.Millisecond
+
+var ErrTimeout = errors.New("timed out waiting for the barometer")
+
+// enables the interrupts in sources. pinName is the gpio the INT pin is wired to, empty
+// leaves Wait polling
+func (b *BMP390) EnableInterrupt(sources Interrupt, pinName string) error {
+	var pin gpio.PinIn
+	if pinName != "" {
+		pin = gpioreg.ByName(pinName)
+		if pin == nil {
+			return errors.New("invalid GPIO pin name")
+		}
+		if err := pin.In(gpio.PullDown, gpio.RisingEdge); err != nil {
+			return fmt.Errorf("failed to set up interrupt pin: %w", err)
+		}
+	}
+
+	if err := b.writeReg(RegIntCtrl, uint8(sources)|intActiveHigh|intLatch); err != nil {
+		return fmt.Errorf("failed to configure interrupts: %w", err)
+	}
+	// an interrupt latched before would hold the pin high and never make an edge
+	if _, err := b.interruptStatus(); err != nil {
+		return err
+	}
+	b.intPin, b.intSources = pin, sources
+	return nil
+}
+
+// blocks until one of the enabled interrupts fired and returns the ones that did
+func (b *BMP390) Wait(timeout time.Duration) (Interrupt, error) {
+	if b.intSources == 0 {
+		return 0, errors.New("no barometer interrupts enabled")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		if b.intPin != nil && !b.intPin.WaitForEdge(time.Until(deadline)) {
+			return 0, ErrTimeout
+		}
+		fired, err := b.interruptStatus()
+		if err != nil {
+			return 0, err
+		}
+		if fired &= b.intSources; fired != 0 {
+			return fired, nil
+		}
+		if time.Now().After(deadline) {
+			return 0, ErrTimeout
+		}
+		if b.intPin == nil {
+			time.Sleep(interruptPollInterval)
+		}
+	}
+}
+
+// reading the status clears it
+func (b *BMP390) interruptStatus() (Interrupt, error) {
+	status := []byte{0}
+	if err := b.dev.Tx([]byte{RegIntStatus}, status); err != nil {
+		return 0, fmt.Errorf("failed to read interrupt status: %w", err)
+	}
+	var fired Interrupt
+	if status[0]&intStatusFIFOWatermark != 0 {
+		fired |= InterruptFIFOWatermark
+	}
+	if status[0]&intStatusFIFOFull != 0 {
+		fired |= InterruptFIFOFull
+	}
+	if status[0]&intStatusDataReady != 0 {
+		fired |= InterruptDataReady
+	}
+	return fired, nil
+}
@@ -7,21 +7,37 @@ import (
 	"math"
 	"time"
 
+	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/i2c"
 	"periph.io/x/conn/v3/physic"
 )
 
+var (
+	ErrNotReady = errors.New("sensor data not ready")
+	ErrStale    = errors.New("sensor stopped measuring")
+)
+
 type BMP390 struct {
 	dev    i2c.Dev
 	calib  calibrationData
 	config Config
+
+	// repeated by ReadPressure while no new measurement is ready
+	lastPressure float64
+	pressureAt   time.Time
+	havePressure bool
+
+	// see fifo.go and interrupt.go
+	fifo       FIFOConfig
+	intPin     gpio.PinIn
+	intSources Interrupt
 }
 
 type Config struct {
-	PressureOversampling    uint8
-	TemperatureOversampling uint8
-	IIRFilter               uint8
-	OutputDataRate          uint8
+	PressureOversampling    Oversampling
+	TemperatureOversampling Oversampling
+	IIRFilter               IIRFilter
+	OutputDataRate          OutputDataRate
 }
 
 // hardcoded corrections written to non volatile memory in the factory because not all chips are identical
@@ -49,6 +65,9 @@ type Measurement struct {
 }
 
 func New(bus i2c.BusCloser, config Config) (*BMP390, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	dev := i2c.Dev{Bus: bus, Addr: BMP390_Address}
 
 	bmp := &BMP390{
@@ -87,6 +106,14 @@ func (b *BMP390) init() error {
 		return fmt.Errorf("failed to configure sensor: %w", err)
 	}
 
+	// the reset flagged a power on, clear it so Check only sees a later one
+	if _, err := b.ReadEvent(); err != nil {
+		return err
+	}
+	if err := b.Check(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -130,16 +157,16 @@ func (b *BMP390) readCalibrationData() error {
 }
 
 func (b *BMP390) configure() error {
-	osrValue := (b.config.PressureOversampling << 3) | b.config.TemperatureOversampling
+	osrValue := uint8(b.config.PressureOversampling)<<3 | uint8(b.config.TemperatureOversampling)
 	if err := b.writeReg(RegOsr, osrValue); err != nil {
 		return fmt.Errorf("failed to configure oversampling: %w", err)
 	}
 
-	if err := b.writeReg(RegOdr, b.config.OutputDataRate); err != nil {
+	if err := b.writeReg(RegOdr, uint8(b.config.OutputDataRate)); err != nil {
 		return fmt.Errorf("failed to configure ODR: %w", err)
 	}
 
-	if err := b.writeReg(RegConfig, b.config.IIRFilter<<1); err != nil {
+	if err := b.writeReg(RegConfig, uint8(b.config.IIRFilter)<<1); err != nil {
 		return fmt.Errorf("failed to configure IIR filter: %w", err)
 	}
 
@@ -154,6 +181,7 @@ func (b *BMP390) softReset() error {
 	return b.writeReg(RegCmd, Cmd_softReset)
 }
 
+// ErrNotReady until the next measurement is done, Wait on InterruptDataReady blocks until then
 func (b *BMP390) ReadMeasurement() (*Measurement, error) {
 	status := []byte{0}
 	if err := b.dev.Tx([]byte{RegStatus}, status); err != nil {
@@ -161,7 +189,7 @@ func (b *BMP390) ReadMeasurement() (*Measurement, error) {
 	}
 
 	if status[0]&0x60 != 0x60 {
-		return nil, errors.New("sensor data not ready")
+		return nil, ErrNotReady
 	}
 
 	data := make([]byte, 6)
@@ -182,6 +210,26 @@ func (b *BMP390) ReadMeasurement() (*Measurement, error) {
 	}, nil
 }
 
+// pascals, for hal.Barometer. a sensor that stopped measuring is reported once the last
+// pressure is a few measurements old
+func (b *BMP390) ReadPressure() (float64, error) {
+	m, err := b.ReadMeasurement()
+	if errors.Is(err, ErrNotReady) && b.havePressure {
+		if time.Since(b.pressureAt) < staleMeasurements*b.config.OutputDataRate.Period() {
+			return b.lastPressure, nil
+		}
+		if err := b.Check(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: no measurement since %v", ErrStale, b.pressureAt)
+	}
+	if err != nil {
+		return 0, err
+	}
+	b.lastPressure, b.pressureAt, b.havePressure = float64(m.Pressure)/float64(physic.Pascal), time.Now(), true
+	return b.lastPressure, nil
+}
+
 func (b *BMP390) compensateTemperature(rawTemp float64) float64 {
 	pd1 := rawTemp - b.calib.PAR_T1
 	pd2 := pd1 * b.calib.PAR_T2
@@ -212,11 +260,12 @@ func (b *BMP390) writeReg(reg, value uint8) error {
 	return b.dev.Tx([]byte{reg, value}, nil)
 }
 
+// the datasheet's drone settings, a measurement takes 19ms of the 20ms it has
 func DefaultConfig() Config {
 	return Config{
-		PressureOversampling:    0x05, // 32x oversampling
-		TemperatureOversampling: 0x05, // 32x oversampling
-		IIRFilter:               0x03, // IIR filter coefficient 7
-		OutputDataRate:          0x00, // 200 Hz
+		PressureOversampling:    Oversampling8x,
+		TemperatureOversampling: Oversampling1x,
+		IIRFilter:               IIR3,
+		OutputDataRate:          ODR50Hz,
 	}
 }
@@ -0,0 +1,100 @@
+package barometer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// what the sensor reports about itself. the error and event registers clear when read
+
+var (
+	ErrSensorFatal  = errors.New("barometer fatal error")
+	ErrSensorConfig = errors.New("barometer rejected its config")
+	// came back from a power cut or reset in sleep mode, measuring nothing until configured again
+	ErrPowerCycled = errors.New("barometer was power cycled")
+)
+
+// bits of RegErrReg
+type ErrorFlags uint8
+
+const (
+	ErrorFlag_fatal   ErrorFlags = 1 << 0
+	ErrorFlag_command ErrorFlags = 1 << 1 // a command was dropped
+	ErrorFlag_config  ErrorFlags = 1 << 2 // the oversampling doesn't fit the output data rate
+)
+
+func (f ErrorFlags) String() string {
+	var names []string
+	for _, flag := range []struct {
+		bit  ErrorFlags
+		name string
+	}{
+		{ErrorFlag_fatal, "fatal"},
+		{ErrorFlag_command, "command"},
+		{ErrorFlag_config, "config"},
+	} {
+		if f&flag.bit != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// bits of RegEvent
+type Event uint8
+
+const (
+	Event_powerOnReset    Event = 1 << 0
+	Event_interfaceActive Event = 1 << 1 // the bus was used during a measurement
+)
+
+func (b *BMP390) ReadErrors() (ErrorFlags, error) {
+	data := []byte{0}
+	if err := b.dev.Tx([]byte{RegErrReg}, data); err != nil {
+		return 0, fmt.Errorf("failed to read error register: %w", err)
+	}
+	return ErrorFlags(data[0] & 0x07), nil
+}
+
+func (b *BMP390) ReadEvent() (Event, error) {
+	data := []byte{0}
+	if err := b.dev.Tx([]byte{RegEvent}, data); err != nil {
+		return 0, fmt.Errorf("failed to read event register: %w", err)
+	}
+	return Event(data[0] & 0x03), nil
+}
+
+// in SensorTimeTick, wraps at 24 bits
+func (b *BMP390) ReadSensorTime() (uint32, error) {
+	data := make([]byte, 3)
+	if err := b.dev.Tx([]byte{RegSensorTime1}, data); err != nil {
+		return 0, fmt.Errorf("failed to read sensor time: %w", err)
+	}
+	return uint24(data), nil
+}
+
+// nil while the sensor measures as configured
+func (b *BMP390) Check() error {
+	flags, err := b.ReadErrors()
+	if err != nil {
+		return err
+	}
+	switch {
+	case flags&ErrorFlag_fatal != 0:
+		return ErrSensorFatal
+	case flags&ErrorFlag_config != 0:
+		return fmt.Errorf("%w: %v", ErrSensorConfig, flags)
+	}
+	event, err := b.ReadEvent()
+	if err != nil {
+		return err
+	}
+	if event&Event_powerOnReset != 0 {
+		return ErrPowerCycled
+	}
+	return nil
+}
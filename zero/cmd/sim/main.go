@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+	"zero/sim"
+
+	"protocol"
+)
+
+// flies a scripted mission against the simulated plane and writes the trajectory as csv:
+// takeoff, then a waypoint north east of the launch point at the requested altitude
+
+func main() {
+	config := sim.DefaultConfig()
+
+	out := flag.String("out", "trajectory.csv", "trajectory csv, - for stdout")
+	flag.DurationVar(&config.Duration, "duration", config.Duration, "simulated flight time")
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "random seed for noise and gusts")
+	flag.Float64Var(&config.Heading, "heading", config.Heading, "launch heading in degrees")
+	flag.Float64Var(&config.Wind[0], "wind-north", 0, "wind towards the north in m/s")
+	flag.Float64Var(&config.Wind[1], "wind-east", 0, "wind towards the east in m/s")
+	flag.Float64Var(&config.Gust, "gust", 0, "gust standard deviation in m/s")
+	flag.Float64Var(&config.QNHRate, "qnh-rate", 0, "sea level pressure change in pascals per second")
+	noise := flag.Bool("noise", true, "add sensor noise")
+	wpNorth := flag.Float64("wp-north", 400, "waypoint meters north of the launch point")
+	wpEast := flag.Float64("wp-east", 300, "waypoint meters east of the launch point")
+	alt := flag.Float64("alt", 60, "target altitude in meters")
+	autotune := flag.String("autotune", "", "tune the roll or pitch pid once in the air")
+	autotuneAt := flag.Duration("autotune-at", time.Minute, "when to send the autotune command")
+	flag.BoolVar(&config.ApplyTunedGains, "apply-gains", true, "apply the gains the autotune proposes")
+	linkLost := flag.Duration("link-lost", 0, "stop the ground heartbeat after this, 0 keeps the link up")
+	verbose := flag.Bool("v", false, "print the autopilot log")
+	flag.Parse()
+
+	if !*noise {
+		config.Noise = sim.Noise{}
+	}
+	config.LinkLostAt = *linkLost
+	wpLat, wpLong := sim.Offset(config.OriginLat, config.OriginLong, *wpNorth, *wpEast)
+	config.Commands = []sim.Command{
+		sim.AltitudeCommand(0, 1, float32(config.OriginAlt+*alt)),
+		sim.WaypointCommand(0, 2, wpLat, wpLong),
+		sim.TakeoffCommand(0, 3),
+	}
+	switch *autotune {
+	case "":
+	case "roll":
+		config.Commands = append(config.Commands, sim.AutotuneCommand(*autotuneAt, 4, protocol.AutotuneAxis_roll, protocol.AutotuneRule_tyreusLuyben))
+	case "pitch":
+		config.Commands = append(config.Commands, sim.AutotuneCommand(*autotuneAt, 4, protocol.AutotuneAxis_pitch, protocol.AutotuneRule_tyreusLuyben))
+	default:
+		log.Fatalln("autotune axis has to be roll or pitch")
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	s, err := sim.New(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	start := time.Now()
+	s.Run()
+	took := time.Since(start)
+
+	w := os.Stdout
+	if *out != "-" {
+		w, err = os.Create(*out)
+		if err != nil {
+			log.Fatalln("could not create trajectory file:", err)
+		}
+		defer w.Close()
+	}
+	if err := sim.WriteCSV(w, s.Trajectory); err != nil {
+		log.Fatalln("could not write trajectory:", err)
+	}
+
+	final := s.Trajectory[len(s.Trajectory)-1]
+	log.SetOutput(os.Stderr)
+	log.Printf("simulated %v in %v, final mode %v, altitude %.1fm, crashed %v\n",
+		final.Time.Round(time.Millisecond), took.Round(time.Millisecond), final.Mode, final.Altitude(), final.Crashed)
+	e := s.EstimateErrors()
+	log.Printf("estimate rms errors: position %.2fm, velocity %.2fm/s, wind %.2fm/s, altitude %.2fm, vertical speed %.2fm/s\n",
+		e.Position, e.Velocity, e.Wind, e.Altitude, e.VerticalSpeed)
+}
@@ -0,0 +1,26 @@
+package failsafe
+
+import "time"
+
+// lost link escalation, each stage is entered once the link has been silent for its timeout
+type Stage byte
+
+const (
+	LinkOK Stage = iota
+	LinkLoiter
+	LinkReturn
+	LinkLand
+)
+
+var stageNames = [...]string{
+	LinkOK:     "link ok",
+	LinkLoiter: "loiter",
+	LinkReturn: "return to home",
+	LinkLand:   "land",
+}
+
+const (
+	DefaultLoiterAfter = time.Minute
+	DefaultReturnAfter = 2 * time.Minute
+	DefaultLandAfter   = 6 * time.Minute
+)
@@ -0,0 +1,94 @@
+package failsafe
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type LinkConfig struct {
+	LoiterAfter, ReturnAfter, LandAfter time.Duration
+}
+
+// tracks how long the ground has been silent, safe for concurrent use
+type LinkMonitor struct {
+	mu          sync.Mutex
+	config      LinkConfig
+	lastContact time.Time
+	stage       Stage
+}
+
+func DefaultLinkConfig() LinkConfig {
+	return LinkConfig{
+		LoiterAfter: DefaultLoiterAfter,
+		ReturnAfter: DefaultReturnAfter,
+		LandAfter:   DefaultLandAfter,
+	}
+}
+
+func NewLinkMonitor(config LinkConfig, now time.Time) (*LinkMonitor, error) {
+	if config.LoiterAfter <= 0 {
+		return nil, errors.New("loiter timeout must be positive")
+	}
+	if config.ReturnAfter <= config.LoiterAfter || config.LandAfter <= config.ReturnAfter {
+		return nil, fmt.Errorf("timeouts must escalate: loiter %v, return %v, land %v",
+			config.LoiterAfter, config.ReturnAfter, config.LandAfter)
+	}
+	return &LinkMonitor{config: config, lastContact: now}, nil
+}
+
+func (s Stage) String() string {
+	if int(s) < len(stageNames) {
+		return stageNames[s]
+	}
+	return fmt.Sprintf("stage(%d)", byte(s))
+}
+
+// call on every packet heard from the ground
+// returns the stage the link was in, anything but LinkOK means it was just regained
+func (l *LinkMonitor) Contact(now time.Time) (previous Stage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous = l.stage
+	l.lastContact = now
+	l.stage = LinkOK
+	return previous
+}
+
+// escalated is true only on the call that moved to a new stage
+// stages are never skipped, only Contact resets them
+func (l *LinkMonitor) Update(now time.Time) (stage Stage, escalated bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	silent := now.Sub(l.lastContact)
+	next := LinkOK
+	switch {
+	case silent >= l.config.LandAfter:
+		next = LinkLand
+	case silent >= l.config.ReturnAfter:
+		next = LinkReturn
+	case silent >= l.config.LoiterAfter:
+		next = LinkLoiter
+	}
+
+	if next > l.stage {
+		// one stage per call so every step of the escalation is acted on
+		l.stage++
+		return l.stage, true
+	}
+	return l.stage, false
+}
+
+func (l *LinkMonitor) Stage() Stage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stage
+}
+
+func (l *LinkMonitor) Silence(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.lastContact)
+}
@@ -0,0 +1,95 @@
+package failsafe
+
+import (
+	"testing"
+	"time"
+)
+
+var testConfig = LinkConfig{LoiterAfter: 10 * time.Second, ReturnAfter: 30 * time.Second, LandAfter: 90 * time.Second}
+
+func TestEscalation(t *testing.T) {
+	start := time.Unix(0, 0)
+	l, err := NewLinkMonitor(testConfig, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		silent    time.Duration
+		stage     Stage
+		escalated bool
+	}{
+		{0, LinkOK, false},
+		{10*time.Second - time.Millisecond, LinkOK, false},
+		{10 * time.Second, LinkLoiter, true},
+		{20 * time.Second, LinkLoiter, false},
+		{30 * time.Second, LinkReturn, true},
+		{30 * time.Second, LinkReturn, false},
+		{90*time.Second - time.Millisecond, LinkReturn, false},
+		{90 * time.Second, LinkLand, true},
+		{time.Hour, LinkLand, false},
+	} {
+		stage, escalated := l.Update(start.Add(step.silent))
+		if stage != step.stage || escalated != step.escalated {
+			t.Fatalf("after %v: %v %v, want %v %v", step.silent, stage, escalated, step.stage, step.escalated)
+		}
+	}
+}
+
+// a long gap between checks still goes through every stage, one per call
+func TestEscalationNeverSkips(t *testing.T) {
+	start := time.Unix(0, 0)
+	l, _ := NewLinkMonitor(testConfig, start)
+	late := start.Add(time.Hour)
+	for _, want := range []Stage{LinkLoiter, LinkReturn, LinkLand} {
+		if stage, escalated := l.Update(late); stage != want || !escalated {
+			t.Fatalf("%v %v, want %v escalated", stage, escalated, want)
+		}
+	}
+	if _, escalated := l.Update(late); escalated {
+		t.Error("escalated past land")
+	}
+}
+
+func TestContact(t *testing.T) {
+	start := time.Unix(0, 0)
+	l, _ := NewLinkMonitor(testConfig, start)
+	l.Update(start.Add(10 * time.Second))
+	l.Update(start.Add(30 * time.Second))
+
+	if previous := l.Contact(start.Add(40 * time.Second)); previous != LinkReturn {
+		t.Errorf("regained from %v, want %v", previous, LinkReturn)
+	}
+	if l.Stage() != LinkOK || l.Silence(start.Add(45*time.Second)) != 5*time.Second {
+		t.Errorf("stage %v, silent %v after contact", l.Stage(), l.Silence(start.Add(45*time.Second)))
+	}
+	// the timeouts count from the contact
+	if stage, _ := l.Update(start.Add(49 * time.Second)); stage != LinkOK {
+		t.Errorf("%v 9s after contact", stage)
+	}
+	if stage, _ := l.Update(start.Add(50 * time.Second)); stage != LinkLoiter {
+		t.Errorf("%v 10s after contact, want loiter", stage)
+	}
+	if previous := l.Contact(start.Add(51 * time.Second)); previous != LinkLoiter {
+		t.Errorf("regained from %v, want loiter", previous)
+	}
+	if previous := l.Contact(start.Add(52 * time.Second)); previous != LinkOK {
+		t.Errorf("second contact regained from %v", previous)
+	}
+}
+
+func TestLinkConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config LinkConfig
+		ok     bool
+	}{
+		{"default", DefaultLinkConfig(), true},
+		{"no loiter", LinkConfig{0, time.Minute, 2 * time.Minute}, false},
+		{"return before loiter", LinkConfig{time.Minute, time.Minute, 2 * time.Minute}, false},
+		{"land before return", LinkConfig{time.Minute, 2 * time.Minute, time.Minute}, false},
+	} {
+		if _, err := NewLinkMonitor(tc.config, time.Unix(0, 0)); (err == nil) != tc.ok {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package flightmode
+
+type Mode byte
+
+const (
+	Idle Mode = iota
+	Armed
+	Takeoff
+	Cruise
+	Loiter
+	RTL
+	Land
+	Manual
+)
+
+var modeNames = [...]string{
+	Idle:    "idle",
+	Armed:   "armed",
+	Takeoff: "takeoff",
+	Cruise:  "cruise",
+	Loiter:  "loiter",
+	RTL:     "rtl",
+	Land:    "land",
+	Manual:  "manual",
+}
+
+// every transition not listed here is refused
+var allowed = map[Mode][]Mode{
+	Idle:    {Armed, Manual},
+	Armed:   {Idle, Takeoff, Manual},
+	Takeoff: {Cruise, Loiter, RTL, Land, Manual},
+	Cruise:  {Loiter, RTL, Land, Manual},
+	Loiter:  {Cruise, RTL, Land, Manual},
+	RTL:     {Cruise, Loiter, Land, Manual},
+	Land:    {Idle, Cruise, Loiter, Manual}, // cruise/loiter are go-arounds
+	Manual:  {Idle, Armed, Cruise, Loiter, RTL, Land},
+}
+
+// how many transitions History keeps
+const historySize = 64
@@ -0,0 +1,168 @@
+package flightmode
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTransition = errors.New("transition not allowed")
+
+type Transition struct {
+	From, To Mode
+	Reason   string
+	Time     time.Time
+}
+
+type Hook func(t Transition)
+
+// guards can veto a transition that the table allows, e.g. takeoff without a gps fix
+type Guard func(from Mode) error
+
+// safe for concurrent use, hooks are called without the lock held
+// so they may query the machine or even transition again
+type Machine struct {
+	mu    sync.Mutex
+	mode  Mode
+	since time.Time
+
+	guards   map[Mode][]Guard
+	onEnter  map[Mode][]Hook
+	onExit   map[Mode][]Hook
+	onChange []Hook
+
+	history []Transition
+	next    int
+}
+
+func New() *Machine {
+	return &Machine{
+		mode:    Idle,
+		since:   time.Now(),
+		guards:  make(map[Mode][]Guard),
+		onEnter: make(map[Mode][]Hook),
+		onExit:  make(map[Mode][]Hook),
+	}
+}
+
+func (m Mode) String() string {
+	if int(m) < len(modeNames) {
+		return modeNames[m]
+	}
+	return fmt.Sprintf("mode(%d)", byte(m))
+}
+
+// whether the plane is (or may be) off the ground
+func (m Mode) Airborne() bool {
+	return m != Idle && m != Armed
+}
+
+func (m *Machine) Mode() Mode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode
+}
+
+// when the current mode was entered
+func (m *Machine) Since() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.since
+}
+
+func (m *Machine) CanTransition(to Mode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(to)
+}
+
+// moving to the current mode is a no-op
+func (m *Machine) Transition(to Mode, reason string) error {
+	m.mu.Lock()
+	if m.mode == to {
+		m.mu.Unlock()
+		return nil
+	}
+	if err := m.check(to); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	t := Transition{From: m.mode, To: to, Reason: reason, Time: time.Now()}
+	m.mode = to
+	m.since = t.Time
+	m.record(t)
+
+	hooks := append([]Hook(nil), m.onExit[t.From]...)
+	hooks = append(hooks, m.onEnter[t.To]...)
+	hooks = append(hooks, m.onChange...)
+	m.mu.Unlock()
+
+	for _, h := range hooks {
+		h(t)
+	}
+	return nil
+}
+
+func (m *Machine) check(to Mode) error {
+	permitted := false
+	for _, candidate := range allowed[m.mode] {
+		if candidate == to {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return fmt.Errorf("%w: %v -> %v", ErrInvalidTransition, m.mode, to)
+	}
+	for _, g := range m.guards[to] {
+		if err := g(m.mode); err != nil {
+			return fmt.Errorf("%v -> %v: %w", m.mode, to, err)
+		}
+	}
+	return nil
+}
+
+func (m *Machine) record(t Transition) {
+	if len(m.history) < historySize {
+		m.history = append(m.history, t)
+		return
+	}
+	m.history[m.next] = t
+	m.next = (m.next + 1) % historySize
+}
+
+func (m *Machine) AddGuard(to Mode, g Guard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.guards[to] = append(m.guards[to], g)
+}
+
+func (m *Machine) OnEnter(mode Mode, h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEnter[mode] = append(m.onEnter[mode], h)
+}
+
+func (m *Machine) OnExit(mode Mode, h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExit[mode] = append(m.onExit[mode], h)
+}
+
+// called after every transition, after the enter and exit hooks
+func (m *Machine) OnChange(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = append(m.onChange, h)
+}
+
+// last transitions, oldest first
+func (m *Machine) History() []Transition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Transition, 0, len(m.history))
+	out = append(out, m.history[m.next:]...)
+	return append(out, m.history[:m.next]...)
+}
@@ -0,0 +1,127 @@
+package flightmode
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	for _, tc := range []struct {
+		path []Mode
+		ok   bool
+	}{
+		{[]Mode{Armed, Takeoff, Cruise, Loiter, RTL, Land, Idle}, true},
+		{[]Mode{Armed, Idle}, true},
+		{[]Mode{Manual, Idle}, true},
+		{[]Mode{Armed, Takeoff, Cruise, Land, Cruise}, true}, // a go-around
+		{[]Mode{Takeoff}, false},
+		{[]Mode{Cruise}, false},
+		{[]Mode{Armed, Takeoff, Idle}, false},
+		{[]Mode{Armed, Takeoff, Cruise, Idle}, false},
+		{[]Mode{Armed, Takeoff, Cruise, Armed}, false},
+	} {
+		m := New()
+		var err error
+		for _, to := range tc.path {
+			if err = m.Transition(to, "test"); err != nil {
+				break
+			}
+		}
+		if tc.ok != (err == nil) {
+			t.Errorf("%v: %v", tc.path, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%v: %v, want ErrInvalidTransition", tc.path, err)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	m := New()
+	noFix := errors.New("no gps fix")
+	var asked []Mode
+	m.AddGuard(Armed, func(from Mode) error {
+		asked = append(asked, from)
+		return noFix
+	})
+	if err := m.Transition(Armed, "test"); !errors.Is(err, noFix) {
+		t.Errorf("vetoed with %v, want the guard's error", err)
+	}
+	if err := m.CanTransition(Armed); !errors.Is(err, noFix) {
+		t.Errorf("CanTransition = %v, want the guard's error", err)
+	}
+	if m.Mode() != Idle || len(m.History()) != 0 {
+		t.Errorf("moved to %v after a veto", m.Mode())
+	}
+	if !slices.Equal(asked, []Mode{Idle, Idle}) {
+		t.Errorf("guard asked from %v", asked)
+	}
+
+	// the table is checked first, a guard never sees a refused transition
+	asked = nil
+	m.AddGuard(Cruise, func(Mode) error { asked = append(asked, Cruise); return nil })
+	if err := m.Transition(Cruise, "test"); !errors.Is(err, ErrInvalidTransition) || asked != nil {
+		t.Errorf("idle -> cruise: %v, guard asked %v", err, asked)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	m := New()
+	var calls []string
+	hook := func(name string) Hook {
+		return func(tr Transition) { calls = append(calls, name+" "+tr.From.String()+">"+tr.To.String()) }
+	}
+	m.OnChange(hook("change"))
+	m.OnEnter(Armed, hook("enter"))
+	m.OnExit(Idle, hook("exit"))
+	m.OnEnter(Takeoff, hook("enter"))
+
+	m.Transition(Armed, "test")
+	// no-op, no hooks
+	m.Transition(Armed, "again")
+	want := []string{"exit idle>armed", "enter idle>armed", "change idle>armed"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("hooks %v, want %v", calls, want)
+	}
+
+	// hooks run without the lock, one may move on again
+	calls = nil
+	m.OnEnter(Takeoff, func(Transition) { m.Transition(Cruise, "airborne") })
+	m.Transition(Takeoff, "test")
+	if m.Mode() != Cruise {
+		t.Errorf("mode %v, want cruise after the hook's transition", m.Mode())
+	}
+	want = []string{"enter armed>takeoff", "change takeoff>cruise", "change armed>takeoff"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("hooks %v, want %v", calls, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	m := New()
+	m.Transition(Armed, "first")
+	for range historySize {
+		if m.Mode() == Armed {
+			m.Transition(Idle, "disarm")
+		} else {
+			m.Transition(Armed, "arm")
+		}
+	}
+	history := m.History()
+	if len(history) != historySize {
+		t.Fatalf("%d kept, want %d", len(history), historySize)
+	}
+	// the first one dropped out, the rest alternate up to the current mode
+	if history[0].Reason == "first" {
+		t.Error("oldest transition still kept")
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].From != history[i-1].To {
+			t.Fatalf("history out of order at %d: %v", i, history[i-1:i+1])
+		}
+	}
+	if last := history[len(history)-1]; last.To != m.Mode() {
+		t.Errorf("last transition to %v, mode %v", last.To, m.Mode())
+	}
+}
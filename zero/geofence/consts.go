@@ -0,0 +1,11 @@
+package geofence
+
+const (
+	// what Storage keeps the fence under
+	StorageName = "fence.bin"
+
+	// altitude targets are kept this far inside the altitude limits, meters
+	AltitudeMargin = 5
+
+	degToRad = 0.017453292519943295
+)
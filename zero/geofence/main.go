@@ -0,0 +1,310 @@
+package geofence
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"zero/nav"
+
+	"protocol"
+)
+
+// where the plane may fly: inside every inclusion polygon, outside every exclusion polygon
+// and circle, and between the altitude limits. polygons are tested on plain lat/long, which
+// is exact enough for a flying field and anywhere away from the poles and the antimeridian
+
+var (
+	ErrBadPolygon = errors.New("geofence: polygon needs at least 3 vertices")
+	ErrOverlap    = errors.New("geofence: chunk overlaps another")
+	ErrChecksum   = errors.New("geofence: checksum mismatch")
+)
+
+// bits of what the plane is breaching
+type Breach byte
+
+const (
+	BreachInclusion Breach = 1 << iota
+	BreachExclusion
+	BreachMinAltitude
+	BreachMaxAltitude
+)
+
+var breachNames = [...]string{"inclusion", "exclusion", "min altitude", "max altitude"}
+
+func (b Breach) String() string {
+	if b == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range breachNames {
+		if b&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+type point struct{ lat, long float64 }
+
+type circle struct {
+	center point
+	radius float64
+}
+
+type Fence struct {
+	mu       sync.Mutex
+	limits   protocol.FenceLimits
+	items    []protocol.FenceItem
+	checksum uint16
+
+	inclusions, exclusions [][]point
+	circles                []circle
+}
+
+func New() *Fence {
+	return &Fence{checksum: protocol.FenceChecksum(protocol.FenceLimits{}, nil)}
+}
+
+// replaces the fence, the old one stays if the new one doesn't make sense
+func (f *Fence) Set(limits protocol.FenceLimits, items []protocol.FenceItem) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	var inclusions, exclusions [][]point
+	var circles []circle
+	// vertices are grouped by type and zone, in the order the zones first show up
+	zones := map[[2]byte]int{}
+	for _, item := range items {
+		if err := item.Validate(); err != nil {
+			return err
+		}
+		p := point{item.Latitude, item.Longitude}
+		switch item.Type {
+		case protocol.FenceItem_exclusionCircle:
+			circles = append(circles, circle{p, float64(item.Radius)})
+			continue
+		case protocol.FenceItem_inclusion:
+			key := [2]byte{item.Type, item.Zone}
+			if _, ok := zones[key]; !ok {
+				zones[key] = len(inclusions)
+				inclusions = append(inclusions, nil)
+			}
+			inclusions[zones[key]] = append(inclusions[zones[key]], p)
+		case protocol.FenceItem_exclusion:
+			key := [2]byte{item.Type, item.Zone}
+			if _, ok := zones[key]; !ok {
+				zones[key] = len(exclusions)
+				exclusions = append(exclusions, nil)
+			}
+			exclusions[zones[key]] = append(exclusions[zones[key]], p)
+		}
+	}
+	for _, polygon := range append(inclusions, exclusions...) {
+		if len(polygon) < 3 {
+			return ErrBadPolygon
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limits = limits
+	f.items = append([]protocol.FenceItem(nil), items...)
+	f.checksum = protocol.FenceChecksum(limits, f.items)
+	f.inclusions, f.exclusions, f.circles = inclusions, exclusions, circles
+	return nil
+}
+
+func (f *Fence) Limits() protocol.FenceLimits {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.limits
+}
+
+func (f *Fence) Items() []protocol.FenceItem {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]protocol.FenceItem(nil), f.items...)
+}
+
+func (f *Fence) Checksum() uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checksum
+}
+
+// whether there is anything to check at all
+func (f *Fence) Enabled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.items) > 0 || f.limits.MinAltitude != f.limits.MaxAltitude
+}
+
+func (f *Fence) Check(lat, long, alt float64) Breach {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var b Breach
+	p := point{lat, long}
+	for _, polygon := range f.inclusions {
+		if !inside(p, polygon) {
+			b |= BreachInclusion
+		}
+	}
+	for _, polygon := range f.exclusions {
+		if inside(p, polygon) {
+			b |= BreachExclusion
+		}
+	}
+	for _, c := range f.circles {
+		if nav.Distance(lat, long, c.center.lat, c.center.long) < c.radius {
+			b |= BreachExclusion
+		}
+	}
+	if f.limits.MinAltitude != f.limits.MaxAltitude {
+		if alt < float64(f.limits.MinAltitude) {
+			b |= BreachMinAltitude
+		}
+		if alt > float64(f.limits.MaxAltitude) {
+			b |= BreachMaxAltitude
+		}
+	}
+	return b
+}
+
+// how far the nearest polygon edge or circle is from a point, meters, whichever side of it the
+// point is on. infinite without any
+func (f *Fence) Clearance(lat, long float64) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := point{lat, long}
+	clearance := math.Inf(1)
+	for _, polygon := range append(f.inclusions[:len(f.inclusions):len(f.inclusions)], f.exclusions...) {
+		for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+			clearance = min(clearance, edgeDistance(p, polygon[j], polygon[i]))
+		}
+	}
+	for _, c := range f.circles {
+		clearance = min(clearance, math.Abs(nav.Distance(lat, long, c.center.lat, c.center.long)-c.radius))
+	}
+	return clearance
+}
+
+// from p to the segment a-b, flat around p like the ray casting
+func edgeDistance(p, a, b point) float64 {
+	scale := math.Cos(p.lat * degToRad)
+	ax, ay := (a.long-p.long)*scale, a.lat-p.lat
+	bx, by := (b.long-p.long)*scale, b.lat-p.lat
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if d := dx*dx + dy*dy; d > 0 {
+		t = max(0, min(1, -(ax*dx+ay*dy)/d))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy) * degToRad * nav.EarthRadius
+}
+
+// moves an altitude target inside the limits by AltitudeMargin, or to the middle of them
+// when they are closer together than that
+func (f *Fence) ClampAltitude(alt float32) float32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lo, hi := f.limits.MinAltitude, f.limits.MaxAltitude
+	if lo == hi {
+		return alt
+	}
+	if hi-lo < 2*AltitudeMargin {
+		return (lo + hi) / 2
+	}
+	return max(lo+AltitudeMargin, min(alt, hi-AltitudeMargin))
+}
+
+// ray casting. it is half open like pixels on a screen: a point on a south or west edge is
+// inside, one on a north or east edge outside, so polygons sharing an edge don't overlap on it
+func inside(p point, polygon []point) bool {
+	in := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.lat > p.lat) != (b.lat > p.lat) &&
+			p.long < (b.long-a.long)*(p.lat-a.lat)/(b.lat-a.lat)+a.long {
+			in = !in
+		}
+	}
+	return in
+}
+
+// stored as the checksum followed by the fence in its over the air encoding
+func Marshal(limits protocol.FenceLimits, items []protocol.FenceItem) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, protocol.FenceChecksum(limits, items))
+	return append(buf, protocol.EncodeFence(limits, items)...)
+}
+
+func Unmarshal(data []byte) (protocol.FenceLimits, []protocol.FenceItem, error) {
+	if len(data) < 2 {
+		return protocol.FenceLimits{}, nil, fmt.Errorf("geofence: stored fence of %d bytes", len(data))
+	}
+	limits, items, err := protocol.DecodeFence(data[2:])
+	if err != nil {
+		return protocol.FenceLimits{}, nil, err
+	}
+	if protocol.FenceChecksum(limits, items) != binary.BigEndian.Uint16(data[:2]) {
+		return protocol.FenceLimits{}, nil, ErrChecksum
+	}
+	return limits, items, nil
+}
+
+// collects the chunks of an upload in any order and takes repeats again, like mission.Upload
+type Upload struct {
+	count    byte
+	checksum uint16
+	// from the chunk at index 0
+	limits     protocol.FenceLimits
+	haveLimits bool
+	// by index, nil until the first chunk
+	chunks   map[byte][]protocol.FenceItem
+	received int
+	// the upload of this count and checksum is complete, its chunks are only repeats
+	done bool
+}
+
+// complete is true with the whole fence once every chunk is in and the checksum matches, the
+// limits are the ones of the chunk at index 0. a chunk of another count or checksum starts a
+// new upload
+func (u *Upload) Add(c protocol.FenceChunk) (limits protocol.FenceLimits, items []protocol.FenceItem, complete bool, err error) {
+	if u.chunks == nil || c.Count != u.count || c.Checksum != u.checksum {
+		u.count, u.checksum = c.Count, c.Checksum
+		u.chunks, u.received, u.haveLimits, u.done = make(map[byte][]protocol.FenceItem), 0, false, false
+	}
+	if _, seen := u.chunks[c.Index]; seen || u.done {
+		return protocol.FenceLimits{}, nil, false, nil
+	}
+	// only an empty fence is uploaded as an empty chunk, anywhere else it adds nothing
+	if len(c.Items) > 0 {
+		end := int(c.Index) + len(c.Items)
+		for index, chunk := range u.chunks {
+			if int(c.Index) < int(index)+len(chunk) && int(index) < end {
+				return protocol.FenceLimits{}, nil, false,
+					fmt.Errorf("%w: %d items at %d, %d at %d", ErrOverlap, len(c.Items), c.Index, len(chunk), index)
+			}
+		}
+		u.chunks[c.Index] = append([]protocol.FenceItem(nil), c.Items...)
+		u.received += len(c.Items)
+	}
+	if c.Index == 0 {
+		u.limits, u.haveLimits = c.Limits, true
+	}
+	if !u.haveLimits || u.received < int(u.count) {
+		return protocol.FenceLimits{}, nil, false, nil
+	}
+
+	// none overlap and all end within the count, so they follow on from each other
+	for len(items) < int(u.count) {
+		items = append(items, u.chunks[byte(len(items))]...)
+	}
+	if protocol.FenceChecksum(u.limits, items) != u.checksum {
+		u.chunks = nil
+		return protocol.FenceLimits{}, nil, false, ErrChecksum
+	}
+	u.chunks, u.done = map[byte][]protocol.FenceItem{}, true
+	return u.limits, items, true, nil
+}
@@ -0,0 +1,206 @@
+package geofence
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"protocol"
+)
+
+var testLimits = protocol.FenceLimits{MinAltitude: 20, MaxAltitude: 120, Action: protocol.FenceAction_rtl}
+
+// a square 0.01° on a side around 48.1/11.5, one vertex per item so it takes two chunks
+func testSquare(n int) []protocol.FenceItem {
+	items := make([]protocol.FenceItem, n)
+	for i := range items {
+		items[i] = protocol.FenceItem{Type: protocol.FenceItem_inclusion, Latitude: 48.1 + float64(i%2)*0.01, Longitude: 11.5 + float64(i/2%2)*0.01}
+	}
+	return items
+}
+
+func TestUploadOutOfOrder(t *testing.T) {
+	items := testSquare(12)
+	chunks, err := protocol.SplitFence(testLimits, items)
+	if err != nil || len(chunks) != 2 {
+		t.Fatalf("%d chunks, %v", len(chunks), err)
+	}
+
+	var u Upload
+	for _, c := range []protocol.FenceChunk{chunks[1], chunks[1]} {
+		if _, _, complete, err := u.Add(c); complete || err != nil {
+			t.Fatalf("chunk at %d: %v %v", c.Index, complete, err)
+		}
+	}
+	limits, got, complete, err := u.Add(chunks[0])
+	if err != nil || !complete || limits != testLimits || !reflect.DeepEqual(got, items) {
+		t.Fatalf("after the first chunk: %+v %v %v", limits, complete, err)
+	}
+	if _, _, complete, err := u.Add(chunks[1]); complete || err != nil {
+		t.Errorf("repeat after completing: %v %v", complete, err)
+	}
+
+	// clearing is one empty chunk
+	chunks, _ = protocol.SplitFence(protocol.FenceLimits{}, nil)
+	if _, got, complete, err := u.Add(chunks[0]); !complete || err != nil || len(got) != 0 {
+		t.Errorf("clearing: %v %v %v", got, complete, err)
+	}
+}
+
+// offsets of 0.01° from 48.1/11.5, so about 1.1km north and 740m east
+func at(north, east float64) (lat, long float64) {
+	return 48.1 + north*0.01, 11.5 + east*0.01
+}
+
+func polygon(kind byte, zone byte, vertices ...[2]float64) []protocol.FenceItem {
+	items := make([]protocol.FenceItem, len(vertices))
+	for i, v := range vertices {
+		lat, long := at(v[0], v[1])
+		items[i] = protocol.FenceItem{Type: kind, Zone: zone, Latitude: lat, Longitude: long}
+	}
+	return items
+}
+
+func TestCheckPolygon(t *testing.T) {
+	// a square with a notch cut into it from the north, its tip at 1/2
+	notched := polygon(protocol.FenceItem_inclusion, 0,
+		[2]float64{0, 0}, [2]float64{0, 4}, [2]float64{2, 4}, [2]float64{2, 2.5},
+		[2]float64{1, 2}, [2]float64{2, 1.5}, [2]float64{2, 0})
+	f := New()
+	if err := f.Set(protocol.FenceLimits{}, notched); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name        string
+		north, east float64
+		want        Breach
+	}{
+		{"inside", 0.5, 1, 0},
+		{"in the notch", 1.5, 2, BreachInclusion},
+		{"below the notch", 0.5, 2, 0},
+		{"north", 3, 1, BreachInclusion},
+		{"east", 1, 5, BreachInclusion},
+		// the ray east runs through the tip of the notch, which must not count as a crossing
+		{"level with the tip, west of it", 1, 1, 0},
+		{"level with the tip, east of it", 1, 3, 0},
+		{"level with the tip, outside", 1, -1, BreachInclusion},
+		// through both corners of the notch's mouth
+		{"level with the mouth, outside", 2, -1, BreachInclusion},
+		{"level with the mouth, in the notch", 2, 2, BreachInclusion},
+		{"south edge", 0, 1, 0},
+		{"west edge", 1, 0, 0},
+		{"north edge", 2, 1, BreachInclusion},
+		{"east edge", 1, 4, BreachInclusion},
+		{"southwest corner", 0, 0, 0},
+		{"northeast corner", 2, 4, BreachInclusion},
+		// the east side of the notch is a west edge of what is inside
+		{"tip of the notch", 1, 2, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lat, long := at(tc.north, tc.east)
+			if got := f.Check(lat, long, 0); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckExclusion(t *testing.T) {
+	items := polygon(protocol.FenceItem_inclusion, 0,
+		[2]float64{0, 0}, [2]float64{0, 4}, [2]float64{4, 4}, [2]float64{4, 0})
+	// two zones so their vertices don't run together
+	items = append(items, polygon(protocol.FenceItem_exclusion, 0,
+		[2]float64{1, 1}, [2]float64{1, 2}, [2]float64{2, 2}, [2]float64{2, 1})...)
+	items = append(items, polygon(protocol.FenceItem_exclusion, 1,
+		[2]float64{1, 2.5}, [2]float64{1, 3.5}, [2]float64{2, 3})...)
+	lat, long := at(3, 3)
+	items = append(items, protocol.FenceItem{Type: protocol.FenceItem_exclusionCircle, Latitude: lat, Longitude: long, Radius: 200})
+	f := New()
+	if err := f.Set(protocol.FenceLimits{}, items); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name        string
+		north, east float64
+		want        Breach
+	}{
+		{"clear", 0.5, 0.5, 0},
+		{"in the square zone", 1.5, 1.5, BreachExclusion},
+		{"in the triangle zone", 1.2, 3, BreachExclusion},
+		{"between the zones", 1.5, 2.2, 0},
+		{"in the circle", 3.1, 3, BreachExclusion},
+		// 0.3 north is 330m, past the radius
+		{"next to the circle", 3.3, 3, 0},
+		{"out of the inclusion", 5, 5, BreachInclusion},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lat, long := at(tc.north, tc.east)
+			if got := f.Check(lat, long, 0); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckAltitude(t *testing.T) {
+	f := New()
+	lat, long := at(0, 0)
+	if got := f.Check(lat, long, -1000); got != 0 || f.Enabled() {
+		t.Errorf("without a fence: %v, enabled %v", got, f.Enabled())
+	}
+	if err := f.Set(testLimits, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled() {
+		t.Error("altitude limits alone not enabled")
+	}
+	for _, tc := range []struct {
+		alt  float64
+		want Breach
+	}{
+		{19, BreachMinAltitude},
+		{20, 0},
+		{70, 0},
+		{120, 0},
+		{121, BreachMaxAltitude},
+	} {
+		if got := f.Check(lat, long, tc.alt); got != tc.want {
+			t.Errorf("at %vm got %v, want %v", tc.alt, got, tc.want)
+		}
+	}
+	if got := f.Check(lat, long, 10).String(); got != "min altitude" {
+		t.Errorf("breach named %q", got)
+	}
+}
+
+func TestClearance(t *testing.T) {
+	f := New()
+	lat, long := at(0.5, 0.5)
+	if got := f.Clearance(lat, long); !math.IsInf(got, 1) {
+		t.Errorf("without a fence: %v", got)
+	}
+	items := polygon(protocol.FenceItem_inclusion, 0,
+		[2]float64{0, 0}, [2]float64{0, 1}, [2]float64{1, 1}, [2]float64{1, 0})
+	circleLat, circleLong := at(0.5, 0.5)
+	items = append(items, protocol.FenceItem{Type: protocol.FenceItem_exclusionCircle, Latitude: circleLat, Longitude: circleLong, Radius: 100})
+	if err := f.Set(protocol.FenceLimits{}, items); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name        string
+		north, east float64
+		want        float64
+	}{
+		{"near the south edge", 0.05, 0.5, 0.05 * 1111.95},
+		{"near the west edge", 0.5, 0.02, 0.02 * 1111.95 * math.Cos(48.105*math.Pi/180)},
+		{"outside past a corner", -0.03, -0.04, math.Hypot(0.03*1111.95, 0.04*1111.95*math.Cos(48.1*math.Pi/180))},
+		{"near the circle", 0.5, 0.5 + 150/(1111.95*math.Cos(48.105*math.Pi/180)), 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lat, long := at(tc.north, tc.east)
+			if got := f.Clearance(lat, long); math.Abs(got-tc.want) > 1 {
+				t.Errorf("%.1fm, want %.1f", got, tc.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,9 @@ require (
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 	periph.io/x/conn/v3 v3.7.2
 	periph.io/x/host/v3 v3.8.5
+	protocol v0.0.0-00010101000000-000000000000
 )
 
 require golang.org/x/sys v0.34.0 // indirect
+
+replace protocol => ../protocol
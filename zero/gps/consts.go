@@ -1,5 +1,7 @@
 package gps
 
+import "time"
+
 const (
 	PrefixGGA = "$GNGGA"
 	PrefixRMC = "$GNRMC"
@@ -11,6 +13,12 @@ const (
 	FixQualityDGPS    = "2" // differential gps fix
 )
 
+const (
+	knotsToMS = 0.514444
+	// older than a few fixes is not worth steering by
+	velocityMaxAge = 3 * time.Second
+)
+
 const (
 	RMCValidityValid   = 'A'
 	RMCValidityInvalid = 'V'
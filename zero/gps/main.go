@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/adrianmo/go-nmea"
@@ -14,6 +15,12 @@ import (
 type NEO6M struct {
 	port   *serial.Port
 	reader *bufio.Reader
+
+	// from the last valid RMC sentence seen while reading positions
+	velocityMu  sync.Mutex
+	groundSpeed float64
+	course      float64
+	velocityAt  time.Time
 }
 
 func New(portName string, baud int, readTimeout time.Duration) (*NEO6M, error) {
@@ -58,10 +65,29 @@ func (n *NEO6M) LatLongAlt() (float64, float64, float64, error) {
 				return 0, 0, 0, errors.New("fix not available")
 			}
 			return sentence.Latitude, sentence.Longitude, sentence.Altitude, nil
+		case nmea.RMC:
+			if sentence.Validity == string(RMCValidityValid) {
+				n.velocityMu.Lock()
+				n.groundSpeed = sentence.Speed * knotsToMS
+				n.course = sentence.Course
+				n.velocityAt = time.Now()
+				n.velocityMu.Unlock()
+			}
 		}
 	}
 }
 
+// ground speed in m/s and course over ground in degrees from true north, as of the last
+// RMC sentence LatLongAlt went past
+func (n *NEO6M) Velocity() (groundSpeed, course float64, err error) {
+	n.velocityMu.Lock()
+	defer n.velocityMu.Unlock()
+	if n.velocityAt.IsZero() || time.Since(n.velocityAt) > velocityMaxAge {
+		return 0, 0, errors.New("no recent velocity")
+	}
+	return n.groundSpeed, n.course, nil
+}
+
 func (n *NEO6M) Close() error {
 	return n.port.Close()
 }
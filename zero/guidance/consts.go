@@ -0,0 +1,11 @@
+package guidance
+
+const (
+	gravity = 9.81 // m/s^2
+
+	// below this ground speed the velocity direction means nothing, the heading is used instead
+	minGroundSpeed = 1 // m/s
+
+	degToRad = 0.017453292519943295
+	radToDeg = 57.29577951308232
+)
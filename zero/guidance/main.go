@@ -0,0 +1,164 @@
+package guidance
+
+import (
+	"math"
+	"zero/nav"
+)
+
+// L1 nonlinear lateral guidance (Park, Deyst, How), the same scheme ArduPilot flies.
+// a reference point L1 meters ahead on the path is chased with a lateral acceleration
+// of 2 V² sin(eta) / L1, which follows straight legs and circles alike and copes with wind
+// because it works on the ground velocity. positions are lat/long, accelerations are m/s²
+// with positive meaning a right turn
+
+type L1 struct {
+	// how long a full oscillation around the path takes, seconds, larger is gentler
+	Period float64
+	// 0.7..0.85, lower turns in harder
+	Damping float64
+}
+
+// where the plane is and how it is moving over the ground
+type State struct {
+	Lat, Long   float64
+	GroundSpeed float64 // m/s
+	Course      float64 // degrees, direction of travel over the ground
+	Heading     float64 // degrees, used while too slow for the course to mean anything
+}
+
+// local north/east meters
+type vec struct{ n, e float64 }
+
+func (a vec) add(b vec) vec       { return vec{a.n + b.n, a.e + b.e} }
+func (a vec) cross(b vec) float64 { return a.n*b.e - a.e*b.n }
+func (a vec) dot(b vec) float64   { return a.n*b.n + a.e*b.e }
+func (a vec) length() float64     { return math.Hypot(a.n, a.e) }
+func (a vec) scale(k float64) vec { return vec{a.n * k, a.e * k} }
+
+func (a vec) unit() vec {
+	l := a.length()
+	if l == 0 {
+		return vec{}
+	}
+	return a.scale(1 / l)
+}
+
+// offset of (lat, long) from the plane in meters, flat earth is plenty over an L1 distance
+func offset(s State, lat, long float64) vec {
+	return vec{
+		n: (lat - s.Lat) * degToRad * nav.EarthRadius,
+		e: (long - s.Long) * degToRad * nav.EarthRadius * math.Cos(s.Lat*degToRad),
+	}
+}
+
+func (s State) velocity() vec {
+	if s.GroundSpeed < minGroundSpeed {
+		h := s.Heading * degToRad
+		return vec{math.Cos(h), math.Sin(h)}.scale(minGroundSpeed)
+	}
+	c := s.Course * degToRad
+	return vec{math.Cos(c), math.Sin(c)}.scale(s.GroundSpeed)
+}
+
+func (l L1) distance(speed float64) float64 {
+	return math.Max(l.Damping*l.Period*speed/math.Pi, 1)
+}
+
+func (l L1) gain() float64 {
+	return 4 * l.Damping * l.Damping
+}
+
+// follows the leg from (startLat, startLong) through (endLat, endLong), the line carries on past the end
+func (l L1) Leg(s State, startLat, startLong, endLat, endLong float64) float64 {
+	v := s.velocity()
+	speed := v.length()
+	l1 := l.distance(speed)
+
+	// plane relative to the start of the leg
+	a := offset(s, startLat, startLong).scale(-1)
+	ab := offset(s, endLat, endLong).add(a).unit()
+	if ab == (vec{}) {
+		// no leg to speak of, head for the end
+		return l.Point(s, endLat, endLong)
+	}
+
+	var eta float64
+	distA := a.length()
+	if distA > l1 && a.dot(ab)/math.Max(distA, 1) < -math.Sqrt2/2 {
+		// well behind the start, fly to it first
+		toA := a.unit().scale(-1)
+		eta = math.Atan2(v.cross(toA), v.dot(toA))
+	} else {
+		eta2 := math.Atan2(v.cross(ab), v.dot(ab))
+		sinEta1 := math.Max(-math.Sqrt2/2, math.Min(a.cross(ab)/l1, math.Sqrt2/2))
+		eta = math.Asin(sinEta1) + eta2
+	}
+	eta = math.Max(-math.Pi/2, math.Min(eta, math.Pi/2))
+	return l.gain() * speed * speed / l1 * math.Sin(eta)
+}
+
+// heads straight for a point, for when there is no leg yet
+func (l L1) Point(s State, lat, long float64) float64 {
+	v := s.velocity()
+	speed := v.length()
+	to := offset(s, lat, long).unit()
+	if to == (vec{}) {
+		return 0
+	}
+	eta := math.Atan2(v.cross(to), v.dot(to))
+	eta = math.Max(-math.Pi/2, math.Min(eta, math.Pi/2))
+	return l.gain() * speed * speed / l.distance(speed) * math.Sin(eta)
+}
+
+// circles (lat, long) at radius meters, clockwise seen from above unless counterClockwise.
+// from outside the circle it first captures it L1 style, on it a PD loop on the radius
+// error plus the centripetal term keeps it there
+func (l L1) Loiter(s State, lat, long, radius float64, counterClockwise bool) float64 {
+	dir := 1.0
+	if counterClockwise {
+		dir = -1
+	}
+	v := s.velocity()
+	speed := v.length()
+	l1 := l.distance(speed)
+
+	// center to plane
+	fromCenter := offset(s, lat, long).scale(-1)
+	dist := fromCenter.length()
+	outward := fromCenter.unit()
+	if outward == (vec{}) {
+		// right on the center, any direction out will do
+		outward = v.unit()
+	}
+
+	// capture, chase the center like a point
+	xtrackVelCap := outward.cross(v)
+	ltrackVelCap := -v.dot(outward)
+	eta := math.Max(-math.Pi/2, math.Min(math.Atan2(xtrackVelCap, ltrackVelCap), math.Pi/2))
+	capture := l.gain() * speed * speed / l1 * math.Sin(eta)
+
+	// circle
+	omega := 2 * math.Pi / l.Period
+	kx, kv := omega*omega, 2*l.Damping*omega
+	xtrackErr := dist - radius
+	xtrackVel := -ltrackVelCap
+	pd := xtrackErr*kx + xtrackVel*kv
+	tangentVel := xtrackVelCap * dir
+	if ltrackVelCap < 0 && tangentVel < 0 {
+		// going the wrong way round and away from the center, only ever pull in
+		pd = math.Max(pd, 0)
+	}
+	centripetal := tangentVel * tangentVel / math.Max(0.5*radius, radius+xtrackErr)
+	circle := dir * (pd + centripetal)
+
+	if xtrackErr > 0 && dir*capture < dir*circle {
+		return capture
+	}
+	return circle
+}
+
+// bank angle in degrees that turns with the lateral acceleration in a level turn, capped at maxBank
+func BankAngle(lateralAccel, maxBank float64) float64 {
+	bank := math.Atan(lateralAccel/gravity) * radToDeg
+	return math.Max(-maxBank, math.Min(bank, maxBank))
+}
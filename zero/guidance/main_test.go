@@ -0,0 +1,136 @@
+package guidance
+
+import (
+	"math"
+	"testing"
+	"zero/nav"
+)
+
+var testL1 = L1{Period: 17, Damping: 0.75}
+
+const originLat, originLong = 48.1, 11.5
+
+// lat/long of a point north and east of the origin, the inverse of offset
+func at(north, east float64) (lat, long float64) {
+	return originLat + north/(degToRad*nav.EarthRadius),
+		originLong + east/(degToRad*nav.EarthRadius*math.Cos(originLat*degToRad))
+}
+
+// a plane at constant speed turning with whatever acceleration it is asked for, up to a bank
+type point struct {
+	north, east, course, speed float64
+}
+
+func (p point) state() State {
+	lat, long := at(p.north, p.east)
+	return State{Lat: lat, Long: long, GroundSpeed: p.speed, Course: p.course, Heading: p.course}
+}
+
+func (p *point) fly(accel float64, dt float64) {
+	accel = gravity * math.Tan(BankAngle(accel, 30)*degToRad)
+	p.course = nav.Wrap360(p.course + accel/p.speed*dt*radToDeg)
+	c := p.course * degToRad
+	p.north += p.speed * math.Cos(c) * dt
+	p.east += p.speed * math.Sin(c) * dt
+}
+
+func TestLegAccel(t *testing.T) {
+	// L1 is Damping Period V / pi, about 61m at 15m/s
+	const speed = 15
+	l1 := testL1.Damping * testL1.Period * speed / math.Pi
+	k := 4 * testL1.Damping * testL1.Damping * speed * speed / l1
+	startLat, startLong := at(0, 0)
+	endLat, endLong := at(1000, 0)
+
+	for _, tc := range []struct {
+		name  string
+		plane point
+		want  float64
+	}{
+		{"on the line", point{100, 0, 0, speed}, 0},
+		// flying parallel, the reference point is asin(offset/L1) off the nose
+		{"10m right", point{100, 10, 0, speed}, -k * 10 / l1},
+		{"10m left", point{100, -10, 0, speed}, k * 10 / l1},
+		// far off the line the intercept angle is held at 45 degrees
+		{"200m right", point{100, 200, 0, speed}, -k * math.Sqrt2 / 2},
+		// on the line but pointing 30 degrees off it
+		{"heading off", point{100, 0, 30, speed}, -k * math.Sin(30*degToRad)},
+		// well behind the start it flies to the start first, that is straight ahead
+		{"behind", point{-500, 0, 0, speed}, 0},
+	} {
+		got := testL1.Leg(tc.plane.state(), startLat, startLong, endLat, endLong)
+		if math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("%s: %.3fm/s², want %.3f", tc.name, got, tc.want)
+		}
+	}
+}
+
+// from 150m off a leg it settles onto it without overshooting much
+func TestLegCapture(t *testing.T) {
+	startLat, startLong := at(0, 0)
+	endLat, endLong := at(10000, 0)
+	p := point{0, 150, 0, 15}
+	least := p.east
+	for range 900 {
+		p.fly(testL1.Leg(p.state(), startLat, startLong, endLat, endLong), 0.1)
+		least = math.Min(least, p.east)
+	}
+	if math.Abs(p.east) > 1 || math.Abs(nav.HeadingError(0, p.course)) > 1 {
+		t.Errorf("%.1fm off the leg at %.1f° after 90s", p.east, p.course)
+	}
+	if least < -15 {
+		t.Errorf("overshot the leg by %.1fm", -least)
+	}
+}
+
+// from outside it joins the circle and goes round the asked way at the radius
+func TestLoiterCapture(t *testing.T) {
+	const radius = 60
+	centerLat, centerLong := at(0, 0)
+	for _, tc := range []struct {
+		name             string
+		start            point
+		counterClockwise bool
+	}{
+		{"clockwise from the south", point{-400, 50, 0, 15}, false},
+		{"counter clockwise from the south", point{-400, 50, 0, 15}, true},
+		{"clockwise heading away", point{-300, 0, 180, 15}, false},
+		{"from the center", point{0, 0, 90, 15}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.start
+			for range 1200 {
+				p.fly(testL1.Loiter(p.state(), centerLat, centerLong, radius, tc.counterClockwise), 0.1)
+			}
+			// a last lap, it stays on the circle going round one way
+			for range 300 {
+				p.fly(testL1.Loiter(p.state(), centerLat, centerLong, radius, tc.counterClockwise), 0.1)
+				if d := math.Hypot(p.north, p.east); math.Abs(d-radius) > 5 {
+					t.Fatalf("%.1fm from the center, want %vm", d, radius)
+				}
+				c := p.course * degToRad
+				round := p.north*math.Sin(c) - p.east*math.Cos(c) // radius cross velocity
+				if (round > 0) == tc.counterClockwise {
+					t.Fatalf("going round the wrong way at %.0f/%.0f course %.0f", p.north, p.east, p.course)
+				}
+			}
+		})
+	}
+}
+
+func TestBankAngle(t *testing.T) {
+	for _, tc := range []struct {
+		accel, maxBank, want float64
+	}{
+		{0, 60, 0},
+		{gravity, 60, 45},
+		{-gravity, 60, -45},
+		{gravity * math.Tan(20*degToRad), 60, 20},
+		{gravity, 30, 30},
+		{-gravity, 30, -30},
+	} {
+		if got := BankAngle(tc.accel, tc.maxBank); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("BankAngle(%v, %v) = %v, want %v", tc.accel, tc.maxBank, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package gyroscope
+
+// the chip sits flat with its y axis towards the nose, x towards the right wing and z up.
+// with OrientAndroid its x rate is the pitch rate, y the roll rate and z turns the opposite way
+// to the heading. BodyFrame hands out rates and accelerations around and along the airframe's
+// forward, right and down axes instead, like hal.AttitudeSensor wants them
+type BodyFrame struct {
+	*BNO055
+}
+
+func (b BodyFrame) ReadAngularVelocity() (roll, pitch, yaw float32, err error) {
+	x, y, z, err := b.BNO055.ReadAngularVelocity()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	roll, pitch, yaw = toBody(x, y, z)
+	return roll, pitch, yaw, nil
+}
+
+func (b BodyFrame) ReadLinearAccel() (forward, right, down float32, err error) {
+	x, y, z, err := b.BNO055.ReadLinearAccel()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	forward, right, down = toBody(x, y, z)
+	return forward, right, down, nil
+}
+
+// the same for rates, a rate around an axis is along it
+func toBody(x, y, z float32) (forward, right, down float32) {
+	return y, x, -z
+}
@@ -0,0 +1,69 @@
+package gyroscope
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+// a BNO055 that answers one read of start with the three little endian words
+func playback(start byte, x, y, z int16) *BNO055 {
+	buf := make([]byte, 6)
+	binary.LittleEndian.PutUint16(buf[0:2], uint16(x))
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(y))
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(z))
+	bus := &i2ctest.Playback{Ops: []i2ctest.IO{{Addr: BNO055_Address, W: []byte{start}, R: buf}}}
+	return &BNO055{dev: i2c.Dev{Bus: bus, Addr: BNO055_Address}, unitSel: GyrDPS | AccMS2}
+}
+
+func TestBodyFrameRates(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		x, y, z          int16 // raw, 16 lsb per degree per second
+		roll, pitch, yaw float32
+	}{
+		// right wing down, about the chip's y axis
+		{"rolling right", 0, 160, 0, 10, 0, 0},
+		// nose up, about the chip's x axis
+		{"pitching up", 160, 0, 0, 0, 10, 0},
+		// nose right, clockwise seen from above is negative about the chip's z axis, which points up
+		{"yawing right", 0, 0, -160, 0, 0, 10},
+		{"all at once", -80, 32, 48, 2, -5, -3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			roll, pitch, yaw, err := BodyFrame{playback(regGyroStart, tc.x, tc.y, tc.z)}.ReadAngularVelocity()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roll != tc.roll || pitch != tc.pitch || yaw != tc.yaw {
+				t.Errorf("roll %v pitch %v yaw %v, want %v %v %v", roll, pitch, yaw, tc.roll, tc.pitch, tc.yaw)
+			}
+		})
+	}
+}
+
+func TestBodyFrameAccel(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		x, y, z              int16 // raw, 100 lsb per m/s^2
+		forward, right, down float32
+	}{
+		{"speeding up", 0, 250, 0, 2.5, 0, 0},
+		{"sliding right", 100, 0, 0, 0, 1, 0},
+		// the chip's z points up
+		{"climbing", 0, 0, 300, 0, 0, -3},
+		{"all at once", -50, 125, -75, 1.25, -0.5, 0.75},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			forward, right, down, err := BodyFrame{playback(regLinearAccelStart, tc.x, tc.y, tc.z)}.ReadLinearAccel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if forward != tc.forward || right != tc.right || down != tc.down {
+				t.Errorf("forward %v right %v down %v, want %v %v %v", forward, right, down, tc.forward, tc.right, tc.down)
+			}
+		})
+	}
+}
@@ -17,10 +17,19 @@ const (
 	regEulerStart  = 0x1A
 	regEulerLength = 6
 
+	regGyroStart  = 0x14
+	regGyroLength = 6
+
 	regLinearAccelStart  = 0x28
 	regLinearAccelLength = 6
 )
 
+// angular velocity scale factors, picked by GyrDPS/GyrRPS
+const (
+	gyroLsbPerDPS = 16.0
+	gyroLsbPerRPS = 900.0
+)
+
 const (
 	modeConfig = 0x00
 	modeNDOF   = 0x0C
@@ -11,6 +11,8 @@ import (
 
 type BNO055 struct {
 	dev i2c.Dev
+	// as written by Init, decides the scale of the readings
+	unitSel byte
 }
 
 func New(busName string, unitSel byte) (*BNO055, error) {
@@ -56,6 +58,7 @@ func (b *BNO055) Init(unitSel byte) error {
 	if err := b.writeReg(regUnitSel, unitSel); err != nil {
 		return err
 	}
+	b.unitSel = unitSel
 
 	// power mode to normal
 	if err := b.writeReg(regPwrMode, pwrNormal); err != nil {
@@ -109,6 +112,25 @@ func (b *BNO055) ReadLinearAccel() (x, y, z float32, err error) {
 	return
 }
 
+// rotation rates around the sensor's x, y and z axes, in degrees or radians per second
+// depending on GyrDPS/GyrRPS
+func (b *BNO055) ReadAngularVelocity() (x, y, z float32, err error) {
+	buf := make([]byte, regGyroLength)
+	if err = b.dev.Tx([]byte{regGyroStart}, buf); err != nil {
+		return
+	}
+	// each is a signed 16 bit lsb/msb
+	// scale factor = 16 lsb per dps or 900 lsb per rps
+	scale := float32(gyroLsbPerDPS)
+	if b.unitSel&GyrRPS != 0 {
+		scale = gyroLsbPerRPS
+	}
+	x = float32(int16(binary.LittleEndian.Uint16(buf[0:2]))) / scale
+	y = float32(int16(binary.LittleEndian.Uint16(buf[2:4]))) / scale
+	z = float32(int16(binary.LittleEndian.Uint16(buf[4:6]))) / scale
+	return
+}
+
 func (b *BNO055) writeReg(reg byte, value byte) error {
 	return b.dev.Tx([]byte{reg, value}, nil)
 }
@@ -0,0 +1,306 @@
+package hal
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// in memory stand ins for the hardware, safe for concurrent use
+
+type FakeAttitude struct {
+	mu                     sync.Mutex
+	heading, roll, pitch   float32
+	rateX, rateY, rateZ    float32
+	accelX, accelY, accelZ float32
+	temperature            int8
+	err                    error
+}
+
+func NewFakeAttitude() *FakeAttitude {
+	return &FakeAttitude{temperature: 20}
+}
+
+func (f *FakeAttitude) SetEuler(heading, roll, pitch float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.heading, f.roll, f.pitch = heading, roll, pitch
+}
+
+func (f *FakeAttitude) SetAngularVelocity(x, y, z float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateX, f.rateY, f.rateZ = x, y, z
+}
+
+func (f *FakeAttitude) SetLinearAccel(x, y, z float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accelX, f.accelY, f.accelZ = x, y, z
+}
+
+// every read fails with err until it is set back to nil
+func (f *FakeAttitude) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *FakeAttitude) ReadEuler() (heading, roll, pitch float32, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.heading, f.roll, f.pitch, f.err
+}
+
+func (f *FakeAttitude) ReadAngularVelocity() (x, y, z float32, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rateX, f.rateY, f.rateZ, f.err
+}
+
+func (f *FakeAttitude) ReadLinearAccel() (x, y, z float32, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accelX, f.accelY, f.accelZ, f.err
+}
+
+func (f *FakeAttitude) ReadTemperature() (int8, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.temperature, f.err
+}
+
+type FakePosition struct {
+	mu                  sync.Mutex
+	lat, long, alt      float64
+	groundSpeed, course float64
+	err                 error
+}
+
+func NewFakePosition(lat, long, alt float64) *FakePosition {
+	return &FakePosition{lat: lat, long: long, alt: alt}
+}
+
+func (f *FakePosition) SetFix(lat, long, alt float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lat, f.long, f.alt = lat, long, alt
+}
+
+func (f *FakePosition) SetVelocity(groundSpeed, course float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.groundSpeed, f.course = groundSpeed, course
+}
+
+func (f *FakePosition) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *FakePosition) LatLongAlt() (lat, long, alt float64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, 0, 0, f.err
+	}
+	return f.lat, f.long, f.alt, nil
+}
+
+func (f *FakePosition) Velocity() (groundSpeed, course float64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, 0, f.err
+	}
+	return f.groundSpeed, f.course, nil
+}
+
+type FakeBarometer struct {
+	mu       sync.Mutex
+	pressure float64
+	err      error
+	reads    int
+}
+
+func NewFakeBarometer(pressure float64) *FakeBarometer {
+	return &FakeBarometer{pressure: pressure}
+}
+
+func (f *FakeBarometer) SetPressure(pressure float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pressure = pressure
+}
+
+func (f *FakeBarometer) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *FakeBarometer) ReadPressure() (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.pressure, nil
+}
+
+// how often the bus would have been asked
+func (f *FakeBarometer) Reads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+// keeps the last demands
+type FakeActuators struct {
+	mu               sync.Mutex
+	roll, pitch, yaw float32
+	throttle         float32
+}
+
+func NewFakeActuators() *FakeActuators {
+	return &FakeActuators{}
+}
+
+func (f *FakeActuators) SetAttitude(roll, pitch, yaw float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roll, f.pitch, f.yaw = roll, pitch, yaw
+	return nil
+}
+
+func (f *FakeActuators) SetThrottle(throttle float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.throttle = throttle
+	return nil
+}
+
+func (f *FakeActuators) Neutral() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roll, f.pitch, f.yaw, f.throttle = 0, 0, 0, 0
+	return nil
+}
+
+func (f *FakeActuators) Attitude() (roll, pitch, yaw float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.roll, f.pitch, f.yaw
+}
+
+func (f *FakeActuators) Throttle() float32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.throttle
+}
+
+// everything transmitted is kept, Receive hands out delivered frames in order
+type FakeRadio struct {
+	mu       sync.Mutex
+	sent     [][]byte
+	incoming [][]byte
+}
+
+func NewFakeRadio() *FakeRadio {
+	return &FakeRadio{}
+}
+
+func (f *FakeRadio) Transmit(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(data) > 127 {
+		return errors.New("payload too large")
+	}
+	f.sent = append(f.sent, append([]byte(nil), data...))
+	return nil
+}
+
+func (f *FakeRadio) Receive(maxLen int, timeout uint16) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.incoming) == 0 {
+		return nil, errors.New("rx timeout")
+	}
+	data := f.incoming[0]
+	f.incoming = f.incoming[1:]
+	if len(data) > maxLen {
+		return nil, errors.New("packet too large")
+	}
+	return data, nil
+}
+
+// queues a frame for a later Receive
+func (f *FakeRadio) Deliver(data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.incoming = append(f.incoming, append([]byte(nil), data...))
+}
+
+// returns and forgets everything transmitted so far
+func (f *FakeRadio) TakeSent() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sent := f.sent
+	f.sent = nil
+	return sent
+}
+
+// time only moves through Sleep and Advance
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type FakeStorage struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func NewFakeStorage() *FakeStorage {
+	return &FakeStorage{blobs: map[string][]byte{}}
+}
+
+func (f *FakeStorage) Load(name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.blobs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (f *FakeStorage) Save(name string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blobs[name] = append([]byte(nil), data...)
+	return nil
+}
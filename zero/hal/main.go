@@ -0,0 +1,91 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// what the autopilot needs from the hardware, implemented by the drivers
+// in this module and by the fakes in this package
+
+// BNO055 as mounted in the airframe, see gyroscope.BodyFrame. angular velocity is in degrees
+// per second around the roll, pitch and yaw axes with the same signs as the euler angles,
+// linear acceleration in m/s^2 along the body axes, x forward, y towards the right wing and
+// z down
+type AttitudeSensor interface {
+	ReadEuler() (heading, roll, pitch float32, err error)
+	ReadAngularVelocity() (roll, pitch, yaw float32, err error)
+	ReadLinearAccel() (x, y, z float32, err error)
+	ReadTemperature() (int8, error)
+}
+
+// NEO6M, ground speed is in m/s and course in degrees clockwise from true north
+type PositionSource interface {
+	LatLongAlt() (lat, long, alt float64, err error)
+	Velocity() (groundSpeed, course float64, err error)
+}
+
+// BMP390, pressure in pascals, the last one is repeated until the next measurement is ready
+type Barometer interface {
+	ReadPressure() (float64, error)
+}
+
+// SX127x, receive timeout is in symbols and a timeout is reported as an "rx timeout" error
+type RadioLink interface {
+	Transmit(data []byte) error
+	Receive(maxLen int, timeout uint16) ([]byte, error)
+}
+
+// actuator.Actuators
+type Actuators interface {
+	SetAttitude(roll, pitch, yaw float32) error
+	SetThrottle(throttle float32) error
+	Neutral() error
+}
+
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time        { return time.Now() }
+func (SystemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// small named blobs that have to survive a reboot, like the mission.
+// Load reports a missing blob with an error matching os.ErrNotExist
+type Storage interface {
+	Load(name string) ([]byte, error)
+	Save(name string, data []byte) error
+}
+
+// one file per name, replaced atomically so a power cut mid write keeps the old one
+type DirStorage struct {
+	Dir string
+}
+
+func (s DirStorage) Load(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, name))
+}
+
+func (s DirStorage) Save(name string, data []byte) error {
+	tmp, err := os.CreateTemp(s.Dir, name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
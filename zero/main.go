@@ -1,56 +1,55 @@
 package main
 
 import (
-	"encoding/binary"
-	"fmt"
 	"log"
-	"math"
 	"os"
-	"sync"
 	"time"
+	"zero/actuator"
+	"zero/autopilot"
+	"zero/barometer"
 	gpslib "zero/gps"
 	"zero/gyroscope"
+	"zero/hal"
 	"zero/lora"
-	"zero/pid"
 
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
 	"periph.io/x/host/v3"
 )
 
 const (
 	logFilename = "blackbox.log"
+	// the mission and anything else that has to survive a reboot
+	storageDir = "."
 
 	mainFrequency = 433.36e6
-	maxPacketSize = 1 << 8
 
-	// how many degress to tilt pitch per one meter of altitude error
-	pitchAdjustmentMultiplier = 10
-	// how many degress to tilt roll per one degree of roll error
-	rollAdjustmentMultiplier = 0.5
-	// degrees
-	pitchTargetMax = 15
-	rollTargetMax  = 10
-
-	flightUpdateInterval = 200 * time.Microsecond // 0.2ms
-	radioUpdateInterval  = 366                    // symbols, ~12s with current settings
+	// servo and esc outputs on the pca9685
+	actuatorBus       = "1"
+	actuatorFrequency = actuator.DefaultFrequency
+	actuatorMixer     = actuator.MixConventional
+	aileronOutput     = 0
+	elevatorOutput    = 1
+	rudderOutput      = 2
+	throttleOutput    = 3
+
+	barometerBus = "1"
+	// anything outside this is a broken sensor, not weather, pascals
+	minGroundPressure = 70000
+	maxGroundPressure = 110000
+
+	// redirect the log to stdout past this size
+	logSizeLimit         = 1 << 30 // 1gb
+	logSizeCheckInterval = 10 * time.Second
 )
 
+// only touched by init, diagnostic and main
 var (
-	radio *lora.LoRa
-	gyro  *gyroscope.BNO055
-	gps   *gpslib.NEO6M
-
-	radioAirtime time.Duration
-
-	status   planeStatus
-	statusMu sync.Mutex
-
-	pitchPid, rollPid *pid.PID
-
-	targetMu      sync.Mutex
-	wpLat, wpLong float64
-	targetAlt     float32
-
-	mode rune = 'i'
+	radio     *lora.LoRa
+	gyro      *gyroscope.BNO055
+	gps       *gpslib.NEO6M
+	actuators *actuator.Actuators
+	baro      *barometer.BMP390
 )
 
 func init() {
@@ -94,17 +93,32 @@ func init() {
 		log.Fatalln("error while creating new gps:", err)
 	}
 
-	// pid
-	rollPid = pid.NewPID(0.03, 0, 0.01, 0)
-	pitchPid = pid.NewPID(0.03, 0, 0.01, 0)
+	// barometer
+	baroBus, err := i2creg.Open(barometerBus)
+	if err != nil {
+		log.Fatalln("error while opening barometer bus:", err)
+	}
+	baro, err = barometer.New(baroBus, barometer.DefaultConfig())
+	if err != nil {
+		log.Fatalln("error while creating new barometer:", err)
+	}
 
-	status = planeStatus{
-		status:    status_none,
-		battery:   0,
-		speed:     0,
-		altitude:  0,
-		latitude:  0,
-		longitude: 0,
+	// actuators
+	pwm, err := actuator.NewPCA9685(actuatorBus, actuatorFrequency)
+	if err != nil {
+		log.Fatalln("error while creating new pwm driver:", err)
+	}
+	actuators, err = actuator.New(pwm, actuator.Config{
+		Mixer: actuatorMixer,
+		Surfaces: [3]actuator.Channel{
+			actuator.DefaultChannel(aileronOutput),
+			actuator.DefaultChannel(elevatorOutput),
+			actuator.DefaultChannel(rudderOutput),
+		},
+		Throttle: actuator.DefaultChannel(throttleOutput),
+	})
+	if err != nil {
+		log.Fatalln("error while creating actuators:", err)
 	}
 
 	diagnostic()
@@ -123,6 +137,17 @@ func diagnostic() {
 	if gps == nil {
 		log.Fatalln("diagnostic: gps not initialized")
 	}
+	if actuators == nil {
+		log.Fatalln("diagnostic: actuators not initialized")
+	}
+	if baro == nil {
+		log.Fatalln("diagnostic: barometer not initialized")
+	}
+
+	// esc has to see zero throttle to arm, surfaces start centered
+	if err := actuators.Neutral(); err != nil {
+		log.Fatalln("diagnostic: could not set actuators to neutral:", err)
+	}
 
 	// print radio config
 	radioConfig, err := radio.FormatConfig()
@@ -139,6 +164,11 @@ func diagnostic() {
 		log.Fatalln("diagnostic: error reading euler:", err)
 	}
 	time.Sleep(10 * time.Millisecond)
+	_, _, _, err = gyro.ReadAngularVelocity()
+	if err != nil {
+		log.Fatalln("diagnostic: error reading angular velocity:", err)
+	}
+	time.Sleep(10 * time.Millisecond)
 	_, _, _, err = gyro.ReadLinearAccel()
 	if err != nil {
 		log.Fatalln("diagnostic: error reading accel:", err)
@@ -153,6 +183,18 @@ func diagnostic() {
 	if err != nil {
 		log.Fatalln("diagnostic: error reading lat/long:", err)
 	}
+	// barometer, a measurement is long done after the warm up
+	measurement, err := baro.ReadMeasurement()
+	if err != nil {
+		log.Fatalln("diagnostic: error reading barometer:", err)
+	}
+	if p := float64(measurement.Pressure) / float64(physic.Pascal); p < minGroundPressure || p > maxGroundPressure {
+		log.Fatalln("diagnostic: barometer reads", measurement.Pressure)
+	}
+	if err := baro.Check(); err != nil {
+		log.Fatalln("diagnostic: barometer:", err)
+	}
+	log.Println("Barometer:", measurement.Pressure)
 
 	// verify lora is actually transmitting
 	start := time.Now()
@@ -177,171 +219,33 @@ func diagnostic() {
 }
 
 func main() {
-	go flightLoop()
-	go radioLoop()
-
-	select {}
-}
-
-func flightLoop() {
-	for {
-		switch mode {
-		case 'i':
-			time.Sleep(100 * time.Millisecond)
-		case 'l':
-			// TODO
-		case 't':
-			setThrust(100) // max
-			x, y, z, err := gyro.ReadLinearAccel()
-			if err != nil {
-				setThrust(0)
-				log.Fatalln("flightLoop: failed to read accel while taking off")
-			}
-			if (x+y+z)/3 > 8 { // 8m/s
-				mode = 'f'
-			}
-
-		case 'f':
-			yaw, roll, pitch, err := gyro.ReadEuler()
-			if err != nil {
-				log.Printf("flightLoop: gyro read error: %v", err)
-				continue
-			}
-
-			lat, long, alt, err := gps.LatLongAlt()
-			if err != nil {
-				log.Printf("flightLoop: gps read error: %v", err)
-			}
-
-			statusMu.Lock()
-			status.latitude = lat
-			status.longitude = long
-			status.altitude = float32(alt)
-			statusMu.Unlock()
-
-			targetMu.Lock()
-
-			// update pitch target
-			altError := float32(alt) - targetAlt
-			pitchTarget := altError * pitchAdjustmentMultiplier
-			pitchTarget = max(-pitchTargetMax, min(pitchTarget, pitchTargetMax))
-			pitchPid.Setpoint = pitchTarget
-
-			// update roll target
-			yawError := bearingError(float64(yaw), lat, long, wpLat, wpLong)
-			rollTarget := yawError * rollAdjustmentMultiplier
-			rollTarget = max(-rollTargetMax, min(rollTarget, rollTargetMax))
-			if rollTarget > -0.75 && rollTarget < 0.75 {
-				rollTarget = 0
-			}
-			rollPid.Setpoint = pitchTarget
-
-			targetMu.Unlock()
+	pilot, err := autopilot.New(autopilot.Hardware{
+		Attitude:  gyroscope.BodyFrame{BNO055: gyro},
+		Position:  gps,
+		Barometer: baro,
+		Radio:     radio,
+		Actuators: actuators,
+		Clock:     hal.SystemClock{},
+		Storage:   hal.DirStorage{Dir: storageDir},
+	})
+	if err != nil {
+		log.Fatalln("error while creating autopilot:", err)
+	}
+	pilot.Run()
 
-			rollControl := rollPid.Compute(roll, time.Now())
-			pitchControl := pitchPid.Compute(pitch, time.Now())
+	go logSizeLoop()
 
-			// actuate
-			fmt.Println("roll:", rollControl)
-			fmt.Println("pitch:", pitchControl)
-		}
-	}
+	select {}
 }
 
-func radioLoop() {
+func logSizeLoop() {
 	for {
 		if stat, err := os.Stat(logFilename); err == nil {
-			// redirect log if it gets too large (1gb)
-			if stat.Size() > 1<<30 {
+			if stat.Size() > logSizeLimit {
 				log.SetOutput(os.Stdout)
+				return
 			}
 		}
-
-		statusMu.Lock()
-		bytes := status.toBytes()
-		statusMu.Unlock()
-
-		start := time.Now()
-		radio.Transmit(newPacket(payloadType_bulk, bytes[:]))
-		radioAirtime += time.Since(start)
-
-		fmt.Printf("transmit: %b\nairtime: %dms\n", bytes, radioAirtime.Milliseconds())
-
-		data, err := radio.Receive(maxPacketSize, radioUpdateInterval)
-		if err != nil {
-			if err.Error() != "rx timeout" {
-				log.Println("radioLoopL: rx error:", err)
-			}
-			continue
-		}
-		if len(data) < 2 {
-			log.Printf("data length of %v with no error (<2)\n", len(data))
-			continue
-		}
-		if len(data) >= 2 && int(data[1]) != len(data) {
-			log.Println("data incorrectly stated its length")
-			continue
-		}
-
-		switch data[0] {
-		case payloadType_wpSet:
-			wpLatNew := math.Float64frombits(binary.BigEndian.Uint64(data[2:10]))
-			wpLongNew := math.Float64frombits(binary.BigEndian.Uint64(data[10:18]))
-
-			// probably a good practice unless youre flying directly over null island
-			if wpLatNew == 0 || wpLongNew == 0 {
-				log.Printf("new lat/long was 0: %v/%v", wpLatNew, wpLongNew)
-				continue
-			}
-
-			targetMu.Lock()
-			wpLat, wpLong = wpLatNew, wpLongNew
-			targetMu.Unlock()
-		case payloadType_altSet:
-			altNew := math.Float32frombits(binary.BigEndian.Uint32(data[2:6]))
-			targetMu.Lock()
-			targetAlt = altNew
-			targetMu.Unlock()
-		}
+		time.Sleep(logSizeCheckInterval)
 	}
 }
-
-func bearingError(yaw, lat, long, latWP, lonWP float64) float64 {
-	const R = 6371000.0
-
-	toRad := math.Pi / 180.0
-	latRad := lat * toRad
-	lonRad := long * toRad
-	latWPRad := latWP * toRad
-	lonWPRad := lonWP * toRad
-
-	dLat := latWPRad - latRad
-	dLon := lonWPRad - lonRad
-	dX := dLon * math.Cos(latRad) * R
-	dY := dLat * R
-
-	yawRad := yaw * toRad
-	Ax := math.Sin(yawRad)
-	Ay := math.Cos(yawRad)
-
-	magB := math.Hypot(dX, dY)
-	if magB == 0 {
-		return 0
-	}
-
-	dot := Ax*dX + Ay*dY
-	cosTheta := dot / magB
-
-	if cosTheta > 1 {
-		cosTheta = 1
-	} else if cosTheta < -1 {
-		cosTheta = -1
-	}
-
-	theta := math.Acos(cosTheta) * 180.0 / math.Pi
-	return theta
-}
-
-func setThrust(power int) {
-	fmt.Printf("Thrust set to %d\n", power)
-}
@@ -0,0 +1,9 @@
+package mission
+
+const (
+	// used when an item leaves the acceptance radius to the plane, meters
+	DefaultAcceptRadius = 30
+
+	// what Storage keeps the mission under
+	StorageName = "mission.bin"
+)
@@ -0,0 +1,206 @@
+package mission
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"zero/nav"
+
+	"protocol"
+)
+
+// an ordered list of waypoints flown one after the other. an item is done once the plane
+// got inside its acceptance radius and then stayed around for its loiter time
+
+var (
+	ErrOverlap  = errors.New("mission: chunk overlaps another")
+	ErrChecksum = errors.New("mission: checksum mismatch")
+	ErrNoItem   = errors.New("mission: no item at that index")
+)
+
+type Mission struct {
+	mu       sync.Mutex
+	items    []protocol.MissionItem
+	checksum uint16
+
+	current int
+	// false after the last item or while something else overrides the mission
+	active bool
+	// when the plane first got within the acceptance radius of the current item
+	arrivedAt time.Time
+	arrived   bool
+}
+
+func New() *Mission {
+	return &Mission{checksum: protocol.MissionChecksum(nil)}
+}
+
+// replaces the mission and starts flying it from the first item
+func (m *Mission) Set(items []protocol.MissionItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = append([]protocol.MissionItem(nil), items...)
+	m.checksum = protocol.MissionChecksum(m.items)
+	m.current = 0
+	m.active = len(m.items) > 0
+	m.arrived = false
+}
+
+func (m *Mission) Items() []protocol.MissionItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]protocol.MissionItem(nil), m.items...)
+}
+
+func (m *Mission) Checksum() uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checksum
+}
+
+// pausing keeps the position in the mission, resuming continues from the same item
+func (m *Mission) SetActive(active bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = active && m.current < len(m.items)
+	m.arrived = false
+}
+
+// the item being flown, ok is false when there is none
+func (m *Mission) Current() (index int, item protocol.MissionItem, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active {
+		return 0, protocol.MissionItem{}, false
+	}
+	return m.current, m.items[m.current], true
+}
+
+// whether the plane reached the current item and is waiting out its loiter time
+func (m *Mission) Arrived() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active && m.arrived
+}
+
+// moves along the mission from the plane's position, returns whether it moved to the next item
+// and whether that finished the mission
+func (m *Mission) Update(lat, long float64, now time.Time) (advanced, finished bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active {
+		return false, false
+	}
+	item := m.items[m.current]
+
+	radius := float64(item.AcceptRadius)
+	if radius == 0 {
+		radius = DefaultAcceptRadius
+	}
+	if !m.arrived {
+		if nav.Distance(lat, long, item.Latitude, item.Longitude) > radius {
+			return false, false
+		}
+		m.arrived = true
+		m.arrivedAt = now
+	}
+	if now.Sub(m.arrivedAt) < time.Duration(item.LoiterTime)*time.Second {
+		return false, false
+	}
+
+	m.arrived = false
+	m.current++
+	if m.current == len(m.items) {
+		m.active = false
+		return true, true
+	}
+	return true, false
+}
+
+// the download chunk starting at index, an empty mission is one empty chunk at 0
+func (m *Mission) Chunk(index int) (protocol.MissionChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if index > len(m.items) || (index == len(m.items) && index != 0) {
+		return protocol.MissionChunk{}, ErrNoItem
+	}
+	return protocol.MissionChunk{
+		Count:    byte(len(m.items)),
+		Checksum: m.checksum,
+		Index:    byte(index),
+		Items:    append([]protocol.MissionItem(nil), m.items[index:min(index+protocol.MissionChunkItems, len(m.items))]...),
+	}, nil
+}
+
+// stored as the checksum followed by the items in their over the air encoding
+func Marshal(items []protocol.MissionItem) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, protocol.MissionChecksum(items))
+	return append(buf, protocol.EncodeMission(items)...)
+}
+
+func Unmarshal(data []byte) ([]protocol.MissionItem, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("mission: stored mission of %d bytes", len(data))
+	}
+	items, err := protocol.DecodeMission(data[2:])
+	if err != nil {
+		return nil, err
+	}
+	if protocol.MissionChecksum(items) != binary.BigEndian.Uint16(data[:2]) {
+		return nil, ErrChecksum
+	}
+	return items, nil
+}
+
+// collects the chunks of an upload. the relay retries every chunk on its own, so they come in
+// any order and some more than once: a chunk from further on waits for the ones before it, one
+// that is already in is taken again without changing anything
+type Upload struct {
+	count    byte
+	checksum uint16
+	// by index, nil until the first chunk
+	chunks   map[byte][]protocol.MissionItem
+	received int
+	// the upload of this count and checksum is complete, its chunks are only repeats
+	done bool
+}
+
+// complete is true with the whole mission once every chunk is in and the checksum matches.
+// a chunk of another count or checksum starts a new upload, so a changed mission doesn't have
+// to be cancelled
+func (u *Upload) Add(c protocol.MissionChunk) (items []protocol.MissionItem, complete bool, err error) {
+	if u.chunks == nil || c.Count != u.count || c.Checksum != u.checksum {
+		u.count, u.checksum = c.Count, c.Checksum
+		u.chunks, u.received, u.done = make(map[byte][]protocol.MissionItem), 0, false
+	}
+	if _, seen := u.chunks[c.Index]; seen || u.done {
+		return nil, false, nil
+	}
+	// only an empty mission is uploaded as an empty chunk, anywhere else it adds nothing
+	if len(c.Items) > 0 {
+		end := int(c.Index) + len(c.Items)
+		for index, chunk := range u.chunks {
+			if int(c.Index) < int(index)+len(chunk) && int(index) < end {
+				return nil, false, fmt.Errorf("%w: %d items at %d, %d at %d", ErrOverlap, len(c.Items), c.Index, len(chunk), index)
+			}
+		}
+		u.chunks[c.Index] = append([]protocol.MissionItem(nil), c.Items...)
+		u.received += len(c.Items)
+	}
+	if u.received < int(u.count) {
+		return nil, false, nil
+	}
+
+	// none overlap and all end within the count, so they follow on from each other
+	for len(items) < int(u.count) {
+		items = append(items, u.chunks[byte(len(items))]...)
+	}
+	if protocol.MissionChecksum(items) != u.checksum {
+		u.chunks = nil
+		return nil, false, ErrChecksum
+	}
+	u.chunks, u.done = map[byte][]protocol.MissionItem{}, true
+	return items, true, nil
+}
@@ -0,0 +1,111 @@
+package mission
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"protocol"
+)
+
+func testItems(n int) []protocol.MissionItem {
+	items := make([]protocol.MissionItem, n)
+	for i := range items {
+		items[i] = protocol.MissionItem{Latitude: 48.1 + float64(i)*0.001, Longitude: 11.5, Altitude: 100}
+	}
+	return items
+}
+
+func testChunks(t *testing.T, items []protocol.MissionItem) []protocol.MissionChunk {
+	t.Helper()
+	chunks, err := protocol.SplitMission(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+// the relay retries each chunk on its own schedule, a lost first chunk comes in last
+func TestUploadOutOfOrder(t *testing.T) {
+	items := testItems(15)
+	chunks := testChunks(t, items)
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+
+	var u Upload
+	for i, c := range []protocol.MissionChunk{chunks[1], chunks[2], chunks[1], chunks[2]} {
+		if _, complete, err := u.Add(c); err != nil || complete {
+			t.Fatalf("chunk %d at %d: complete %v, %v", i, c.Index, complete, err)
+		}
+	}
+	got, complete, err := u.Add(chunks[0])
+	if err != nil || !complete || !reflect.DeepEqual(got, items) {
+		t.Fatalf("after the first chunk: complete %v, %v", complete, err)
+	}
+
+	// retries that come in after it's done change nothing
+	for _, c := range chunks {
+		if got, complete, err := u.Add(c); err != nil || complete || got != nil {
+			t.Errorf("repeat of %d after completing: %v %v %v", c.Index, got, complete, err)
+		}
+	}
+}
+
+func TestUploadStartsOver(t *testing.T) {
+	first, second := testItems(15), testItems(8)
+	second[0].Altitude = 200
+
+	// a new mission drops the chunks of the one before
+	var u Upload
+	u.Add(testChunks(t, first)[1])
+	u.Add(testChunks(t, first)[2])
+	chunks := testChunks(t, second)
+	u.Add(chunks[1])
+	got, complete, err := u.Add(chunks[0])
+	if err != nil || !complete || !reflect.DeepEqual(got, second) {
+		t.Fatalf("new mission: %v %v", complete, err)
+	}
+
+	// the same mission again once another came in between
+	u.Add(testChunks(t, first)[0])
+	if _, complete, _ := u.Add(chunks[0]); complete {
+		t.Error("a stale repeat was taken as a new upload")
+	}
+}
+
+func TestUploadEmpty(t *testing.T) {
+	var u Upload
+	got, complete, err := u.Add(testChunks(t, nil)[0])
+	if err != nil || !complete || len(got) != 0 {
+		t.Errorf("clearing: %v %v %v", got, complete, err)
+	}
+}
+
+func TestUploadBadChunks(t *testing.T) {
+	items := testItems(15)
+	chunks := testChunks(t, items)
+
+	var u Upload
+	u.Add(chunks[0])
+	overlapping := chunks[1]
+	overlapping.Index = 3
+	if _, _, err := u.Add(overlapping); !errors.Is(err, ErrOverlap) {
+		t.Errorf("overlapping chunk: %v, want ErrOverlap", err)
+	}
+
+	// items that don't add up to the checksum, the upload starts over
+	u = Upload{}
+	corrupt := chunks[2]
+	corrupt.Items = testItems(3)
+	u.Add(chunks[0])
+	u.Add(chunks[1])
+	if _, _, err := u.Add(corrupt); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("corrupt chunk: %v, want ErrChecksum", err)
+	}
+	u.Add(chunks[2])
+	u.Add(chunks[1])
+	if got, complete, err := u.Add(chunks[0]); err != nil || !complete || !reflect.DeepEqual(got, items) {
+		t.Errorf("after a checksum mismatch: %v %v", complete, err)
+	}
+}
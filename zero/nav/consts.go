@@ -0,0 +1,17 @@
+package nav
+
+const (
+	// mean earth radius for the spherical formulas, meters
+	EarthRadius = 6371008.8
+
+	// WGS84 ellipsoid for Vincenty
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+
+	vincentyTolerance     = 1e-12
+	vincentyMaxIterations = 200
+
+	degToRad = 0.017453292519943295
+	radToDeg = 57.29577951308232
+)
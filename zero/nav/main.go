@@ -0,0 +1,154 @@
+package nav
+
+import (
+	"errors"
+	"math"
+)
+
+// great circle navigation, angles are in degrees, bearings are clockwise from true north
+// in [0..360) and distances are in meters. the spherical formulas are good to about 0.5%,
+// Vincenty is good to millimeters on the WGS84 ellipsoid
+
+var ErrNoConvergence = errors.New("nav: vincenty did not converge, points are nearly antipodal")
+
+// wraps into (-180..180]
+func Wrap180(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg > 180 {
+		deg -= 360
+	} else if deg <= -180 {
+		deg += 360
+	}
+	return deg
+}
+
+// wraps into [0..360)
+func Wrap360(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+// how far to turn from heading to face bearing, positive is a right turn
+func HeadingError(heading, bearing float64) float64 {
+	return Wrap180(bearing - heading)
+}
+
+// haversine
+func Distance(lat1, long1, lat2, long2 float64) float64 {
+	return EarthRadius * angularDistance(lat1, long1, lat2, long2)
+}
+
+// radians
+func angularDistance(lat1, long1, lat2, long2 float64) float64 {
+	phi1, phi2 := lat1*degToRad, lat2*degToRad
+	dPhi := phi2 - phi1
+	dLambda := (long2 - long1) * degToRad
+	h := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// bearing to fly at the start to follow the great circle to the second point
+func InitialBearing(lat1, long1, lat2, long2 float64) float64 {
+	phi1, phi2 := lat1*degToRad, lat2*degToRad
+	dLambda := (long2 - long1) * degToRad
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return Wrap360(math.Atan2(y, x) * radToDeg)
+}
+
+// bearing on arrival at the second point
+func FinalBearing(lat1, long1, lat2, long2 float64) float64 {
+	return Wrap360(InitialBearing(lat2, long2, lat1, long1) + 180)
+}
+
+// where you end up after distance meters along the great circle starting at bearing
+func Destination(lat, long, bearing, distance float64) (float64, float64) {
+	phi1, lambda1 := lat*degToRad, long*degToRad
+	theta := bearing * degToRad
+	delta := distance / EarthRadius
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(
+		math.Sin(theta)*math.Sin(delta)*math.Cos(phi1),
+		math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2),
+	)
+	return phi2 * radToDeg, Wrap180(lambda2 * radToDeg)
+}
+
+// distance of the point from the great circle through start and end,
+// positive when the point is right of the track
+func CrossTrack(startLat, startLong, endLat, endLong, lat, long float64) float64 {
+	delta13 := angularDistance(startLat, startLong, lat, long)
+	theta13 := InitialBearing(startLat, startLong, lat, long) * degToRad
+	theta12 := InitialBearing(startLat, startLong, endLat, endLong) * degToRad
+	return math.Asin(math.Sin(delta13)*math.Sin(theta13-theta12)) * EarthRadius
+}
+
+// distance from start to the point's projection on the track, negative behind start
+func AlongTrack(startLat, startLong, endLat, endLong, lat, long float64) float64 {
+	delta13 := angularDistance(startLat, startLong, lat, long)
+	theta13 := InitialBearing(startLat, startLong, lat, long) * degToRad
+	theta12 := InitialBearing(startLat, startLong, endLat, endLong) * degToRad
+	deltaXt := math.Asin(math.Sin(delta13) * math.Sin(theta13-theta12))
+	along := math.Acos(math.Max(-1, math.Min(1, math.Cos(delta13)/math.Cos(deltaXt))))
+	return math.Copysign(along, math.Cos(theta13-theta12)) * EarthRadius
+}
+
+// Vincenty's inverse formula on WGS84, also returns the initial and final bearings
+func DistanceVincenty(lat1, long1, lat2, long2 float64) (distance, initial, final float64, err error) {
+	L := (long2 - long1) * degToRad
+	tanU1 := (1 - wgs84F) * math.Tan(lat1*degToRad)
+	tanU2 := (1 - wgs84F) * math.Tan(lat2*degToRad)
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	cosU2 := 1 / math.Sqrt(1+tanU2*tanU2)
+	sinU2 := tanU2 * cosU2
+
+	lambda := L
+	var sinLambda, cosLambda, sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for range vincentyMaxIterations {
+		sinLambda, cosLambda = math.Sin(lambda), math.Cos(lambda)
+		sinSqSigma := (cosU2*sinLambda)*(cosU2*sinLambda) +
+			(cosU1*sinU2-sinU1*cosU2*cosLambda)*(cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSqSigma == 0 {
+			// same point
+			return 0, 0, 0, nil
+		}
+		sinSigma = math.Sqrt(sinSqSigma)
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			// on the equator cosSqAlpha is 0 and the term drops out
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		C := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*
+			(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return 0, 0, 0, ErrNoConvergence
+	}
+
+	uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+	distance = wgs84B * A * (sigma - deltaSigma)
+	initial = Wrap360(math.Atan2(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda) * radToDeg)
+	final = Wrap360(math.Atan2(cosU1*sinLambda, -sinU1*cosU2+cosU1*sinU2*cosLambda) * radToDeg)
+	return distance, initial, final, nil
+}
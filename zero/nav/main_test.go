@@ -0,0 +1,144 @@
+package nav
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// the worked examples of https://www.movable-type.co.uk/scripts/latlong.html and
+// latlong-vincenty.html. the spherical ones are given for a radius of 6371km, against
+// EarthRadius that is 1.4ppm off, well inside the rounding of the published values
+
+func dms(d, m, s float64) float64 {
+	return math.Copysign(math.Abs(d)+m/60+s/3600, d)
+}
+
+func near(t *testing.T, what string, got, want, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%s = %v, want %v ±%v", what, got, want, tolerance)
+	}
+}
+
+func TestMovableType(t *testing.T) {
+	// Land's End to John o' Groats
+	lat1, long1 := dms(50, 3, 59), dms(-5, 42, 53)
+	lat2, long2 := dms(58, 38, 38), dms(-3, 4, 12)
+	near(t, "distance", Distance(lat1, long1, lat2, long2), 968.9e3, 100)
+	near(t, "initial bearing", InitialBearing(lat1, long1, lat2, long2), dms(9, 7, 11), 1.0/3600)
+	near(t, "final bearing", FinalBearing(lat1, long1, lat2, long2), dms(11, 16, 31), 1.0/3600)
+
+	lat, long := Destination(dms(53, 19, 14), dms(-1, 43, 47), dms(96, 1, 18), 124.8e3)
+	near(t, "destination lat", lat, dms(53, 11, 18), 1.0/3600)
+	near(t, "destination long", long, dms(0, 8, 0), 1.0/3600)
+
+	// the point is north of a track running east south east, so on its left
+	start, end, point := [2]float64{53.3206, -1.7297}, [2]float64{53.1887, 0.1334}, [2]float64{53.2611, -0.7972}
+	near(t, "cross track", CrossTrack(start[0], start[1], end[0], end[1], point[0], point[1]), -307.5, 0.1)
+	near(t, "along track", AlongTrack(start[0], start[1], end[0], end[1], point[0], point[1]), 62.331e3, 1)
+}
+
+func TestVincenty(t *testing.T) {
+	// Flinders Peak to Buninyong
+	distance, initial, final, err := DistanceVincenty(
+		dms(-37, 57, 3.72030), dms(144, 25, 29.52440),
+		dms(-37, 39, 10.15610), dms(143, 55, 35.38390),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "distance", distance, 54972.271, 0.001)
+	near(t, "initial bearing", initial, dms(306, 52, 5.37), 0.01/3600)
+	// published as the reverse azimuth 127°10'25.07"
+	near(t, "final bearing", final, dms(307, 10, 25.07), 0.01/3600)
+
+	// along the equator the series has no cos2SigmaM term, one degree of the semi major axis
+	distance, initial, final, err = DistanceVincenty(0, 179.5, 0, -179.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "equator distance", distance, wgs84A*degToRad, 0.001)
+	near(t, "equator initial bearing", initial, 90, 1e-9)
+	near(t, "equator final bearing", final, 90, 1e-9)
+
+	// over the pole, on the meridian the curvature radius near the pole is a²/b
+	distance, initial, final, err = DistanceVincenty(89, 0, 89, 180)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "polar distance", distance, 2*degToRad*wgs84A*wgs84A/wgs84B, 10)
+	near(t, "polar initial bearing", initial, 0, 1e-9)
+	near(t, "polar final bearing", final, 180, 1e-9)
+
+	if d, _, _, err := DistanceVincenty(48.1, 11.5, 48.1, 11.5); err != nil || d != 0 {
+		t.Errorf("same point: %v %v", d, err)
+	}
+	if _, _, _, err := DistanceVincenty(0, 0, 0.5, 179.7); !errors.Is(err, ErrNoConvergence) {
+		t.Errorf("nearly antipodal: %v, want ErrNoConvergence", err)
+	}
+}
+
+// one degree of a great circle
+const degree = EarthRadius * degToRad
+
+func TestAntimeridian(t *testing.T) {
+	near(t, "distance", Distance(0, 179.5, 0, -179.5), degree, 1e-6)
+	near(t, "bearing east", InitialBearing(0, 179.5, 0, -179.5), 90, 1e-9)
+	near(t, "bearing west", InitialBearing(0, -179.5, 0, 179.5), 270, 1e-9)
+
+	lat, long := Destination(0, 179.5, 90, degree)
+	near(t, "destination lat", lat, 0, 1e-9)
+	near(t, "destination long", long, -179.5, 1e-9)
+	_, long = Destination(10, -179.9, 270, 0.2*degree*math.Cos(10*degToRad))
+	if long < 179 || long > 180 {
+		t.Errorf("destination west over the antimeridian at %v, want it wrapped to just under 180", long)
+	}
+
+	// a track east along the equator, the point a degree north of it is on its left
+	near(t, "cross track", CrossTrack(0, 179, 0, -179, 1, -179.5), -degree, 1e-6)
+	near(t, "along track", AlongTrack(0, 179, 0, -179, 1, -179.5), 1.5*degree, 1e-6)
+}
+
+func TestPoles(t *testing.T) {
+	near(t, "over the pole", Distance(89, 0, 89, 180), 2*degree, 1e-6)
+	near(t, "bearing over the pole", InitialBearing(89, 0, 89, 180), 0, 1e-9)
+	near(t, "final bearing over the pole", FinalBearing(89, 0, 89, 180), 180, 1e-9)
+	near(t, "pole to equator", Distance(90, 0, 0, 0), 90*degree, 1e-6)
+	near(t, "bearing from the pole", InitialBearing(90, 0, 0, 0), 180, 1e-9)
+
+	lat, long := Destination(89.5, 10, 0, degree)
+	near(t, "destination lat", lat, 89.5, 1e-9)
+	near(t, "destination long", long, -170, 1e-9)
+
+	// a track north over the pole follows the 0/180 meridian, a point on the 90°E one is right of
+	// it and lies abeam the pole
+	near(t, "cross track", CrossTrack(80, 0, 80, 180, 85, 90), 5*degree, 1e-6)
+	near(t, "along track", AlongTrack(80, 0, 80, 180, 85, 90), 10*degree, 1e-6)
+}
+
+func TestWrap(t *testing.T) {
+	for _, tc := range []struct {
+		deg, w180, w360 float64
+	}{
+		{0, 0, 0},
+		{180, 180, 180},
+		{-180, 180, 180},
+		{190, -170, 190},
+		{-190, 170, 170},
+		{360, 0, 0},
+		{-360, 0, 0},
+		{725, 5, 5},
+		{-725, -5, 355},
+	} {
+		if got := Wrap180(tc.deg); got != tc.w180 {
+			t.Errorf("Wrap180(%v) = %v, want %v", tc.deg, got, tc.w180)
+		}
+		if got := Wrap360(tc.deg); got != tc.w360 {
+			t.Errorf("Wrap360(%v) = %v, want %v", tc.deg, got, tc.w360)
+		}
+	}
+	near(t, "right turn over north", HeadingError(350, 10), 20, 1e-9)
+	near(t, "left turn over north", HeadingError(10, 350), -20, 1e-9)
+	near(t, "about turn", HeadingError(90, 270), 180, 1e-9)
+}
@@ -0,0 +1,20 @@
+package navfilter
+
+const (
+	// the horizontal states, indices into Estimate.Covariance
+	StateNorth = iota
+	StateEast
+	StateVelNorth
+	StateVelEast
+	StateWindNorth
+	StateWindEast
+	stateCount
+)
+
+const (
+	// a gap this long between predictions means the estimate is stale, start over
+	maxPredictGap = 1 // seconds
+
+	degToRad = 0.017453292519943295
+	radToDeg = 57.29577951308232
+)
@@ -0,0 +1,89 @@
+package navfilter
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// every sensor's innovations are watched. a healthy one is off the prediction by about the
+// noise it was given, one that keeps being further off than that, or gets rejected, is
+// reported until it agrees again
+
+// bits of the sensors the filter doesn't trust
+type Faults byte
+
+const (
+	FaultGPSPosition Faults = 1 << iota
+	FaultGPSVelocity
+	FaultGPSAltitude
+	FaultBarometer
+	faultCount = iota
+)
+
+var faultNames = [faultCount]string{"gps position", "gps velocity", "gps altitude", "barometer"}
+
+func (f Faults) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range faultNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// of a single fault bit
+func (f Faults) index() int {
+	return bits.TrailingZeros8(uint8(f))
+}
+
+func (f *Filter) Faults() Faults {
+	var faults Faults
+	for i, m := range f.health {
+		if m.level > f.config.HealthLimit*f.config.HealthLimit {
+			faults |= 1 << i
+		}
+	}
+	return faults
+}
+
+type monitor struct {
+	// squared innovation ratios averaged over Config.HealthTime
+	level float64
+	last  time.Time
+	// of the first of the measurements rejected in a row, zero after an accepted one
+	rejectedSince time.Time
+}
+
+// true once the sensor has been rejected for Config.ResetAfter, it is believed again then and
+// stays faulty for about Config.HealthTime
+func (m *monitor) record(in Innovation, now time.Time, c Config) (reset bool) {
+	ratio := in.Ratio
+	if c.Gate > 0 {
+		// a single wild measurement counts like a rejected one, not more
+		ratio = math.Min(ratio, c.Gate)
+	}
+	smoothing := 1 - math.Exp(-now.Sub(m.last).Seconds()/c.HealthTime.Seconds())
+	m.level += (ratio*ratio - m.level) * smoothing
+	m.last = now
+
+	if in.Accepted {
+		m.rejectedSince = time.Time{}
+		return false
+	}
+	if m.rejectedSince.IsZero() {
+		m.rejectedSince = now
+	}
+	if now.Sub(m.rejectedSince) < c.ResetAfter {
+		return false
+	}
+	// agreeing with itself after the reset doesn't make it healthy yet
+	m.rejectedSince = time.Time{}
+	m.level = math.Max(m.level, c.Gate*c.Gate)
+	return true
+}
@@ -0,0 +1,407 @@
+package navfilter
+
+import (
+	"errors"
+	"math"
+	"time"
+	"zero/altitude"
+	"zero/nav"
+)
+
+// extended kalman filter over where the plane is, how fast it moves and the wind. the BNO055
+// attitude is taken as known and turns its linear acceleration into north, east and down for
+// the prediction, the gps corrects position and velocity once per fix. a plane flies where its
+// nose points, so the velocity along the wings is the wind's, which is what makes the wind
+// observable once the plane has turned a bit. down goes through the altitude package, which
+// fuses the barometer and the gps altitude
+
+type Config struct {
+	// standard deviation of the horizontal acceleration, m/s^2
+	AccelNoise float64
+	// random walk of the wind, m/s per sqrt(s)
+	WindDrift float64
+	// standard deviations of one gps position, m, and velocity, m/s, horizontally
+	GPSPositionNoise, GPSVelocityNoise float64
+	// standard deviation of the velocity along the wings relative to the air, m/s
+	SideslipNoise float64
+	// the sideslip says nothing while the plane is slower than this through the air, m/s
+	MinSideslipSpeed float64
+	// measurements further off the prediction than this many standard deviations are
+	// rejected, 0 takes everything
+	Gate float64
+
+	// standard deviations at a reset, m/s
+	InitialVelocity, InitialWind float64
+
+	// a sensor is faulty while its squared innovation ratios, averaged over HealthTime, are
+	// above HealthLimit squared
+	HealthTime  time.Duration
+	HealthLimit float64
+	// a gps or barometer rejected for this long is believed again, from where it is now
+	ResetAfter time.Duration
+
+	Vertical altitude.Config
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AccelNoise:       0.5,
+		WindDrift:        0.05,
+		GPSPositionNoise: 2.5,
+		GPSVelocityNoise: 0.3,
+		SideslipNoise:    1,
+		MinSideslipSpeed: 5,
+		Gate:             5,
+
+		InitialVelocity: 2,
+		InitialWind:     5,
+
+		HealthTime:  10 * time.Second,
+		HealthLimit: 3,
+		ResetAfter:  5 * time.Second,
+
+		Vertical: altitude.DefaultConfig(),
+	}
+}
+
+var ErrBadConfig = errors.New("navfilter: noises and health settings must be positive, drifts and the gate not negative")
+
+type Estimate struct {
+	// from the origin set at the last reset, m
+	North, East, Down          float64
+	VelNorth, VelEast, VelDown float64 // m/s
+	// where the air moves to, m/s
+	WindNorth, WindEast float64
+	Lat, Long, Alt      float64
+	// indexed by the State* constants
+	Covariance [stateCount][stateCount]float64
+	Vertical   altitude.Estimate
+	Faults     Faults
+}
+
+// m/s and degrees from true north
+func (e Estimate) GroundSpeed() float64 {
+	return math.Hypot(e.VelNorth, e.VelEast)
+}
+
+func (e Estimate) Course() float64 {
+	return nav.Wrap360(math.Atan2(e.VelEast, e.VelNorth) * radToDeg)
+}
+
+// m/s through the air, the ground velocity less the wind
+func (e Estimate) Airspeed() float64 {
+	return math.Hypot(e.VelNorth-e.WindNorth, e.VelEast-e.WindEast)
+}
+
+// m/s and the direction it blows from in degrees, like a weather report
+func (e Estimate) Wind() (speed, from float64) {
+	return math.Hypot(e.WindNorth, e.WindEast), nav.Wrap360(math.Atan2(-e.WindEast, -e.WindNorth) * radToDeg)
+}
+
+// horizontal standard deviations, m and m/s
+func (e Estimate) PositionStdDev() float64 {
+	return math.Sqrt(e.Covariance[StateNorth][StateNorth] + e.Covariance[StateEast][StateEast])
+}
+
+func (e Estimate) VelocityStdDev() float64 {
+	return math.Sqrt(e.Covariance[StateVelNorth][StateVelNorth] + e.Covariance[StateVelEast][StateVelEast])
+}
+
+func (e Estimate) WindStdDev() float64 {
+	return math.Sqrt(e.Covariance[StateWindNorth][StateWindNorth] + e.Covariance[StateWindEast][StateWindEast])
+}
+
+// how a measurement compared to the prediction, for two axes the worse one
+type Innovation = altitude.Innovation
+
+type matrix = [stateCount][stateCount]float64
+
+type Filter struct {
+	config   Config
+	vertical *altitude.Estimator
+
+	x       [stateCount]float64
+	p       matrix
+	last    time.Time
+	started bool
+	// where north and east are measured from
+	originLat, originLong, originAlt float64
+
+	health [faultCount]monitor
+}
+
+func New(config Config) (*Filter, error) {
+	if !(config.AccelNoise > 0 && config.GPSPositionNoise > 0 && config.GPSVelocityNoise > 0 &&
+		config.SideslipNoise > 0 && config.HealthTime > 0 && config.HealthLimit > 0 && config.ResetAfter > 0) ||
+		config.WindDrift < 0 || config.MinSideslipSpeed < 0 || config.Gate < 0 ||
+		config.InitialVelocity < 0 || config.InitialWind < 0 {
+		return nil, ErrBadConfig
+	}
+	vertical, err := altitude.New(config.Vertical)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{config: config, vertical: vertical}, nil
+}
+
+// starts over at a gps fix, which becomes the origin, moving at the velocity (m/s) and at an
+// altitude known to within altStdDev (m). the wind is kept, it changes slower than a reset
+func (f *Filter) Reset(lat, long, velNorth, velEast, alt, altStdDev float64, now time.Time) {
+	f.originLat, f.originLong, f.originAlt = lat, long, alt
+	f.x = [stateCount]float64{
+		StateVelNorth:  velNorth,
+		StateVelEast:   velEast,
+		StateWindNorth: f.x[StateWindNorth],
+		StateWindEast:  f.x[StateWindEast],
+	}
+	f.p = matrix{}
+	for i, stdDev := range [stateCount]float64{
+		f.config.GPSPositionNoise, f.config.GPSPositionNoise,
+		f.config.InitialVelocity, f.config.InitialVelocity,
+		f.config.InitialWind, f.config.InitialWind,
+	} {
+		f.p[i][i] = stdDev * stdDev
+	}
+	f.vertical.Reset(alt, altStdDev, now)
+	for i := range f.health {
+		f.health[i] = monitor{level: 1, last: now}
+	}
+	f.last = now
+	f.started = true
+}
+
+// false before the first Reset or after a gap in the predictions, Reset again then
+func (f *Filter) Running(now time.Time) bool {
+	return f.started && now.Sub(f.last).Seconds() < maxPredictGap && f.vertical.Running(now)
+}
+
+// moves the estimate to now with the attitude (degrees) and the linear acceleration in body
+// axes (m/s^2, forward right down, gravity removed)
+func (f *Filter) Predict(heading, roll, pitch float64, accel [3]float64, now time.Time) {
+	dt := now.Sub(f.last).Seconds()
+	f.last = now
+	if !f.started || dt <= 0 {
+		return
+	}
+
+	north, east, down := toNED(heading, roll, pitch, accel)
+	f.vertical.Predict(-down, now)
+
+	f.x[StateNorth] += f.x[StateVelNorth]*dt + north*dt*dt/2
+	f.x[StateEast] += f.x[StateVelEast]*dt + east*dt*dt/2
+	f.x[StateVelNorth] += north * dt
+	f.x[StateVelEast] += east * dt
+
+	// P = F P F' + Q
+	var fm matrix
+	for i := range fm {
+		fm[i][i] = 1
+	}
+	fm[StateNorth][StateVelNorth] = dt
+	fm[StateEast][StateVelEast] = dt
+	f.p = multiply(multiply(fm, f.p), transpose(fm))
+
+	// acceleration noise enters through the same path as the acceleration, on each axis
+	accelVar := f.config.AccelNoise * f.config.AccelNoise
+	for _, axis := range [][2]int{{StateNorth, StateVelNorth}, {StateEast, StateVelEast}} {
+		pos, vel := axis[0], axis[1]
+		f.p[pos][pos] += dt * dt * dt * dt / 4 * accelVar
+		f.p[pos][vel] += dt * dt * dt / 2 * accelVar
+		f.p[vel][pos] += dt * dt * dt / 2 * accelVar
+		f.p[vel][vel] += dt * dt * accelVar
+	}
+	windVar := f.config.WindDrift * f.config.WindDrift * dt
+	f.p[StateWindNorth][StateWindNorth] += windVar
+	f.p[StateWindEast][StateWindEast] += windVar
+}
+
+// a gps position, degrees. only once per fix, the same fix twice counts as twice the certainty
+func (f *Filter) UpdatePosition(lat, long float64) Innovation {
+	north, east := f.offset(lat, long)
+	in := f.update2(StateNorth, StateEast, north, east, f.config.GPSPositionNoise)
+	if f.health[FaultGPSPosition.index()].record(in, f.last, f.config) {
+		f.resetAxes(StateNorth, StateEast, north, east, f.config.GPSPositionNoise)
+	}
+	return in
+}
+
+// a gps velocity, m/s and degrees from true north, once per fix
+func (f *Filter) UpdateVelocity(groundSpeed, course float64) Innovation {
+	velNorth := groundSpeed * math.Cos(course*degToRad)
+	velEast := groundSpeed * math.Sin(course*degToRad)
+	in := f.update2(StateVelNorth, StateVelEast, velNorth, velEast, f.config.GPSVelocityNoise)
+	if f.health[FaultGPSVelocity.index()].record(in, f.last, f.config) {
+		f.resetAxes(StateVelNorth, StateVelEast, velNorth, velEast, f.config.GPSVelocityNoise)
+	}
+	return in
+}
+
+// a gps altitude, m, once per fix
+func (f *Filter) UpdateGPSAltitude(alt float64) Innovation {
+	if !f.started {
+		return Innovation{}
+	}
+	in := f.vertical.UpdateGPS(alt)
+	f.health[FaultGPSAltitude.index()].record(in, f.last, f.config)
+	return in
+}
+
+// a barometric altitude, m. a barometer that jumped is taken back with a new drift, the
+// altitude stays with the gps
+func (f *Filter) UpdateBaro(alt float64) Innovation {
+	if !f.started {
+		return Innovation{}
+	}
+	in := f.vertical.UpdateBaro(alt)
+	if f.health[FaultBarometer.index()].record(in, f.last, f.config) {
+		f.vertical.ResetBaroDrift(alt)
+	}
+	return in
+}
+
+// no velocity along the wings relative to the air, for the heading (degrees) the plane flies
+// at. false while it's too slow for that to mean anything
+func (f *Filter) UpdateSideslip(heading float64) bool {
+	if !f.started {
+		return false
+	}
+	sin, cos := math.Sincos(heading * degToRad)
+	airNorth := f.x[StateVelNorth] - f.x[StateWindNorth]
+	airEast := f.x[StateVelEast] - f.x[StateWindEast]
+	if airNorth*cos+airEast*sin < f.config.MinSideslipSpeed {
+		return false
+	}
+	var h [stateCount]float64
+	h[StateVelNorth], h[StateVelEast] = -sin, cos
+	h[StateWindNorth], h[StateWindEast] = sin, -cos
+	f.update(h, 0, f.config.SideslipNoise)
+	return true
+}
+
+func (f *Filter) Estimate() Estimate {
+	vertical := f.vertical.Estimate()
+	lat, long := f.position(f.x[StateNorth], f.x[StateEast])
+	return Estimate{
+		North:      f.x[StateNorth],
+		East:       f.x[StateEast],
+		Down:       f.originAlt - vertical.Altitude,
+		VelNorth:   f.x[StateVelNorth],
+		VelEast:    f.x[StateVelEast],
+		VelDown:    -vertical.VerticalSpeed,
+		WindNorth:  f.x[StateWindNorth],
+		WindEast:   f.x[StateWindEast],
+		Lat:        lat,
+		Long:       long,
+		Alt:        vertical.Altitude,
+		Covariance: f.p,
+		Vertical:   vertical,
+		Faults:     f.Faults(),
+	}
+}
+
+// both axes of a measurement of two states with the same noise, gated together so a jump
+// on one axis throws out the other too
+func (f *Filter) update2(i, j int, zi, zj, stdDev float64) Innovation {
+	if !f.started {
+		return Innovation{}
+	}
+	var hi, hj [stateCount]float64
+	hi[i], hj[j] = 1, 1
+	yi, yj := zi-f.x[i], zj-f.x[j]
+	in := Innovation{
+		Value: math.Hypot(yi, yj),
+		Ratio: math.Max(
+			math.Abs(yi)/math.Sqrt(f.p[i][i]+stdDev*stdDev),
+			math.Abs(yj)/math.Sqrt(f.p[j][j]+stdDev*stdDev),
+		),
+	}
+	if f.config.Gate > 0 && in.Ratio > f.config.Gate {
+		return in
+	}
+	in.Accepted = true
+	f.update(hi, zi, stdDev)
+	f.update(hj, zj, stdDev)
+	return in
+}
+
+// one scalar measurement z = h x with standard deviation stdDev
+func (f *Filter) update(h [stateCount]float64, z, stdDev float64) {
+	var ph [stateCount]float64 // P h'
+	for i := range ph {
+		for j := range h {
+			ph[i] += f.p[i][j] * h[j]
+		}
+	}
+	s := stdDev * stdDev // h P h' + R
+	y := z
+	for i := range h {
+		s += h[i] * ph[i]
+		y -= h[i] * f.x[i]
+	}
+
+	// x += K y, P -= K h P with K = P h' / s
+	for i := range f.x {
+		f.x[i] += ph[i] / s * y
+	}
+	for i := range f.p {
+		for j := range f.p[i] {
+			f.p[i][j] -= ph[i] * ph[j] / s
+		}
+	}
+}
+
+// puts two states where a measurement says they are, forgetting what they were correlated with
+func (f *Filter) resetAxes(i, j int, zi, zj, stdDev float64) {
+	f.x[i], f.x[j] = zi, zj
+	for k := range f.p {
+		f.p[i][k], f.p[k][i] = 0, 0
+		f.p[j][k], f.p[k][j] = 0, 0
+	}
+	f.p[i][i], f.p[j][j] = stdDev*stdDev, stdDev*stdDev
+}
+
+// meters north and east of the origin
+func (f *Filter) offset(lat, long float64) (north, east float64) {
+	north = (lat - f.originLat) * degToRad * nav.EarthRadius
+	east = nav.Wrap180(long-f.originLong) * degToRad * nav.EarthRadius * math.Cos(f.originLat*degToRad)
+	return north, east
+}
+
+func (f *Filter) position(north, east float64) (lat, long float64) {
+	lat = f.originLat + north/nav.EarthRadius*radToDeg
+	long = nav.Wrap180(f.originLong + east/(nav.EarthRadius*math.Cos(f.originLat*degToRad))*radToDeg)
+	return lat, long
+}
+
+// body axes to north east down, for a heading, roll and pitch in degrees
+func toNED(heading, roll, pitch float64, v [3]float64) (north, east, down float64) {
+	sy, cy := math.Sincos(heading * degToRad)
+	sr, cr := math.Sincos(roll * degToRad)
+	sp, cp := math.Sincos(pitch * degToRad)
+	north = cp*cy*v[0] + (sr*sp*cy-cr*sy)*v[1] + (cr*sp*cy+sr*sy)*v[2]
+	east = cp*sy*v[0] + (sr*sp*sy+cr*cy)*v[1] + (cr*sp*sy-sr*cy)*v[2]
+	down = -sp*v[0] + sr*cp*v[1] + cr*cp*v[2]
+	return north, east, down
+}
+
+func multiply(a, b matrix) matrix {
+	var m matrix
+	for i := range a {
+		for j := range b[0] {
+			for k := range b {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func transpose(a matrix) matrix {
+	var m matrix
+	for i := range a {
+		for j := range a[i] {
+			m[j][i] = a[i][j]
+		}
+	}
+	return m
+}
@@ -0,0 +1,166 @@
+package navfilter
+
+import (
+	"math"
+	"testing"
+	"time"
+	"zero/nav"
+)
+
+const originLat, originLong, originAlt = 48.1, 11.5, 600
+
+// a plane at constant airspeed on a flat earth around the origin, turning at a constant rate
+type flight struct {
+	north, east       float64
+	heading, turnRate float64 // degrees, degrees/s
+	airspeed          float64
+	windNorth         float64
+	windEast          float64
+}
+
+func (p *flight) velocity() (north, east float64) {
+	sin, cos := math.Sincos(p.heading * degToRad)
+	return p.airspeed*cos + p.windNorth, p.airspeed*sin + p.windEast
+}
+
+func (p *flight) fix() (lat, long, groundSpeed, course float64) {
+	lat = originLat + p.north/nav.EarthRadius*radToDeg
+	long = originLong + p.east/(nav.EarthRadius*math.Cos(originLat*degToRad))*radToDeg
+	velNorth, velEast := p.velocity()
+	return lat, long, math.Hypot(velNorth, velEast), nav.Wrap360(math.Atan2(velEast, velNorth) * radToDeg)
+}
+
+// one step of dt seconds, the acceleration to the right is what turns it
+func (p *flight) fly(dt float64) [3]float64 {
+	velNorth, velEast := p.velocity()
+	p.north += velNorth * dt
+	p.east += velEast * dt
+	p.heading = nav.Wrap360(p.heading + p.turnRate*dt)
+	return [3]float64{0, p.airspeed * p.turnRate * degToRad, 0}
+}
+
+// the sensors as the flight loop feeds them: predictions and sideslip at 50Hz, the barometer
+// at 10Hz and the gps once a second. the measurements can be tampered with on their way in
+type sensors struct {
+	position func(t time.Duration, lat, long float64) (float64, float64)
+	baro     func(t time.Duration, alt float64) float64
+}
+
+const step = 20 * time.Millisecond
+
+func newFilter(t *testing.T, p *flight, start time.Time) *Filter {
+	t.Helper()
+	f, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, long, _, _ := p.fix()
+	velNorth, velEast := p.velocity()
+	f.Reset(lat, long, velNorth, velEast, originAlt, 1, start)
+	return f
+}
+
+// flies from..to after the start
+func run(f *Filter, p *flight, s sensors, start time.Time, from, to time.Duration) {
+	for elapsed := from + step; elapsed <= to; elapsed += step {
+		now := start.Add(elapsed)
+		accel := p.fly(step.Seconds())
+		f.Predict(p.heading, 0, 0, accel, now)
+		f.UpdateSideslip(p.heading)
+		if elapsed%(100*time.Millisecond) == 0 {
+			alt := float64(originAlt)
+			if s.baro != nil {
+				alt = s.baro(elapsed, alt)
+			}
+			f.UpdateBaro(alt)
+		}
+		if elapsed%time.Second == 0 {
+			lat, long, groundSpeed, course := p.fix()
+			if s.position != nil {
+				lat, long = s.position(elapsed, lat, long)
+			}
+			f.UpdatePosition(lat, long)
+			f.UpdateVelocity(groundSpeed, course)
+			f.UpdateGPSAltitude(originAlt)
+		}
+	}
+}
+
+func TestWind(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		plane    flight
+		duration time.Duration
+	}{
+		// pointing north with the wind from the west, drifting off to the east
+		{"crosswind", flight{heading: 0, airspeed: 15, windEast: 6}, time.Minute},
+		// a circle a minute shows it from every side
+		{"circling", flight{heading: 0, turnRate: 6, airspeed: 15, windNorth: 4, windEast: 3}, 3 * time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Unix(0, 0)
+			p := tc.plane
+			f := newFilter(t, &p, start)
+			run(f, &p, sensors{}, start, 0, tc.duration)
+
+			e := f.Estimate()
+			if math.Abs(e.WindNorth-p.windNorth) > 0.5 || math.Abs(e.WindEast-p.windEast) > 0.5 {
+				t.Errorf("wind %.2f/%.2fm/s, want %v/%v", e.WindNorth, e.WindEast, p.windNorth, p.windEast)
+			}
+			if math.Abs(e.Airspeed()-p.airspeed) > 0.5 {
+				t.Errorf("airspeed %.2fm/s, want %v", e.Airspeed(), p.airspeed)
+			}
+			if e.Faults != 0 {
+				t.Errorf("faults %v", e.Faults)
+			}
+		})
+	}
+}
+
+func TestInnovationSpike(t *testing.T) {
+	// 200m east of the truth for the seconds from..to
+	gpsOff := func(from, to time.Duration) func(time.Duration, float64, float64) (float64, float64) {
+		return func(t time.Duration, lat, long float64) (float64, float64) {
+			if t >= from && t <= to {
+				long += 200 / (nav.EarthRadius * math.Cos(originLat*degToRad)) * radToDeg
+			}
+			return lat, long
+		}
+	}
+	baroOff := func(from, to time.Duration) func(time.Duration, float64) float64 {
+		return func(t time.Duration, alt float64) float64 {
+			if t >= from && t <= to {
+				alt += 50
+			}
+			return alt
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		sensors sensors
+		fault   Faults
+	}{
+		{"one wild fix", sensors{position: gpsOff(30*time.Second, 30*time.Second)}, 0},
+		{"gps off for seconds", sensors{position: gpsOff(30*time.Second, 36*time.Second)}, FaultGPSPosition},
+		{"barometer off for seconds", sensors{baro: baroOff(30*time.Second, 36*time.Second)}, FaultBarometer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Unix(0, 0)
+			p := flight{heading: 90, airspeed: 15}
+			f := newFilter(t, &p, start)
+			run(f, &p, tc.sensors, start, 0, 29*time.Second)
+			if faults := f.Faults(); faults != 0 {
+				t.Fatalf("faults %v before the spike", faults)
+			}
+			run(f, &p, tc.sensors, start, 29*time.Second, 37*time.Second)
+			if faults := f.Faults(); faults != tc.fault {
+				t.Errorf("faults %v after the spike, want %v", faults, tc.fault)
+			}
+			// healthy again once the sensor has agreed for a while
+			run(f, &p, tc.sensors, start, 37*time.Second, 97*time.Second)
+			if faults := f.Faults(); faults != 0 {
+				t.Errorf("faults %v a minute later", faults)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package pid
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// relay autotuning (Åström–Hägglund): the output bangs between two levels around the setpoint,
+// the loop settles into a limit cycle whose amplitude and period give the ultimate gain and
+// period of the plant, and the tuning rules turn those into gains
+
+type TuneRule byte
+
+const (
+	ZieglerNichols TuneRule = iota
+	TyreusLuyben
+)
+
+type AutotuneConfig struct {
+	Setpoint float32
+	// output while the measurement is below the setpoint is Bias+Amplitude, above it Bias-Amplitude
+	Bias, Amplitude float32
+	// the relay only switches once the measurement is this far past the setpoint, rejects noise
+	Hysteresis float32
+	// safe bounds, tuning is aborted once the measurement gets further than this from the setpoint
+	MaxDeviation float32
+	// oscillations to average over, the first one is thrown away as transient
+	Cycles  int
+	Timeout time.Duration
+}
+
+var (
+	ErrBadAutotuneConfig = errors.New("pid: autotune needs positive amplitude, deviation, cycles and timeout, and hysteresis below the deviation")
+	ErrAutotuneBounds    = errors.New("pid: autotune left its safe bounds")
+	ErrAutotuneTimeout   = errors.New("pid: autotune did not settle into an oscillation in time")
+)
+
+type Autotuner struct {
+	config AutotuneConfig
+	start  time.Time
+
+	high bool
+	// times the relay switched to high, one per oscillation
+	rises []time.Time
+	// peaks of the current oscillation and the amplitudes of the finished ones
+	peakMax, peakMin float32
+	amplitudes       []float32
+
+	done   bool
+	result Ultimate
+}
+
+// the plant's ultimate gain and period in seconds
+type Ultimate struct {
+	Ku, Tu float32
+}
+
+func NewAutotuner(config AutotuneConfig, now time.Time) (*Autotuner, error) {
+	if config.Amplitude <= 0 || config.MaxDeviation <= 0 || config.Cycles <= 0 || config.Timeout <= 0 ||
+		config.Hysteresis < 0 || config.Hysteresis >= config.MaxDeviation {
+		return nil, ErrBadAutotuneConfig
+	}
+	return &Autotuner{
+		config:  config,
+		start:   now,
+		high:    true,
+		peakMax: float32(math.Inf(-1)),
+		peakMin: float32(math.Inf(1)),
+	}, nil
+}
+
+// feeds one measurement and returns the output to apply, done once the result is ready.
+// after an error the caller should go back to its normal controller
+func (t *Autotuner) Update(measurement float32, now time.Time) (output float32, done bool, err error) {
+	c := &t.config
+	if t.done {
+		return c.Bias, true, nil
+	}
+	if abs(measurement-c.Setpoint) > c.MaxDeviation {
+		return c.Bias, false, ErrAutotuneBounds
+	}
+	if now.Sub(t.start) > c.Timeout {
+		return c.Bias, false, ErrAutotuneTimeout
+	}
+
+	t.peakMax = max(t.peakMax, measurement)
+	t.peakMin = min(t.peakMin, measurement)
+
+	switch {
+	case t.high && measurement > c.Setpoint+c.Hysteresis:
+		t.high = false
+	case !t.high && measurement < c.Setpoint-c.Hysteresis:
+		t.high = true
+		t.rise(now)
+	}
+
+	if t.done {
+		return c.Bias, true, nil
+	}
+	if t.high {
+		return c.Bias + c.Amplitude, false, nil
+	}
+	return c.Bias - c.Amplitude, false, nil
+}
+
+// a rise closes one full oscillation
+func (t *Autotuner) rise(now time.Time) {
+	if len(t.rises) > 0 {
+		t.amplitudes = append(t.amplitudes, (t.peakMax-t.peakMin)/2)
+	}
+	t.rises = append(t.rises, now)
+	t.peakMax = float32(math.Inf(-1))
+	t.peakMin = float32(math.Inf(1))
+
+	// one transient oscillation plus the measured ones
+	if len(t.amplitudes) < t.config.Cycles+1 {
+		return
+	}
+	measured := t.amplitudes[1:]
+	var amplitude float32
+	for _, a := range measured {
+		amplitude += a
+	}
+	amplitude /= float32(len(measured))
+	period := t.rises[len(t.rises)-1].Sub(t.rises[1]).Seconds() / float64(len(measured))
+
+	// describing function of a relay with hysteresis
+	h := t.config.Hysteresis
+	a2 := amplitude*amplitude - h*h
+	if a2 <= 0 {
+		// noise kept the swing inside the band, fall back to the ideal relay
+		a2 = amplitude * amplitude
+	}
+	t.result = Ultimate{
+		Ku: 4 * t.config.Amplitude / (math.Pi * float32(math.Sqrt(float64(a2)))),
+		Tu: float32(period),
+	}
+	t.done = true
+}
+
+func (t *Autotuner) Done() bool {
+	return t.done
+}
+
+// only meaningful once done
+func (t *Autotuner) Result() Ultimate {
+	return t.result
+}
+
+func (u Ultimate) Gains(rule TuneRule) Gains {
+	var kp, ti, td float32
+	switch rule {
+	case TyreusLuyben:
+		kp, ti, td = u.Ku/2.2, 2.2*u.Tu, u.Tu/6.3
+	default:
+		kp, ti, td = 0.6*u.Ku, u.Tu/2, u.Tu/8
+	}
+	return Gains{Kp: kp, Ki: kp / ti, Kd: kp * td}
+}
+
+func abs(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
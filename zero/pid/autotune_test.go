@@ -0,0 +1,169 @@
+package pid
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// first order plus dead time, K e^(-L s) / (tau s + 1), the usual stand in for a rate loop
+// closed around a surface
+type fopdt struct {
+	gain, tau float64
+	delay     time.Duration
+	y         float64
+	// inputs waiting out the dead time, one per step
+	queue []float64
+}
+
+func (p *fopdt) step(u float64, dt time.Duration) float64 {
+	p.queue = append(p.queue, u)
+	delayed := 0.0
+	if len(p.queue) > int(p.delay/dt) {
+		delayed, p.queue = p.queue[0], p.queue[1:]
+	}
+	p.y += (p.gain*delayed - p.y) * (1 - math.Exp(-dt.Seconds()/p.tau))
+	return p.y
+}
+
+// the relay limit cycle of a fopdt plant has a closed form: after each switch the output keeps
+// going for the dead time, then heads exponentially for ±K d
+func relayCycle(p fopdt, d, h float64) (amplitude, period float64) {
+	kd, l := p.gain*d, p.delay.Seconds()
+	amplitude = kd - (kd-h)*math.Exp(-l/p.tau)
+	halfPeriod := l + p.tau*math.Log((amplitude+kd)/(kd-h))
+	return amplitude, 2 * halfPeriod
+}
+
+func TestAutotuneFOPDT(t *testing.T) {
+	const d, dt = 1, time.Millisecond
+	for _, tc := range []struct {
+		name       string
+		plant      fopdt
+		hysteresis float64
+	}{
+		{"ideal relay", fopdt{gain: 2, tau: 1, delay: 200 * time.Millisecond}, 0},
+		{"with hysteresis", fopdt{gain: 2, tau: 1, delay: 200 * time.Millisecond}, 0.05},
+		{"slow plant", fopdt{gain: 0.5, tau: 3, delay: 500 * time.Millisecond}, 0.02},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Unix(0, 0)
+			tuner, err := NewAutotuner(AutotuneConfig{
+				Amplitude:    d,
+				Hysteresis:   float32(tc.hysteresis),
+				MaxDeviation: 2,
+				Cycles:       4,
+				Timeout:      time.Minute,
+			}, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plant := tc.plant
+			var y float64
+			for now := start; !tuner.Done(); now = now.Add(dt) {
+				u, _, err := tuner.Update(float32(y), now)
+				if err != nil {
+					t.Fatalf("after %v: %v", now.Sub(start), err)
+				}
+				y = plant.step(float64(u), dt)
+			}
+
+			amplitude, period := relayCycle(tc.plant, d, tc.hysteresis)
+			wantKu := 4 * d / (math.Pi * math.Sqrt(amplitude*amplitude-tc.hysteresis*tc.hysteresis))
+			got := tuner.Result()
+			if !near(float64(got.Ku), wantKu, 0.02) || !near(float64(got.Tu), period, 0.02) {
+				t.Fatalf("Ku %v Tu %v, want %.3f %.3f", got.Ku, got.Tu, wantKu, period)
+			}
+
+			for _, rule := range []struct {
+				rule       TuneRule
+				kp, ti, td float64
+			}{
+				{ZieglerNichols, 0.6 * wantKu, period / 2, period / 8},
+				{TyreusLuyben, wantKu / 2.2, 2.2 * period, period / 6.3},
+			} {
+				gains := got.Gains(rule.rule)
+				if !near(float64(gains.Kp), rule.kp, 0.02) ||
+					!near(float64(gains.Ki), rule.kp/rule.ti, 0.04) ||
+					!near(float64(gains.Kd), rule.kp*rule.td, 0.04) {
+					t.Errorf("rule %v gains %+v, want Kp %.3f Ki %.3f Kd %.3f",
+						rule.rule, gains, rule.kp, rule.kp/rule.ti, rule.kp*rule.td)
+				}
+			}
+		})
+	}
+}
+
+// the describing function is an approximation: against the exact crossover of the plant the
+// period is close, the gain comes out low by up to a fifth
+func TestAutotuneUltimate(t *testing.T) {
+	plant := fopdt{gain: 2, tau: 1, delay: 200 * time.Millisecond}
+	// phase of -180°: atan(w tau) + w L = pi
+	lo, hi := 0.1, 100.0
+	for range 100 {
+		w := (lo + hi) / 2
+		if math.Atan(w*plant.tau)+w*plant.delay.Seconds() > math.Pi {
+			hi = w
+		} else {
+			lo = w
+		}
+	}
+	wantKu, wantTu := math.Hypot(1, lo*plant.tau)/plant.gain, 2*math.Pi/lo
+
+	start := time.Unix(0, 0)
+	tuner, err := NewAutotuner(AutotuneConfig{Amplitude: 1, MaxDeviation: 2, Cycles: 4, Timeout: time.Minute}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y float64
+	for now := start; !tuner.Done(); now = now.Add(time.Millisecond) {
+		u, _, err := tuner.Update(float32(y), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y = plant.step(float64(u), time.Millisecond)
+	}
+	got := tuner.Result()
+	if !near(float64(got.Tu), wantTu, 0.05) {
+		t.Errorf("Tu %v, want about %.3f", got.Tu, wantTu)
+	}
+	if ku := float64(got.Ku); ku > wantKu || ku < 0.8*wantKu {
+		t.Errorf("Ku %v, want a bit under %.3f", got.Ku, wantKu)
+	}
+}
+
+func TestAutotuneAborts(t *testing.T) {
+	start := time.Unix(0, 0)
+	config := AutotuneConfig{Amplitude: 1, Hysteresis: 0.1, MaxDeviation: 1, Cycles: 2, Timeout: 10 * time.Second}
+
+	// one wired the wrong way round runs away from the setpoint
+	tuner, _ := NewAutotuner(config, start)
+	var y float32
+	var err error
+	for now := start; err == nil && now.Sub(start) < time.Minute; now = now.Add(10 * time.Millisecond) {
+		var u float32
+		u, _, err = tuner.Update(y, now)
+		y -= u * 0.1
+	}
+	if err != ErrAutotuneBounds {
+		t.Errorf("runaway plant: %v, want ErrAutotuneBounds", err)
+	}
+
+	// a dead one never crosses back
+	tuner, _ = NewAutotuner(config, start)
+	err = nil
+	for now := start; err == nil && now.Sub(start) < time.Minute; now = now.Add(10 * time.Millisecond) {
+		_, _, err = tuner.Update(0.5, now)
+	}
+	if err != ErrAutotuneTimeout {
+		t.Errorf("dead plant: %v, want ErrAutotuneTimeout", err)
+	}
+
+	if _, err := NewAutotuner(AutotuneConfig{Amplitude: 1, Hysteresis: 1, MaxDeviation: 1, Cycles: 1, Timeout: time.Second}, start); err != ErrBadAutotuneConfig {
+		t.Errorf("hysteresis as wide as the bounds: %v, want ErrBadAutotuneConfig", err)
+	}
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*math.Abs(want)
+}
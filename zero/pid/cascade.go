@@ -0,0 +1,44 @@
+package pid
+
+import "time"
+
+// an outer angle loop whose output is the setpoint of an inner rate loop,
+// the inner loop damps the airframe and the outer one only has to ask for a rate
+type Cascade struct {
+	Angle, Rate *PID
+}
+
+type CascadeTerms struct {
+	Angle, Rate Terms
+}
+
+func NewCascade(angle, rate *PID) *Cascade {
+	return &Cascade{Angle: angle, Rate: rate}
+}
+
+func (c *Cascade) Compute(angle, rate float32, now time.Time) float32 {
+	return c.ComputeRate(c.Angle.Compute(angle, now), rate, now)
+}
+
+// runs only the inner loop, for when something else decides the rate
+func (c *Cascade) ComputeRate(rateSetpoint, rate float32, now time.Time) float32 {
+	c.Rate.Setpoint = rateSetpoint
+	return c.Rate.Compute(rate, now)
+}
+
+func (c *Cascade) Terms() CascadeTerms {
+	return CascadeTerms{Angle: c.Angle.Terms(), Rate: c.Rate.Terms()}
+}
+
+func (c *Cascade) Reset(now time.Time) {
+	c.Angle.Reset(now)
+	c.Rate.Reset(now)
+}
+
+// bumpless transfer of the inner loop, it keeps the current output. the outer loop starts over
+// from the angle error, carrying the current rate into it would only hold on to a transient
+func (c *Cascade) Prime(rate, output float32, now time.Time) {
+	c.Angle.Reset(now)
+	c.Rate.Setpoint = rate
+	c.Rate.Prime(rate, output, now)
+}
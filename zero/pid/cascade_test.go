@@ -0,0 +1,38 @@
+package pid
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// taking over from a pilot: the surfaces stay where they were, the angle loop asks for a rate
+// from its error alone
+func TestCascadePrime(t *testing.T) {
+	angle := NewPID(3, 0.5, 0, 10) // a tuned angle loop with an integrator
+	rate := NewPID(0.01, 0.005, 0, 0)
+	c := NewCascade(angle, rate)
+	start := time.Unix(0, 0)
+
+	// wound up by earlier flying
+	angle.Reset(start)
+	for i := range 50 {
+		c.Compute(0, 0, start.Add(time.Duration(i)*step))
+	}
+
+	primed := start.Add(10 * time.Second)
+	c.Prime(25, 0.3, primed)
+	if rate.Setpoint != 25 {
+		t.Errorf("rate setpoint %v, want the current rate", rate.Setpoint)
+	}
+	c.Compute(4, 25, primed.Add(step))
+	terms := c.Terms()
+	// the angle loop's integral starts over, one step of error 6
+	if want := float32(3*6 + 0.5*6*step.Seconds()); math.Abs(float64(terms.Angle.Output-want)) > 1e-4 {
+		t.Errorf("angle loop asks for %v, want %v", terms.Angle.Output, want)
+	}
+	// the rate loop carries the surface position in its integral
+	if math.Abs(float64(terms.Rate.I-0.3)) > 0.01 {
+		t.Errorf("rate integral %v, want about 0.3", terms.Rate.I)
+	}
+}
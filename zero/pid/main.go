@@ -7,9 +7,38 @@ type PID struct {
 
 	Setpoint float32
 
-	prevError     float32
+	// the output is clamped to [OutMin..OutMax] and the integral term to [IntMin..IntMax],
+	// a pair with min == max is unbounded
+	OutMin, OutMax float32
+	IntMin, IntMax float32
+	// anti-windup: with a tracking gain (1/s) the integral is pulled back by how far the
+	// output got clamped (back-calculation), at 0 it just stops integrating into the limit
+	TrackingGain float32
+
+	// differentiate the measurement instead of the error, so setpoint jumps don't kick
+	DerivativeOnMeasurement bool
+	// time constant of the low pass on the D term, 0 leaves it unfiltered
+	DFilter time.Duration
+
+	prevError       float32
+	prevMeasurement float32
+	// previous values are only valid after the first Compute
+	havePrev bool
+	// integral term, already multiplied by Ki
 	integral      float32
+	derivative    float32
 	lastTimestamp time.Time
+
+	terms Terms
+}
+
+type Gains struct {
+	Kp, Ki, Kd float32
+}
+
+// contributions of one Compute, Output is after the output limits
+type Terms struct {
+	P, I, D, Output float32
 }
 
 func NewPID(kp, ki, kd, setpoint float32) *PID {
@@ -32,14 +61,82 @@ func (p *PID) Compute(measurement float32, now time.Time) float32 {
 
 	P := p.Kp * err
 
-	p.integral += err * dt
-	I := p.Ki * p.integral
+	prevIntegral := p.integral
+	p.integral = clamp(p.integral+p.Ki*err*dt, p.IntMin, p.IntMax)
+
+	if p.havePrev {
+		var raw float32
+		if p.DerivativeOnMeasurement {
+			raw = -(measurement - p.prevMeasurement) / dt
+		} else {
+			raw = (err - p.prevError) / dt
+		}
+		if p.DFilter > 0 {
+			alpha := dt / (float32(p.DFilter.Seconds()) + dt)
+			p.derivative += alpha * (raw - p.derivative)
+		} else {
+			p.derivative = raw
+		}
+	}
+	D := p.Kd * p.derivative
 
-	derivative := (err - p.prevError) / dt
-	D := p.Kd * derivative
+	out := P + p.integral + D
+	limited := clamp(out, p.OutMin, p.OutMax)
+	if limited != out {
+		if p.TrackingGain > 0 {
+			p.integral = clamp(p.integral+p.TrackingGain*(limited-out)*dt, p.IntMin, p.IntMax)
+		} else if (out > limited) == (err > 0) {
+			// conditional integration, only integrate when it helps leave the limit
+			p.integral = prevIntegral
+		}
+		limited = clamp(P+p.integral+D, p.OutMin, p.OutMax)
+	}
 
 	p.prevError = err
+	p.prevMeasurement = measurement
+	p.havePrev = true
+	p.lastTimestamp = now
+	p.terms = Terms{P: P, I: p.integral, D: D, Output: limited}
+
+	return limited
+}
+
+// what the last Compute was made of
+func (p *PID) Terms() Terms {
+	return p.terms
+}
+
+// changing gains mid flight doesn't bump the output, the integral is kept already scaled by Ki
+func (p *PID) SetGains(g Gains) {
+	p.Kp, p.Ki, p.Kd = g.Kp, g.Ki, g.Kd
+}
+
+// forgets all history, the next Compute measures dt from now
+func (p *PID) Reset(now time.Time) {
+	p.integral = 0
+	p.derivative = 0
+	p.havePrev = false
 	p.lastTimestamp = now
+	p.terms = Terms{}
+}
 
-	return P + I + D
+// bumpless transfer: sets up the state so that the next Compute with the same measurement
+// continues from output, whatever was driving the surfaces until now.
+// the difference is carried by the integral, so without Ki there is nothing to prime
+func (p *PID) Prime(measurement, output float32, now time.Time) {
+	p.Reset(now)
+	err := p.Setpoint - measurement
+	if p.Ki != 0 {
+		p.integral = clamp(output-p.Kp*err, p.IntMin, p.IntMax)
+	}
+	p.prevError = err
+	p.prevMeasurement = measurement
+	p.havePrev = true
+}
+
+func clamp(v, lo, hi float32) float32 {
+	if lo == hi {
+		return v
+	}
+	return max(lo, min(v, hi))
 }
@@ -0,0 +1,205 @@
+package pid
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const step = 100 * time.Millisecond
+
+// a pid started at t0 with the given setup, and a clock for its Computes
+func newTestPid(setup func(p *PID)) (*PID, func() time.Time) {
+	p := NewPID(0, 0, 0, 0)
+	setup(p)
+	now := time.Unix(0, 0)
+	p.Reset(now)
+	return p, func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestOutputLimits(t *testing.T) {
+	p, next := newTestPid(func(p *PID) { p.Kp, p.OutMin, p.OutMax = 1, -1, 1 })
+	for _, tc := range []struct {
+		measurement, want float32
+	}{
+		{-5, 1},
+		{5, -1},
+		{-0.5, 0.5},
+	} {
+		if got := p.Compute(tc.measurement, next()); got != tc.want {
+			t.Errorf("measurement %v: output %v, want %v", tc.measurement, got, tc.want)
+		}
+	}
+	p.Compute(-5, next())
+	if terms := p.Terms(); terms.P != 5 || terms.Output != 1 {
+		t.Errorf("terms %+v, want P 5 clamped to 1", terms)
+	}
+
+	// min == max leaves it unbounded
+	p, next = newTestPid(func(p *PID) { p.Kp = 1 })
+	if got := p.Compute(-50, next()); got != 50 {
+		t.Errorf("unbounded output %v, want 50", got)
+	}
+}
+
+func TestIntegralLimits(t *testing.T) {
+	p, next := newTestPid(func(p *PID) { p.Ki, p.IntMin, p.IntMax = 1, -2, 2 })
+	for range 100 {
+		p.Compute(-1, next())
+	}
+	if i := p.Terms().I; i != 2 {
+		t.Errorf("integral %v after 10s of error 1, want it held at 2", i)
+	}
+	for range 100 {
+		p.Compute(1, next())
+	}
+	if i := p.Terms().I; i != -2 {
+		t.Errorf("integral %v after 10s of error -1, want it held at -2", i)
+	}
+}
+
+// 10s against an output limit of 1 with an error of 1, then the error reverses
+func windup(p *PID, next func() time.Time) (saturated float32, recovery int) {
+	for range 100 {
+		p.Compute(-1, next())
+	}
+	saturated = p.Terms().I
+	for recovery = 1; recovery < 100; recovery++ {
+		if p.Compute(1, next()) < 0 {
+			break
+		}
+	}
+	return saturated, recovery
+}
+
+func TestAntiWindup(t *testing.T) {
+	// conditional integration stops at the limit
+	p, next := newTestPid(func(p *PID) { p.Ki, p.OutMin, p.OutMax = 1, -1, 1 })
+	saturated, recovery := windup(p, next)
+	if saturated > 1 {
+		t.Errorf("conditional: integral %v against an output limit of 1", saturated)
+	}
+	if recovery > 11 {
+		t.Errorf("conditional: %d steps to come off the limit", recovery)
+	}
+
+	// back-calculation settles where the tracking pull balances the error, a bit past the limit
+	p, next = newTestPid(func(p *PID) { p.Ki, p.OutMin, p.OutMax, p.TrackingGain = 1, -1, 1, 2 })
+	saturated, recovery = windup(p, next)
+	if saturated <= 1 || saturated > 1.5 {
+		t.Errorf("back-calculation: integral %v, want just past 1", saturated)
+	}
+	if recovery > 15 {
+		t.Errorf("back-calculation: %d steps to come off the limit", recovery)
+	}
+
+	// without either the integral runs on and takes as long again to unwind
+	p, next = newTestPid(func(p *PID) { p.Ki = 1 })
+	saturated, recovery = windup(p, next)
+	if saturated < 9.9 || recovery < 90 {
+		t.Errorf("unlimited: integral %v, %d steps to come off, want 10 and about 100", saturated, recovery)
+	}
+}
+
+func TestDerivativeOnMeasurement(t *testing.T) {
+	for _, tc := range []struct {
+		onMeasurement bool
+		// after a setpoint jump of 10 and then a measurement step of 1
+		jump, move float32
+	}{
+		{false, 100, -10},
+		{true, 0, -10},
+	} {
+		p, next := newTestPid(func(p *PID) { p.Kd, p.DerivativeOnMeasurement = 1, tc.onMeasurement })
+		p.Compute(0, next())
+		p.Setpoint = 10
+		p.Compute(0, next())
+		if d := p.Terms().D; math.Abs(float64(d-tc.jump)) > 1e-3 {
+			t.Errorf("on measurement %v: D %v after the setpoint jump, want %v", tc.onMeasurement, d, tc.jump)
+		}
+		p.Compute(1, next())
+		if d := p.Terms().D; math.Abs(float64(d-tc.move)) > 1e-3 {
+			t.Errorf("on measurement %v: D %v after the measurement moved, want %v", tc.onMeasurement, d, tc.move)
+		}
+	}
+}
+
+func TestDFilter(t *testing.T) {
+	// a measurement falling at 1/s is a derivative of 1, the filter lets it in over its time constant
+	p, next := newTestPid(func(p *PID) { p.Kd, p.DFilter = 1, time.Second })
+	alpha := step.Seconds() / (time.Second.Seconds() + step.Seconds())
+	var measurement float32
+	p.Compute(measurement, next())
+	if d := p.Terms().D; d != 0 {
+		t.Errorf("D %v on the first Compute, want 0", d)
+	}
+	for n := 1; n <= 30; n++ {
+		measurement -= float32(step.Seconds())
+		p.Compute(measurement, next())
+		want := 1 - math.Pow(1-alpha, float64(n))
+		if d := p.Terms().D; math.Abs(float64(d)-want) > 1e-4 {
+			t.Fatalf("D %v after %d steps, want %v", d, n, want)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	p, next := newTestPid(func(p *PID) { p.Kp, p.Ki, p.Kd = 1, 1, 1 })
+	for range 10 {
+		p.Compute(-1, next())
+	}
+	reset := next()
+	p.Reset(reset)
+	if terms := p.Terms(); terms != (Terms{}) {
+		t.Errorf("terms %+v after Reset", terms)
+	}
+	// no derivative kick from the old history, dt counts from the Reset
+	p.Compute(-2, reset.Add(time.Second))
+	if terms := p.Terms(); terms.I != 2 || terms.D != 0 {
+		t.Errorf("terms %+v, want I 2 over the second since Reset and no D", terms)
+	}
+}
+
+func TestPrime(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ki   float32
+		want float32
+	}{
+		// the integral takes up the difference, one step of error 2 is added on top
+		{"with Ki", 1, 0.7 + 2*float32(step.Seconds())},
+		// nothing to carry it, the output is P alone
+		{"without Ki", 0, 2 * 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPID(2, tc.ki, 0.5, 5)
+			p.DerivativeOnMeasurement = true
+			start := time.Unix(0, 0)
+			p.Prime(3, 0.7, start)
+			got := p.Compute(3, start.Add(step))
+			if math.Abs(float64(got-tc.want)) > 1e-5 {
+				t.Errorf("output %v after priming with 0.7, want %v", got, tc.want)
+			}
+			if terms := p.Terms(); terms.D != 0 {
+				t.Errorf("D %v with the measurement unchanged", terms.D)
+			}
+		})
+	}
+}
+
+// the integral is kept scaled by the old Ki, new gains don't step the output
+func TestSetGainsBumpless(t *testing.T) {
+	p, next := newTestPid(func(p *PID) { p.Kp, p.Ki = 1, 1 })
+	for range 10 {
+		p.Compute(0, next())
+	}
+	before := p.Terms().I
+	p.SetGains(Gains{Kp: 1, Ki: 4})
+	p.Compute(0, next())
+	if i := p.Terms().I; math.Abs(float64(i-before)) > 1e-6 {
+		t.Errorf("integral %v after SetGains, want %v kept", i, before)
+	}
+}
@@ -0,0 +1,47 @@
+package pid
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrBadSchedule = errors.New("pid: schedule needs at least one point and strictly increasing inputs")
+
+// gains keyed on an operating point like airspeed or throttle,
+// linearly interpolated between points and held flat past the ends
+type Schedule struct {
+	inputs []float32
+	gains  []Gains
+}
+
+func NewSchedule(inputs []float32, gains []Gains) (*Schedule, error) {
+	if len(inputs) == 0 || len(inputs) != len(gains) {
+		return nil, ErrBadSchedule
+	}
+	for i := 1; i < len(inputs); i++ {
+		if inputs[i] <= inputs[i-1] {
+			return nil, ErrBadSchedule
+		}
+	}
+	return &Schedule{
+		inputs: append([]float32(nil), inputs...),
+		gains:  append([]Gains(nil), gains...),
+	}, nil
+}
+
+func (s *Schedule) At(input float32) Gains {
+	i := sort.Search(len(s.inputs), func(i int) bool { return s.inputs[i] >= input })
+	switch {
+	case i == 0:
+		return s.gains[0]
+	case i == len(s.inputs):
+		return s.gains[len(s.gains)-1]
+	}
+	t := (input - s.inputs[i-1]) / (s.inputs[i] - s.inputs[i-1])
+	a, b := s.gains[i-1], s.gains[i]
+	return Gains{
+		Kp: a.Kp + (b.Kp-a.Kp)*t,
+		Ki: a.Ki + (b.Ki-a.Ki)*t,
+		Kd: a.Kd + (b.Kd-a.Kd)*t,
+	}
+}
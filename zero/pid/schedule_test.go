@@ -0,0 +1,58 @@
+package pid
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSchedule(t *testing.T) {
+	s, err := NewSchedule([]float32{10, 15, 22}, []Gains{{Kp: 4, Ki: 2}, {Kp: 2, Ki: 1, Kd: 1}, {Kp: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		input float32
+		want  Gains
+	}{
+		{0, Gains{Kp: 4, Ki: 2}},
+		{10, Gains{Kp: 4, Ki: 2}},
+		{12.5, Gains{Kp: 3, Ki: 1.5, Kd: 0.5}},
+		{15, Gains{Kp: 2, Ki: 1, Kd: 1}},
+		{18.5, Gains{Kp: 1.5, Ki: 0.5, Kd: 0.5}},
+		{22, Gains{Kp: 1}},
+		{40, Gains{Kp: 1}},
+	} {
+		got := s.At(tc.input)
+		if !nearGains(got, tc.want) {
+			t.Errorf("At(%v) = %+v, want %+v", tc.input, got, tc.want)
+		}
+	}
+
+	// a single point is flat everywhere
+	s, err = NewSchedule([]float32{15}, []Gains{{Kp: 2}})
+	if err != nil || s.At(0) != (Gains{Kp: 2}) || s.At(100) != (Gains{Kp: 2}) {
+		t.Errorf("single point schedule: %v", err)
+	}
+}
+
+func TestBadSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		inputs []float32
+		gains  []Gains
+	}{
+		{"empty", nil, nil},
+		{"short gains", []float32{10, 15}, []Gains{{}}},
+		{"repeated input", []float32{10, 10}, []Gains{{}, {}}},
+		{"decreasing", []float32{15, 10}, []Gains{{}, {}}},
+	} {
+		if _, err := NewSchedule(tc.inputs, tc.gains); !errors.Is(err, ErrBadSchedule) {
+			t.Errorf("%s: %v, want ErrBadSchedule", tc.name, err)
+		}
+	}
+}
+
+func nearGains(a, b Gains) bool {
+	return math.Abs(float64(a.Kp-b.Kp)) < 1e-5 && math.Abs(float64(a.Ki-b.Ki)) < 1e-5 && math.Abs(float64(a.Kd-b.Kd)) < 1e-5
+}
@@ -0,0 +1,70 @@
+package sim
+
+import "time"
+
+const (
+	gravity    = 9.80665 // m/s^2
+	airDensity = 1.225   // kg/m^3, sea level
+	earthR     = 6371000.0
+
+	physicsStep  = 5 * time.Millisecond
+	flightPeriod = 20 * time.Millisecond
+	radioPeriod  = 12 * time.Second // matches radioUpdateInterval in the autopilot
+	checkPeriod  = time.Second      // failsafe checks
+	gpsPeriod    = time.Second      // NEO6M default update rate
+
+	// sequence numbers of the commands the sim sends on its own, clear of scripted ones
+	groundSeqStart = 0xF000
+
+	// touching the ground faster than this is a crash
+	crashSinkRate = 3 // m/s
+)
+
+// small foam trainer, coefficients are per radian and per full surface deflection
+type Airframe struct {
+	Mass                  float64 // kg
+	WingArea, Span, Chord float64 // m^2, m, m
+	Ixx, Iyy, Izz         float64 // kg m^2
+	MaxThrust             float64 // N
+
+	CL0, CLAlpha, StallAlpha float64
+	CD0, InducedDrag         float64
+	CYBeta                   float64
+
+	ClBeta, ClP, ClAileron        float64
+	Cm0, CmAlpha, CmQ, CmElevator float64
+	CnBeta, CnR, CnRudder         float64
+}
+
+func DefaultAirframe() Airframe {
+	return Airframe{
+		Mass:      1.2,
+		WingArea:  0.26,
+		Span:      1.4,
+		Chord:     0.19,
+		Ixx:       0.06,
+		Iyy:       0.08,
+		Izz:       0.13,
+		MaxThrust: 8,
+
+		CL0:         0.3,
+		CLAlpha:     4.8,
+		StallAlpha:  14 * degToRad,
+		CD0:         0.04,
+		InducedDrag: 0.06,
+		CYBeta:      -0.5,
+
+		ClBeta:    -0.08,
+		ClP:       -0.45,
+		ClAileron: 0.06,
+
+		Cm0:        0.005,
+		CmAlpha:    -0.8,
+		CmQ:        -12,
+		CmElevator: 0.15,
+
+		CnBeta:   0.08,
+		CnR:      -0.15,
+		CnRudder: 0.06,
+	}
+}
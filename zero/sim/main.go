@@ -0,0 +1,427 @@
+package sim
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+	"zero/autopilot"
+	"zero/barometer"
+	"zero/flightmode"
+	"zero/hal"
+	"zero/nav"
+	"zero/navfilter"
+	"zero/pid"
+
+	"protocol"
+)
+
+// software in the loop: the real autopilot flying a simulated plane on a fake clock,
+// so a flight runs as fast as the cpu allows
+
+type Config struct {
+	Airframe Airframe
+	Noise    Noise
+	Seed     int64
+
+	Duration time.Duration
+
+	// where the plane starts, on the ground
+	OriginLat, OriginLong, OriginAlt float64
+	Heading                          float64 // degrees
+	// sea level pressure of the simulated day and how fast the weather changes it, pascals
+	// and pascals per second. a hectopascal is about 8m of barometric altitude
+	QNH, QNHRate float64
+
+	// steady wind and the standard deviation of gusts on top of it, north east down m/s
+	Wind [3]float64
+	Gust float64
+
+	// push along the runway once the autopilot is in takeoff, like a bungee or a throw
+	LaunchForce float64 // N
+	LaunchTime  time.Duration
+
+	// uplink frames the ground sends, in order, each no earlier than At
+	Commands []Command
+	// the ground stops answering after this, zero keeps the link up
+	LinkLostAt time.Duration
+	// the ground applies whatever gains an autotune proposes, otherwise the plane keeps
+	// reporting them and flies on with the old ones
+	ApplyTunedGains bool
+
+	// how often a trajectory sample is taken
+	SampleInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Airframe: DefaultAirframe(),
+		Noise:    DefaultNoise(),
+		Seed:     1,
+
+		Duration: 5 * time.Minute,
+
+		OriginLat:  45,
+		OriginLong: 15,
+		QNH:        barometer.StandardPressure,
+
+		LaunchForce: 30,
+		LaunchTime:  500 * time.Millisecond,
+
+		SampleInterval: 100 * time.Millisecond,
+	}
+}
+
+type Command struct {
+	At    time.Duration
+	Frame []byte
+}
+
+// sequence numbers are only there for dedupe, the simulated ground never retries
+func TakeoffCommand(at time.Duration, seq uint16) Command {
+	return command(at, protocol.PayloadType_takeoff, seq, nil)
+}
+
+func LandCommand(at time.Duration, seq uint16) Command {
+	return command(at, protocol.PayloadType_land, seq, nil)
+}
+
+func GoAroundCommand(at time.Duration, seq uint16) Command {
+	return command(at, protocol.PayloadType_goAround, seq, nil)
+}
+
+// qnh in hectopascals, 0 clears it
+func QNHCommand(at time.Duration, seq uint16, qnh float32) Command {
+	return command(at, protocol.PayloadType_qnhSet, seq, protocol.NewQNHArgs(qnh))
+}
+
+func WaypointCommand(at time.Duration, seq uint16, lat, long float64) Command {
+	args := binary.BigEndian.AppendUint64(nil, math.Float64bits(lat))
+	args = binary.BigEndian.AppendUint64(args, math.Float64bits(long))
+	return command(at, protocol.PayloadType_wpSet, seq, args)
+}
+
+func AltitudeCommand(at time.Duration, seq uint16, alt float32) Command {
+	return command(at, protocol.PayloadType_altSet, seq, binary.BigEndian.AppendUint32(nil, math.Float32bits(alt)))
+}
+
+// one command per chunk, seqs counting up from firstSeq
+func MissionCommands(at time.Duration, firstSeq uint16, items []protocol.MissionItem) ([]Command, error) {
+	chunks, err := protocol.SplitMission(items)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]Command, len(chunks))
+	for i, c := range chunks {
+		commands[i] = command(at, protocol.PayloadType_missionUpload, firstSeq+uint16(i), protocol.NewMissionChunk(c))
+	}
+	return commands, nil
+}
+
+// the fence upload commands, one per chunk
+func FenceCommands(at time.Duration, firstSeq uint16, limits protocol.FenceLimits, items []protocol.FenceItem) ([]Command, error) {
+	chunks, err := protocol.SplitFence(limits, items)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]Command, len(chunks))
+	for i, c := range chunks {
+		commands[i] = command(at, protocol.PayloadType_fenceUpload, firstSeq+uint16(i), protocol.NewFenceChunk(c))
+	}
+	return commands, nil
+}
+
+func AutotuneCommand(at time.Duration, seq uint16, axis, rule byte) Command {
+	return command(at, protocol.PayloadType_autotune, seq, protocol.NewAutotuneArgs(axis, rule))
+}
+
+func AutotuneConfirmCommand(at time.Duration, seq uint16, axis byte, apply bool) Command {
+	return command(at, protocol.PayloadType_autotuneConfirm, seq, protocol.NewAutotuneConfirmArgs(axis, apply))
+}
+
+func command(at time.Duration, payloadType byte, seq uint16, args []byte) Command {
+	return Command{At: at, Frame: protocol.EncodeFrame(protocol.NewCommand(payloadType, seq, args))}
+}
+
+type Sample struct {
+	Time      time.Duration
+	Mode      flightmode.Mode
+	Lat, Long float64
+	State
+	RollTerms, PitchTerms pid.CascadeTerms
+	// what the autopilot thinks, against the true State
+	Estimate navfilter.Estimate
+}
+
+type Sim struct {
+	config Config
+
+	Plane   *Plane
+	Sensors *Sensors
+	Radio   *hal.FakeRadio
+	Clock   *hal.FakeClock
+	Pilot   *autopilot.Autopilot
+
+	start                time.Time
+	nextRadio, nextCheck time.Duration
+	nextSample           time.Duration
+	launchStart          time.Duration
+	launched, launchDone bool
+	gust                 [3]float64
+	rand                 *rand.Rand
+	commands             []Command
+	heartbeatFrame       []byte
+	// of the commands the sim sends on its own
+	groundSeq     uint16
+	answeredGains *protocol.AutotuneGains
+
+	Trajectory []Sample
+}
+
+var errBadConfig = errors.New("sim: duration, sample interval, launch time and qnh must be positive")
+
+func New(config Config) (*Sim, error) {
+	if config.Duration <= 0 || config.SampleInterval <= 0 || config.LaunchTime <= 0 || config.QNH <= 0 {
+		return nil, errBadConfig
+	}
+
+	start := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	s := &Sim{
+		config: config,
+
+		Plane: NewPlane(config.Airframe, config.Heading),
+		Radio: hal.NewFakeRadio(),
+		Clock: hal.NewFakeClock(start),
+
+		start:          start,
+		rand:           rand.New(rand.NewSource(config.Seed)),
+		commands:       config.Commands,
+		groundSeq:      groundSeqStart,
+		heartbeatFrame: protocol.EncodeFrame(protocol.NewPacket(protocol.PayloadType_heartbeat, nil)),
+	}
+	s.Sensors = NewSensors(s.Plane, s.Clock, config.Noise, config.Seed, config.OriginLat, config.OriginLong, config.OriginAlt, config.QNH, config.QNHRate)
+	s.Plane.SetWind(config.Wind[0], config.Wind[1], config.Wind[2])
+
+	var err error
+	s.Pilot, err = autopilot.New(autopilot.Hardware{
+		Attitude:  s.Sensors,
+		Position:  s.Sensors,
+		Barometer: s.Sensors,
+		Radio:     s.Radio,
+		Actuators: s.Plane,
+		Clock:     s.Clock,
+		Storage:   hal.NewFakeStorage(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sim) Elapsed() time.Duration {
+	return s.Clock.Now().Sub(s.start)
+}
+
+// runs until the configured duration or a crash
+func (s *Sim) Run() {
+	for s.Elapsed() < s.config.Duration && !s.Plane.State().Crashed {
+		s.Step()
+	}
+	s.sample(s.Elapsed())
+}
+
+// one pass of each due autopilot loop, then the physics for however long that took
+func (s *Sim) Step() {
+	before := s.Elapsed()
+
+	if before >= s.nextRadio {
+		s.groundTransmit(before)
+		s.Pilot.RadioStep()
+		s.answer(s.Radio.TakeSent(), before)
+		s.nextRadio += radioPeriod
+	}
+	if before >= s.nextCheck {
+		s.Pilot.FailsafeStep()
+		s.nextCheck += checkPeriod
+	}
+
+	s.Pilot.FlightStep()
+	if s.Elapsed()-before < flightPeriod {
+		s.Clock.Advance(flightPeriod - (s.Elapsed() - before))
+	}
+
+	for t := before; t < s.Elapsed(); t += physicsStep {
+		s.launch(t)
+		s.updateGust()
+		s.Plane.Step(physicsStep.Seconds())
+		if t >= s.nextSample {
+			s.sample(t + physicsStep)
+			s.nextSample += s.config.SampleInterval
+		}
+	}
+}
+
+// the plane only listens right after its own transmission, so the ground answers one frame per cycle
+func (s *Sim) groundTransmit(now time.Duration) {
+	if s.config.LinkLostAt > 0 && now >= s.config.LinkLostAt {
+		return
+	}
+	if len(s.commands) > 0 && s.commands[0].At <= now {
+		s.Radio.Deliver(s.commands[0].Frame)
+		s.commands = s.commands[1:]
+		return
+	}
+	s.Radio.Deliver(s.heartbeatFrame)
+}
+
+// applies proposed autotune gains once each, ahead of the scripted commands
+func (s *Sim) answer(sent [][]byte, now time.Duration) {
+	if !s.config.ApplyTunedGains {
+		return
+	}
+	for _, frame := range sent {
+		packet, err := protocol.DecodeFrame(frame)
+		if err != nil {
+			continue
+		}
+		payloadType, payload, err := protocol.ParsePacket(packet)
+		if err != nil || payloadType != protocol.PayloadType_autotuneGains {
+			continue
+		}
+		gains, err := protocol.DecodeAutotuneGains(payload)
+		if err != nil || (s.answeredGains != nil && *s.answeredGains == gains) {
+			continue
+		}
+		s.answeredGains = &gains
+		confirm := AutotuneConfirmCommand(now, s.groundSeq, gains.Axis, true)
+		s.groundSeq++
+		s.commands = append([]Command{confirm}, s.commands...)
+	}
+}
+
+func (s *Sim) launch(t time.Duration) {
+	if !s.launched && s.Pilot.Modes().Mode() == flightmode.Takeoff {
+		s.launched = true
+		s.launchStart = t
+		s.Plane.Push(s.config.LaunchForce)
+	}
+	if s.launched && !s.launchDone && t-s.launchStart >= s.config.LaunchTime {
+		s.launchDone = true
+		s.Plane.Push(0)
+	}
+}
+
+// first order filtered noise so gusts build up over a few seconds instead of every step
+func (s *Sim) updateGust() {
+	if s.config.Gust == 0 {
+		return
+	}
+	const tau = 2.0 // s
+	dt := physicsStep.Seconds()
+	a := dt / tau
+	for i := range s.gust {
+		s.gust[i] += -a*s.gust[i] + s.config.Gust*math.Sqrt(2*a)*s.rand.NormFloat64()
+	}
+	w := s.config.Wind
+	s.Plane.SetWind(w[0]+s.gust[0], w[1]+s.gust[1], w[2]+s.gust[2]/4)
+}
+
+func (s *Sim) sample(at time.Duration) {
+	state := s.Plane.State()
+	lat, long := Offset(s.config.OriginLat, s.config.OriginLong, state.North, state.East)
+	rollTerms, pitchTerms := s.Pilot.ControlTerms()
+	s.Trajectory = append(s.Trajectory, Sample{
+		Time:       at,
+		Mode:       s.Pilot.Modes().Mode(),
+		Lat:        lat,
+		Long:       long,
+		State:      state,
+		RollTerms:  rollTerms,
+		PitchTerms: pitchTerms,
+		Estimate:   s.Pilot.NavEstimate(),
+	})
+}
+
+// root mean square errors of the navigation estimate against the truth, horizontal ones over
+// both axes
+type EstimateErrors struct {
+	Position, Velocity, Wind float64 // m and m/s
+	Altitude, VerticalSpeed  float64
+}
+
+// over the samples the autopilot was flying by the estimate
+func (s *Sim) EstimateErrors() EstimateErrors {
+	var e EstimateErrors
+	var n int
+	for _, x := range s.Trajectory {
+		switch x.Mode {
+		case flightmode.Cruise, flightmode.Loiter, flightmode.RTL, flightmode.Land:
+		default:
+			continue
+		}
+		est := x.Estimate
+		e.Position += math.Pow(nav.Distance(est.Lat, est.Long, x.Lat, x.Long), 2)
+		e.Velocity += math.Pow(est.VelNorth-x.VelNorth, 2) + math.Pow(est.VelEast-x.VelEast, 2)
+		e.Wind += math.Pow(est.WindNorth-x.WindNorth, 2) + math.Pow(est.WindEast-x.WindEast, 2)
+		e.Altitude += math.Pow(est.Alt-s.config.OriginAlt-x.Altitude(), 2)
+		e.VerticalSpeed += math.Pow(est.VelDown-x.VelDown, 2)
+		n++
+	}
+	if n == 0 {
+		return e
+	}
+	for _, v := range []*float64{&e.Position, &e.Velocity, &e.Wind, &e.Altitude, &e.VerticalSpeed} {
+		*v = math.Sqrt(*v / float64(n))
+	}
+	return e
+}
+
+var csvHeader = []string{
+	"time", "mode", "lat", "long", "north", "east", "altitude",
+	"roll", "pitch", "heading", "airspeed", "groundspeed", "vertical_speed",
+	"aileron", "elevator", "rudder", "throttle",
+	"roll_angle_p", "roll_rate_p", "roll_rate_i", "roll_rate_d",
+	"pitch_angle_p", "pitch_rate_p", "pitch_rate_i", "pitch_rate_d",
+	"est_altitude", "est_altitude_std", "est_vertical_speed", "est_vertical_speed_std", "est_baro_drift",
+	"wind_north", "wind_east",
+	"est_lat", "est_long", "est_position_std", "est_vel_north", "est_vel_east", "est_velocity_std",
+	"est_wind_north", "est_wind_east", "est_wind_std", "est_faults",
+}
+
+// one row per sample, ready for a spreadsheet or a plotting script
+func WriteCSV(w io.Writer, trajectory []Sample) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+	f := func(v float64, prec int) string { return strconv.FormatFloat(v, 'f', prec, 64) }
+	for _, s := range trajectory {
+		err := out.Write([]string{
+			f(s.Time.Seconds(), 3), s.Mode.String(), f(s.Lat, 7), f(s.Long, 7),
+			f(s.North, 2), f(s.East, 2), f(s.Altitude(), 2),
+			f(s.Roll, 2), f(s.Pitch, 2), f(s.Heading, 2),
+			f(s.Airspeed, 2), f(s.GroundSpeed(), 2), f(-s.VelDown, 2),
+			f(s.Aileron, 3), f(s.Elevator, 3), f(s.Rudder, 3), f(s.Throttle, 3),
+			f(float64(s.RollTerms.Angle.P), 3), f(float64(s.RollTerms.Rate.P), 3),
+			f(float64(s.RollTerms.Rate.I), 3), f(float64(s.RollTerms.Rate.D), 3),
+			f(float64(s.PitchTerms.Angle.P), 3), f(float64(s.PitchTerms.Rate.P), 3),
+			f(float64(s.PitchTerms.Rate.I), 3), f(float64(s.PitchTerms.Rate.D), 3),
+			f(s.Estimate.Alt, 2), f(s.Estimate.Vertical.AltitudeStdDev(), 2),
+			f(-s.Estimate.VelDown, 2), f(s.Estimate.Vertical.VerticalSpeedStdDev(), 2), f(s.Estimate.Vertical.BaroDrift, 2),
+			f(s.WindNorth, 2), f(s.WindEast, 2),
+			f(s.Estimate.Lat, 7), f(s.Estimate.Long, 7), f(s.Estimate.PositionStdDev(), 2),
+			f(s.Estimate.VelNorth, 2), f(s.Estimate.VelEast, 2), f(s.Estimate.VelocityStdDev(), 2),
+			f(s.Estimate.WindNorth, 2), f(s.Estimate.WindEast, 2), f(s.Estimate.WindStdDev(), 2),
+			s.Estimate.Faults.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
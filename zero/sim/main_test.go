@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+	"zero/barometer"
+	"zero/flightmode"
+
+	"protocol"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const testWpNorth, testWpEast, testAlt = 400, 300, 60 // m from the launch point
+
+// the scripted flight of cmd/sim
+func testConfig(duration time.Duration) Config {
+	config := DefaultConfig()
+	config.Duration = duration
+	wpLat, wpLong := Offset(config.OriginLat, config.OriginLong, testWpNorth, testWpEast)
+	config.Commands = []Command{
+		AltitudeCommand(0, 1, float32(config.OriginAlt+testAlt)),
+		WaypointCommand(0, 2, wpLat, wpLong),
+		TakeoffCommand(0, 3),
+	}
+	return config
+}
+
+func run(t *testing.T, config Config) *Sim {
+	t.Helper()
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	final := s.Trajectory[len(s.Trajectory)-1]
+	if final.Crashed {
+		t.Fatalf("crashed at %v in %v, %.1fm north %.1fm east", final.Time, final.Mode, final.North, final.East)
+	}
+	if final.Time < config.Duration {
+		t.Fatalf("stopped at %v of %v", final.Time, config.Duration)
+	}
+	return s
+}
+
+// the modes in the order they were flown
+func modes(trajectory []Sample) []flightmode.Mode {
+	var flown []flightmode.Mode
+	for _, x := range trajectory {
+		if len(flown) == 0 || flown[len(flown)-1] != x.Mode {
+			flown = append(flown, x.Mode)
+		}
+	}
+	return flown
+}
+
+func TestWaypointFlight(t *testing.T) {
+	s := run(t, testConfig(4*time.Minute))
+
+	closest := math.Inf(1)
+	for _, x := range s.Trajectory {
+		closest = math.Min(closest, math.Hypot(x.North-testWpNorth, x.East-testWpEast))
+	}
+	if closest > 30 {
+		t.Errorf("came no closer than %.1fm to the waypoint", closest)
+	}
+
+	want := []flightmode.Mode{flightmode.Idle, flightmode.Takeoff, flightmode.Cruise}
+	if got := modes(s.Trajectory); !equalModes(got, want) {
+		t.Errorf("flew %v, want %v", got, want)
+	}
+
+	// the last minute is spent circling the waypoint at the target altitude
+	for _, x := range s.Trajectory {
+		if x.Time < 3*time.Minute {
+			continue
+		}
+		if d := math.Hypot(x.North-testWpNorth, x.East-testWpEast); d > 100 {
+			t.Fatalf("%.1fm from the waypoint at %v", d, x.Time)
+		}
+		if math.Abs(x.Altitude()-testAlt) > 10 {
+			t.Fatalf("at %.1fm at %v, want %vm", x.Altitude(), x.Time, testAlt)
+		}
+	}
+}
+
+// without the ground the plane loiters, comes home and lands there
+func TestLinkLostFlight(t *testing.T) {
+	config := testConfig(12 * time.Minute)
+	config.LinkLostAt = time.Minute
+	s := run(t, config)
+
+	want := []flightmode.Mode{
+		flightmode.Idle, flightmode.Takeoff, flightmode.Cruise,
+		flightmode.Loiter, flightmode.RTL, flightmode.Land, flightmode.Idle,
+	}
+	if got := modes(s.Trajectory); !equalModes(got, want) {
+		t.Errorf("flew %v, want %v", got, want)
+	}
+	final := s.Trajectory[len(s.Trajectory)-1]
+	if d := math.Hypot(final.North, final.East); d > 200 {
+		t.Errorf("landed %.1fm from home", d)
+	}
+	if final.Altitude() > 1 || final.GroundSpeed() > 1 {
+		t.Errorf("still moving at %.1fm, %.1fm/s", final.Altitude(), final.GroundSpeed())
+	}
+}
+
+func equalModes(a, b []flightmode.Mode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// the ground applies the tuned roll gains and the plane carries on with them
+func TestAutotuneFlight(t *testing.T) {
+	config := testConfig(4 * time.Minute)
+	config.ApplyTunedGains = true
+	config.Commands = append(config.Commands, AutotuneCommand(time.Minute, 4, protocol.AutotuneAxis_roll, protocol.AutotuneRule_tyreusLuyben))
+	s := run(t, config)
+
+	if s.answeredGains == nil || s.answeredGains.Axis != protocol.AutotuneAxis_roll {
+		t.Fatalf("applied %+v, want roll gains", s.answeredGains)
+	}
+	if final := s.Trajectory[len(s.Trajectory)-1]; final.Mode != flightmode.Cruise {
+		t.Errorf("final mode %v, want cruise", final.Mode)
+	}
+}
+
+// a front moving through raises the pressure by 3.6hPa an hour, the barometer sinks by the best
+// part of 5m over the flight and the gps pulls the estimate back onto the true altitude
+func TestBaroDriftFlight(t *testing.T) {
+	config := testConfig(10 * time.Minute)
+	config.QNHRate = 0.1
+	s := run(t, config)
+
+	e := s.EstimateErrors()
+	if e.Altitude > 1.5 || e.VerticalSpeed > 0.2 {
+		t.Errorf("altitude rms %.2fm, vertical speed rms %.2fm/s", e.Altitude, e.VerticalSpeed)
+	}
+
+	// the ground reference is taken at arming, right at the start, so the drift is against the
+	// qnh the flight started with
+	for _, x := range s.Trajectory {
+		if x.Time < 5*time.Minute {
+			continue
+		}
+		alt := config.OriginAlt + x.Altitude()
+		qnh := config.QNH + config.QNHRate*x.Time.Seconds()
+		drift := barometer.PressureAltitude(barometer.AltitudePressure(alt, qnh), config.QNH) - alt
+		if d := x.Estimate.Vertical.BaroDrift - drift; math.Abs(d) > 2 {
+			t.Fatalf("baro drift %.2fm at %v, want %.2fm", x.Estimate.Vertical.BaroDrift, x.Time, drift)
+		}
+	}
+}
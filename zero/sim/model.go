@@ -0,0 +1,270 @@
+package sim
+
+import (
+	"math"
+	"sync"
+)
+
+const degToRad = math.Pi / 180
+
+// rigid body fixed wing, north east down world frame and forward right down body frame.
+// surface demands follow actuator.Actuators: positive roll is right wing down,
+// positive pitch is nose up and positive yaw is nose right
+type Plane struct {
+	mu sync.Mutex
+
+	frame Airframe
+	// north east down, m/s
+	wind [3]float64
+
+	pos, vel [3]float64
+	// body to world rotation
+	att [4]float64
+	// body rates, rad/s
+	rates [3]float64
+	// last body acceleration without gravity, what the BNO055 reports as linear accel
+	accel [3]float64
+
+	aileron, elevator, rudder, throttle float64
+	// external push along the body x axis, used for the launch
+	push float64
+
+	onGround, crashed bool
+}
+
+// sits on the ground at the origin pointing at heading (degrees)
+func NewPlane(frame Airframe, heading float64) *Plane {
+	p := &Plane{frame: frame, onGround: true}
+	p.att = quatFromEuler(0, 0, heading*degToRad)
+	return p
+}
+
+func (p *Plane) SetAttitude(roll, pitch, yaw float32) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.aileron = clamp(float64(roll), -1, 1)
+	p.elevator = clamp(float64(pitch), -1, 1)
+	p.rudder = clamp(float64(yaw), -1, 1)
+	return nil
+}
+
+func (p *Plane) SetThrottle(throttle float32) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.throttle = clamp(float64(throttle), 0, 1)
+	return nil
+}
+
+func (p *Plane) Neutral() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.aileron, p.elevator, p.rudder, p.throttle = 0, 0, 0, 0
+	return nil
+}
+
+func (p *Plane) SetWind(north, east, down float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wind = [3]float64{north, east, down}
+}
+
+// snapshot of the true state
+type State struct {
+	North, East, Down            float64 // m from the origin
+	VelNorth, VelEast, VelDown   float64 // m/s
+	Roll, Pitch, Heading         float64 // degrees, heading [0..360)
+	RollRate, PitchRate, YawRate float64 // degrees/s
+	AccelX, AccelY, AccelZ       float64 // m/s^2 body frame, gravity removed
+	Airspeed                     float64 // m/s
+	WindNorth, WindEast          float64 // m/s, where the air moves to
+	Aileron, Elevator, Rudder    float64
+	Throttle                     float64
+	OnGround, Crashed            bool
+}
+
+func (s State) Altitude() float64    { return -s.Down }
+func (s State) GroundSpeed() float64 { return math.Hypot(s.VelNorth, s.VelEast) }
+
+func (p *Plane) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	roll, pitch, yaw := quatToEuler(p.att)
+	heading := math.Mod(yaw/degToRad+360, 360)
+	air := p.airVelocity()
+	return State{
+		North: p.pos[0], East: p.pos[1], Down: p.pos[2],
+		VelNorth: p.vel[0], VelEast: p.vel[1], VelDown: p.vel[2],
+		Roll: roll / degToRad, Pitch: pitch / degToRad, Heading: heading,
+		RollRate: p.rates[0] / degToRad, PitchRate: p.rates[1] / degToRad, YawRate: p.rates[2] / degToRad,
+		AccelX: p.accel[0], AccelY: p.accel[1], AccelZ: p.accel[2],
+		Airspeed:  math.Sqrt(air[0]*air[0] + air[1]*air[1] + air[2]*air[2]),
+		WindNorth: p.wind[0], WindEast: p.wind[1],
+		Aileron: p.aileron, Elevator: p.elevator, Rudder: p.rudder,
+		Throttle: p.throttle,
+		OnGround: p.onGround, Crashed: p.crashed,
+	}
+}
+
+// sets the launch push in newtons, zero once the plane is released
+func (p *Plane) Push(force float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.push = force
+}
+
+// integrates the equations of motion over dt seconds
+func (p *Plane) Step(dt float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.crashed {
+		return
+	}
+	f := &p.frame
+
+	// air relative velocity in the body frame
+	air := rotateInv(p.att, p.airVelocity())
+	u, v, w := air[0], air[1], air[2]
+	speed := math.Sqrt(u*u + v*v + w*w)
+
+	force := [3]float64{f.MaxThrust*p.throttle + p.push, 0, 0}
+	var moment [3]float64
+	if speed > 1 {
+		alpha := math.Atan2(w, u)
+		beta := math.Asin(clamp(v/speed, -1, 1))
+		qbar := 0.5 * airDensity * speed * speed
+
+		cl := f.CL0 + f.CLAlpha*alpha
+		if math.Abs(alpha) > f.StallAlpha {
+			// lift falls away past the stall instead of growing forever
+			peak := f.CL0 + f.CLAlpha*math.Copysign(f.StallAlpha, alpha)
+			cl = peak * math.Max(0.3, 1-2*(math.Abs(alpha)-f.StallAlpha))
+		}
+		cd := f.CD0 + f.InducedDrag*cl*cl
+		lift := qbar * f.WingArea * cl
+		drag := qbar * f.WingArea * cd
+		side := qbar * f.WingArea * f.CYBeta * beta
+
+		ca, sa := math.Cos(alpha), math.Sin(alpha)
+		force[0] += -drag*ca + lift*sa
+		force[1] += side
+		force[2] += -drag*sa - lift*ca
+
+		// rate damping terms use non dimensional rates
+		pHat := p.rates[0] * f.Span / (2 * speed)
+		qHat := p.rates[1] * f.Chord / (2 * speed)
+		rHat := p.rates[2] * f.Span / (2 * speed)
+		moment[0] = qbar * f.WingArea * f.Span * (f.ClBeta*beta + f.ClP*pHat + f.ClAileron*p.aileron)
+		moment[1] = qbar * f.WingArea * f.Chord * (f.Cm0 + f.CmAlpha*alpha + f.CmQ*qHat + f.CmElevator*p.elevator)
+		moment[2] = qbar * f.WingArea * f.Span * (f.CnBeta*beta + f.CnR*rHat + f.CnRudder*p.rudder)
+	}
+
+	// translation in the world frame
+	accelWorld := rotate(p.att, [3]float64{force[0] / f.Mass, force[1] / f.Mass, force[2] / f.Mass})
+	accelWorld[2] += gravity
+	if p.onGround {
+		// the ground holds the weight and drags the wheels
+		if accelWorld[2] > 0 {
+			accelWorld[2] = 0
+		}
+		ground := math.Hypot(p.vel[0], p.vel[1])
+		if ground > 0 {
+			friction := math.Min(0.1*gravity, ground/dt)
+			accelWorld[0] -= friction * p.vel[0] / ground
+			accelWorld[1] -= friction * p.vel[1] / ground
+		}
+	}
+	for i := range 3 {
+		p.vel[i] += accelWorld[i] * dt
+		p.pos[i] += p.vel[i] * dt
+	}
+	p.accel = rotateInv(p.att, accelWorld)
+
+	// rotation, principal axes only
+	rates := p.rates
+	p.rates[0] += (moment[0] - (f.Izz-f.Iyy)*rates[1]*rates[2]) / f.Ixx * dt
+	p.rates[1] += (moment[1] - (f.Ixx-f.Izz)*rates[0]*rates[2]) / f.Iyy * dt
+	p.rates[2] += (moment[2] - (f.Iyy-f.Ixx)*rates[0]*rates[1]) / f.Izz * dt
+	p.att = quatIntegrate(p.att, p.rates, dt)
+
+	// ground contact
+	if p.pos[2] >= 0 {
+		if !p.onGround && (p.vel[2] > crashSinkRate) {
+			p.crashed = true
+		}
+		p.pos[2] = 0
+		if p.vel[2] > 0 {
+			p.vel[2] = 0
+		}
+		p.onGround = true
+		// wheels keep the wings level
+		_, pitch, yaw := quatToEuler(p.att)
+		p.att = quatFromEuler(0, math.Max(pitch, 0), yaw)
+		p.rates[0] = 0
+		p.rates[1] = math.Max(p.rates[1], 0)
+	} else if p.pos[2] < -0.1 {
+		p.onGround = false
+	}
+}
+
+// mu must be held
+func (p *Plane) airVelocity() [3]float64 {
+	return [3]float64{p.vel[0] - p.wind[0], p.vel[1] - p.wind[1], p.vel[2] - p.wind[2]}
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(v, hi))
+}
+
+func quatFromEuler(roll, pitch, yaw float64) [4]float64 {
+	cr, sr := math.Cos(roll/2), math.Sin(roll/2)
+	cp, sp := math.Cos(pitch/2), math.Sin(pitch/2)
+	cy, sy := math.Cos(yaw/2), math.Sin(yaw/2)
+	return [4]float64{
+		cr*cp*cy + sr*sp*sy,
+		sr*cp*cy - cr*sp*sy,
+		cr*sp*cy + sr*cp*sy,
+		cr*cp*sy - sr*sp*cy,
+	}
+}
+
+func quatToEuler(q [4]float64) (roll, pitch, yaw float64) {
+	roll = math.Atan2(2*(q[0]*q[1]+q[2]*q[3]), 1-2*(q[1]*q[1]+q[2]*q[2]))
+	pitch = math.Asin(clamp(2*(q[0]*q[2]-q[3]*q[1]), -1, 1))
+	yaw = math.Atan2(2*(q[0]*q[3]+q[1]*q[2]), 1-2*(q[2]*q[2]+q[3]*q[3]))
+	return
+}
+
+func quatIntegrate(q [4]float64, rates [3]float64, dt float64) [4]float64 {
+	p, r, y := rates[0], rates[1], rates[2]
+	dq := [4]float64{
+		0.5 * (-q[1]*p - q[2]*r - q[3]*y),
+		0.5 * (q[0]*p + q[2]*y - q[3]*r),
+		0.5 * (q[0]*r - q[1]*y + q[3]*p),
+		0.5 * (q[0]*y + q[1]*r - q[2]*p),
+	}
+	var n float64
+	for i := range q {
+		q[i] += dq[i] * dt
+		n += q[i] * q[i]
+	}
+	n = math.Sqrt(n)
+	for i := range q {
+		q[i] /= n
+	}
+	return q
+}
+
+// body to world
+func rotate(q [4]float64, v [3]float64) [3]float64 {
+	w, x, y, z := q[0], q[1], q[2], q[3]
+	return [3]float64{
+		(1-2*(y*y+z*z))*v[0] + 2*(x*y-w*z)*v[1] + 2*(x*z+w*y)*v[2],
+		2*(x*y+w*z)*v[0] + (1-2*(x*x+z*z))*v[1] + 2*(y*z-w*x)*v[2],
+		2*(x*z-w*y)*v[0] + 2*(y*z+w*x)*v[1] + (1-2*(x*x+y*y))*v[2],
+	}
+}
+
+// world to body
+func rotateInv(q [4]float64, v [3]float64) [3]float64 {
+	return rotate([4]float64{q[0], -q[1], -q[2], -q[3]}, v)
+}
@@ -0,0 +1,144 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+	"zero/barometer"
+	"zero/hal"
+)
+
+// noise is one standard deviation
+type Noise struct {
+	Euler    float64 // degrees
+	Gyro     float64 // degrees/s
+	Accel    float64 // m/s^2
+	Position float64 // m, horizontal
+	Velocity float64 // m/s, horizontal
+	Altitude float64 // m
+	Pressure float64 // pascals
+}
+
+func DefaultNoise() Noise {
+	return Noise{Euler: 0.5, Gyro: 0.2, Accel: 0.2, Position: 2, Velocity: 0.1, Altitude: 4, Pressure: 2}
+}
+
+// simulated BNO055, NEO6M and BMP390 reading the true state of a plane,
+// the gps fix only changes once per gpsPeriod like the real module
+type Sensors struct {
+	mu    sync.Mutex
+	plane *Plane
+	clock hal.Clock
+	noise Noise
+	rand  *rand.Rand
+
+	originLat, originLong, originAlt float64
+	// the weather moves the sea level pressure by qnhRate pascals per second from start
+	qnh, qnhRate float64
+	start        time.Time
+
+	fixAt               time.Time
+	lat, long, alt      float64
+	groundSpeed, course float64
+}
+
+func NewSensors(plane *Plane, clock hal.Clock, noise Noise, seed int64, originLat, originLong, originAlt, qnh, qnhRate float64) *Sensors {
+	return &Sensors{
+		plane: plane,
+		clock: clock,
+		noise: noise,
+		rand:  rand.New(rand.NewSource(seed)),
+
+		originLat:  originLat,
+		originLong: originLong,
+		originAlt:  originAlt,
+		qnh:        qnh,
+		qnhRate:    qnhRate,
+		start:      clock.Now(),
+	}
+}
+
+func (s *Sensors) ReadEuler() (heading, roll, pitch float32, err error) {
+	state := s.plane.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heading = float32(math.Mod(state.Heading+s.gauss(s.noise.Euler)+360, 360))
+	roll = float32(state.Roll + s.gauss(s.noise.Euler))
+	pitch = float32(state.Pitch + s.gauss(s.noise.Euler))
+	return heading, roll, pitch, nil
+}
+
+func (s *Sensors) ReadAngularVelocity() (x, y, z float32, err error) {
+	state := s.plane.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x = float32(state.RollRate + s.gauss(s.noise.Gyro))
+	y = float32(state.PitchRate + s.gauss(s.noise.Gyro))
+	z = float32(state.YawRate + s.gauss(s.noise.Gyro))
+	return x, y, z, nil
+}
+
+func (s *Sensors) ReadLinearAccel() (x, y, z float32, err error) {
+	state := s.plane.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x = float32(state.AccelX + s.gauss(s.noise.Accel))
+	y = float32(state.AccelY + s.gauss(s.noise.Accel))
+	z = float32(state.AccelZ + s.gauss(s.noise.Accel))
+	return x, y, z, nil
+}
+
+func (s *Sensors) ReadTemperature() (int8, error) {
+	return 20, nil
+}
+
+func (s *Sensors) LatLongAlt() (lat, long, alt float64, err error) {
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fixAt.IsZero() || now.Sub(s.fixAt) >= gpsPeriod {
+		state := s.plane.State()
+		north := state.North + s.gauss(s.noise.Position)
+		east := state.East + s.gauss(s.noise.Position)
+		s.lat, s.long = Offset(s.originLat, s.originLong, north, east)
+		s.alt = s.originAlt + state.Altitude() + s.gauss(s.noise.Altitude)
+		velNorth := state.VelNorth + s.gauss(s.noise.Velocity)
+		velEast := state.VelEast + s.gauss(s.noise.Velocity)
+		s.groundSpeed = math.Hypot(velNorth, velEast)
+		s.course = math.Mod(math.Atan2(velEast, velNorth)/degToRad+360, 360)
+		s.fixAt = now
+	}
+	return s.lat, s.long, s.alt, nil
+}
+
+// from the same fix as LatLongAlt
+func (s *Sensors) Velocity() (groundSpeed, course float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.groundSpeed, s.course, nil
+}
+
+// a fresh measurement on every read, the real one updates at 50Hz
+func (s *Sensors) ReadPressure() (float64, error) {
+	state := s.plane.State()
+	qnh := s.qnh + s.qnhRate*s.clock.Now().Sub(s.start).Seconds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return barometer.AltitudePressure(s.originAlt+state.Altitude(), qnh) + s.gauss(s.noise.Pressure), nil
+}
+
+// mu must be held
+func (s *Sensors) gauss(stddev float64) float64 {
+	if stddev == 0 {
+		return 0
+	}
+	return s.rand.NormFloat64() * stddev
+}
+
+// flat earth offset in meters from a point, plenty for a few kilometers
+func Offset(lat, long, north, east float64) (float64, float64) {
+	lat2 := lat + north/earthR/degToRad
+	long2 := long + east/(earthR*math.Cos(lat*degToRad))/degToRad
+	return lat2, long2
+}
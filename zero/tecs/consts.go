@@ -0,0 +1,13 @@
+package tecs
+
+const (
+	gravity = 9.81 // m/s^2
+
+	degToRad = 0.017453292519943295
+	radToDeg = 57.29577951308232
+
+	// a gap this long between updates means the estimates are stale, start over
+	maxUpdateGap = 1 // seconds
+	// below this the pitch gain would blow up, m/s
+	minGainSpeed = 3
+)
@@ -0,0 +1,221 @@
+package tecs
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// total energy control: throttle adds or removes energy, pitch trades it between height and
+// speed. the specific total energy error (height and speed error together) goes to the throttle,
+// the balance between them (height error against speed error) goes to the pitch, so a climb
+// asks for throttle instead of just pulling up and bleeding speed into a stall
+
+type Config struct {
+	// how quickly height and speed errors are closed, seconds
+	TimeConst float64
+	// damping on the energy rate errors, throttle and pitch loop
+	ThrottleDamp, PitchDamp float64
+	// integrator gain on the energy errors, 1/s
+	IntegratorGain float64
+	// 0 flies height only, 2 speed only, 1 weighs both equally. speed only is what gliders do
+	SpeedWeight float64
+
+	// climb rate at full throttle and sink rate at idle, both at cruise speed, m/s
+	MaxClimb, MinSink float64
+	// fastest descent ever asked for, m/s
+	MaxSink float64
+	// allowed speed range and the fastest speed change asked for, m/s and m/s^2
+	MinAirspeed, MaxAirspeed float64
+	MaxAccel                 float64
+
+	// throttle [0..1] range and what holds level flight at cruise speed
+	MinThrottle, MaxThrottle, CruiseThrottle float64
+	// pitch range in degrees, nose up positive
+	MinPitch, MaxPitch float64
+
+	// crossover of the height/vertical acceleration and speed/forward acceleration
+	// complementary filters, rad/s. lower trusts the accelerometer for longer
+	HeightFilterOmega, SpeedFilterOmega float64
+}
+
+var ErrBadConfig = errors.New("tecs: time constant, climb, sink, speed range and throttle range must be positive and ordered")
+
+// measurements for one update
+type Input struct {
+	Height   float64 // m
+	Airspeed float64 // m/s
+	// acceleration without gravity, upwards in the world frame and along the body x axis, m/s^2
+	VerticalAccel, ForwardAccel float64
+}
+
+type Output struct {
+	Throttle float64 // [0..1]
+	Pitch    float64 // degrees, nose up positive
+	// too slow with the throttle already at the limit, height is given up to get speed back
+	Underspeed bool
+}
+
+type TECS struct {
+	config Config
+
+	// demands after the rate limits
+	heightDemand, speedDemand float64
+	// complementary filter states
+	height, climbRate, heightAccelBias float64
+	speed, speedRate, speedIntegral    float64
+	// already in throttle and radians
+	throttleIntegral, pitchIntegral float64
+
+	last Output
+	// the states are only valid after Reset or the first Update
+	initialised bool
+	lastUpdate  time.Time
+}
+
+func New(config Config) (*TECS, error) {
+	c := config
+	if c.TimeConst <= 0 || c.MaxClimb <= 0 || c.MinSink <= 0 || c.MaxSink < c.MinSink ||
+		c.MinAirspeed <= 0 || c.MaxAirspeed <= c.MinAirspeed || c.MaxAccel <= 0 ||
+		c.MinThrottle < 0 || c.MaxThrottle > 1 || c.MaxThrottle <= c.MinThrottle ||
+		c.CruiseThrottle < c.MinThrottle || c.CruiseThrottle > c.MaxThrottle ||
+		c.MaxPitch <= c.MinPitch || c.HeightFilterOmega <= 0 || c.SpeedFilterOmega <= 0 {
+		return nil, ErrBadConfig
+	}
+	return &TECS{config: config}, nil
+}
+
+// starts over from the given measurements with the integrators set up so that the next
+// Update carries on from throttle, whatever was driving it until now
+func (t *TECS) Reset(in Input, throttle float64, now time.Time) {
+	c := &t.config
+	t.height, t.climbRate, t.heightAccelBias = in.Height, 0, 0
+	t.speed, t.speedRate, t.speedIntegral = in.Airspeed, 0, 0
+	t.heightDemand = in.Height
+	t.speedDemand = clamp(in.Airspeed, c.MinAirspeed, c.MaxAirspeed)
+	t.throttleIntegral = clamp(throttle, c.MinThrottle, c.MaxThrottle) - c.CruiseThrottle
+	t.pitchIntegral = 0
+	t.last = Output{Throttle: throttle}
+	t.initialised = true
+	t.lastUpdate = now
+}
+
+// flies towards height (m) and speed (m/s)
+func (t *TECS) Update(in Input, height, speed float64, now time.Time) Output {
+	dt := now.Sub(t.lastUpdate).Seconds()
+	if !t.initialised || dt > maxUpdateGap {
+		t.Reset(in, t.last.Throttle, now)
+		dt = 0
+	}
+	t.lastUpdate = now
+	if dt <= 0 {
+		dt = 1e-3
+	}
+	c := &t.config
+
+	t.updateHeight(in, dt)
+	t.updateSpeed(in, dt)
+
+	// demands move no faster than the plane can follow
+	speed = clamp(speed, c.MinAirspeed, c.MaxAirspeed)
+	t.speedDemand += clamp(speed-t.speedDemand, -c.MaxAccel*dt, c.MaxAccel*dt)
+	speedRateDemand := clamp((t.speedDemand-t.speed)/c.TimeConst, -c.MaxAccel, c.MaxAccel)
+
+	t.heightDemand += clamp(height-t.heightDemand, -c.MaxSink*dt, c.MaxClimb*dt)
+	climbDemand := clamp((t.heightDemand-t.height)/c.TimeConst, -c.MaxSink, c.MaxClimb)
+
+	// specific energies, potential and kinetic
+	spe, ske := t.height*gravity, 0.5*t.speed*t.speed
+	speRate, skeRate := t.climbRate*gravity, t.speed*t.speedRate
+	speDemand, skeDemand := t.heightDemand*gravity, 0.5*t.speedDemand*t.speedDemand
+	speRateDemand, skeRateDemand := climbDemand*gravity, t.speed*speedRateDemand
+
+	underspeed := t.speed < c.MinAirspeed && t.last.Throttle >= c.MaxThrottle
+	throttle := t.throttle(spe+ske, speRate+skeRate, speDemand+skeDemand, speRateDemand+skeRateDemand, dt)
+
+	// how much height and speed each count in the balance, speed wins when about to stall
+	skeWeight := clamp(c.SpeedWeight, 0, 2)
+	if underspeed {
+		skeWeight = 2
+	}
+	speWeight := min(2-skeWeight, 1)
+	skeWeight = min(skeWeight, 1)
+	pitch := t.pitch(
+		spe*speWeight-ske*skeWeight, speRate*speWeight-skeRate*skeWeight,
+		speDemand*speWeight-skeDemand*skeWeight, speRateDemand*speWeight-skeRateDemand*skeWeight, dt)
+
+	t.last = Output{Throttle: throttle, Pitch: pitch * radToDeg, Underspeed: underspeed}
+	return t.last
+}
+
+// third order complementary filter, height from the sensor and its rate from the accelerometer
+func (t *TECS) updateHeight(in Input, dt float64) {
+	w := t.config.HeightFilterOmega
+	err := in.Height - t.height
+	t.heightAccelBias += err * w * w * w * dt
+	t.climbRate += (t.heightAccelBias + in.VerticalAccel + err*w*w*3) * dt
+	t.height += (t.climbRate + err*w*3) * dt
+}
+
+// second order complementary filter on the speed
+func (t *TECS) updateSpeed(in Input, dt float64) {
+	w := t.config.SpeedFilterOmega
+	err := in.Airspeed - t.speed
+	t.speedIntegral += err * w * w * dt
+	t.speedRate = t.speedIntegral + in.ForwardAccel
+	t.speed += (t.speedRate + err*w*math.Sqrt2) * dt
+	t.speed = max(t.speed, 0)
+}
+
+// total energy error to throttle, on top of what the demanded energy rate needs
+func (t *TECS) throttle(ste, steRate, steDemand, steRateDemand, dt float64) float64 {
+	c := &t.config
+	maxRate, minRate := c.MaxClimb*gravity, -c.MinSink*gravity
+	// energy rate per unit of throttle
+	rateGain := (maxRate - minRate) / (c.MaxThrottle - c.MinThrottle)
+	steRateDemand = clamp(steRateDemand, minRate, maxRate)
+
+	steErr := steDemand - ste
+	steRateErr := steRateDemand - steRate
+	k := 1 / (c.TimeConst * rateGain)
+	feedforward := c.CruiseThrottle + steRateDemand/rateGain
+	out := (steErr+steRateErr*c.ThrottleDamp)*k + feedforward
+
+	// the integrator only takes up what is left of the range
+	t.throttleIntegral = clampIntegral(t.throttleIntegral+steErr*c.IntegratorGain*k*dt,
+		c.MinThrottle-out, c.MaxThrottle-out)
+	return clamp(out+t.throttleIntegral, c.MinThrottle, c.MaxThrottle)
+}
+
+// energy balance error to pitch in radians
+func (t *TECS) pitch(seb, sebRate, sebDemand, sebRateDemand, dt float64) float64 {
+	c := &t.config
+	minPitch, maxPitch := c.MinPitch*degToRad, c.MaxPitch*degToRad
+	// a pitch of theta trades energy at about g*V*theta
+	gain := 1 / (gravity * max(t.speed, minGainSpeed) * c.TimeConst)
+
+	sebErr := sebDemand - seb
+	sebRateErr := sebRateDemand - sebRate
+	out := (sebErr + sebRateDemand*c.TimeConst + sebRateErr*c.PitchDamp) * gain
+
+	t.pitchIntegral = clampIntegral(t.pitchIntegral+sebErr*c.IntegratorGain*gain*dt, minPitch-out, maxPitch-out)
+	return clamp(out+t.pitchIntegral, minPitch, maxPitch)
+}
+
+// filtered height (m), climb rate (m/s) and speed (m/s)
+func (t *TECS) Estimates() (height, climbRate, speed float64) {
+	return t.height, t.climbRate, t.speed
+}
+
+func (t *TECS) Last() Output {
+	return t.last
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return max(lo, min(v, hi))
+}
+
+// an integrator may always shrink towards zero, even when the rest already went past the limit
+func clampIntegral(v, lo, hi float64) float64 {
+	return clamp(v, min(lo, 0), max(hi, 0))
+}
@@ -0,0 +1,191 @@
+package tecs
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	TimeConst:      8,
+	ThrottleDamp:   0.5,
+	PitchDamp:      0.3,
+	IntegratorGain: 0.1,
+	SpeedWeight:    1,
+
+	MaxClimb: 5,
+	MinSink:  2,
+	MaxSink:  4,
+
+	MinAirspeed: 10,
+	MaxAirspeed: 22,
+	MaxAccel:    2,
+
+	MinThrottle:    0,
+	MaxThrottle:    1,
+	CruiseThrottle: 0.3,
+	MinPitch:       -15,
+	MaxPitch:       20,
+
+	HeightFilterOmega: 1,
+	SpeedFilterOmega:  2,
+}
+
+// a point mass that flies where it points: the throttle above cruise is excess power, pitch
+// turns speed into height and back, and drag pulls the speed back to cruise
+type plane struct {
+	height, speed float64
+	// fraction of the power the config was made for, a weak engine climbs slower
+	power float64
+}
+
+const cruiseSpeed = 15
+
+func (p *plane) input() Input {
+	return Input{Height: p.height, Airspeed: p.speed}
+}
+
+func (p *plane) fly(out Output, dt float64) {
+	c := testConfig
+	// full throttle holds cruise speed in a MaxClimb climb, idle in a MinSink glide
+	thrust := (out.Throttle - c.CruiseThrottle) * c.MaxClimb * gravity / (cruiseSpeed * (c.MaxThrottle - c.CruiseThrottle))
+	if out.Throttle < c.CruiseThrottle {
+		thrust = (out.Throttle - c.CruiseThrottle) * c.MinSink * gravity / (cruiseSpeed * (c.CruiseThrottle - c.MinThrottle))
+	}
+	sin := math.Sin(out.Pitch * degToRad)
+	accel := thrust*p.power - gravity*sin - 0.3*(p.speed-cruiseSpeed)
+	p.speed += accel * dt
+	p.height += p.speed * sin * dt
+}
+
+// flies to height at cruise speed, returning the lowest and highest speed on the way
+func fly(t *testing.T, p *plane, height float64, duration time.Duration, each func(Output)) (slowest, fastest float64) {
+	t.Helper()
+	tecs, err := New(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const dt = 20 * time.Millisecond
+	now := time.Unix(0, 0)
+	tecs.Reset(p.input(), testConfig.CruiseThrottle, now)
+	slowest, fastest = p.speed, p.speed
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += dt {
+		now = now.Add(dt)
+		out := tecs.Update(p.input(), height, cruiseSpeed, now)
+		p.fly(out, dt.Seconds())
+		slowest, fastest = min(slowest, p.speed), max(fastest, p.speed)
+		if each != nil {
+			each(out)
+		}
+	}
+	return slowest, fastest
+}
+
+// a climb is paid for with throttle and a descent by closing it, not with the speed. sinking
+// faster than the idle glide has to go somewhere, so the descent may run a little fast
+func TestHeightChange(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		change    float64
+		overspeed float64
+	}{
+		{"climb", 60, 1},
+		{"descent", -60, 3.5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &plane{height: 100, speed: cruiseSpeed, power: 1}
+			var lowest, highest float64 = 1, 0
+			var pitchUp, pitchDown float64
+			slowest, fastest := fly(t, p, 100+tc.change, 90*time.Second, func(out Output) {
+				lowest, highest = min(lowest, out.Throttle), max(highest, out.Throttle)
+				pitchUp, pitchDown = max(pitchUp, out.Pitch), min(pitchDown, out.Pitch)
+			})
+
+			if math.Abs(p.height-(100+tc.change)) > 2 {
+				t.Errorf("at %.1fm, want %vm", p.height, 100+tc.change)
+			}
+			if slowest < cruiseSpeed-1 || fastest > cruiseSpeed+tc.overspeed {
+				t.Errorf("speed %.1f..%.1fm/s, want it held at %v", slowest, fastest, cruiseSpeed)
+			}
+			if tc.change > 0 && (highest < 0.8 || pitchUp <= 0) {
+				t.Errorf("climbed on throttle up to %.2f, pitch up to %.1f°", highest, pitchUp)
+			}
+			if tc.change < 0 && (lowest > 0.1 || pitchDown >= 0) {
+				t.Errorf("descended on throttle down to %.2f, pitch down to %.1f°", lowest, pitchDown)
+			}
+		})
+	}
+}
+
+// an engine too weak for the climb demanded: with the throttle already at the stop the
+// height is given up before the speed
+func TestUnderspeed(t *testing.T) {
+	p := &plane{height: 100, speed: cruiseSpeed, power: 0.3}
+	underspeed := false
+	slowest, _ := fly(t, p, 400, 120*time.Second, func(out Output) {
+		if out.Underspeed {
+			underspeed = true
+			if out.Pitch > 0 {
+				t.Fatalf("pitched up %.1f° while underspeed", out.Pitch)
+			}
+		}
+	})
+
+	if !underspeed {
+		t.Error("never underspeed")
+	}
+	if slowest < testConfig.MinAirspeed-1 {
+		t.Errorf("slowed to %.1fm/s, want at least %v", slowest, testConfig.MinAirspeed-1)
+	}
+}
+
+// the same underspeed state straight after a reset, a height demand does not pitch up
+func TestUnderspeedPitch(t *testing.T) {
+	now := time.Unix(0, 0)
+	for _, tc := range []struct {
+		name       string
+		speed      float64
+		throttle   float64
+		underspeed bool
+	}{
+		{"slow at full throttle", testConfig.MinAirspeed - 2, testConfig.MaxThrottle, true},
+		{"slow with throttle left", testConfig.MinAirspeed - 2, testConfig.CruiseThrottle, false},
+		{"full throttle at speed", cruiseSpeed, testConfig.MaxThrottle, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tecs, err := New(testConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := Input{Height: 100, Airspeed: tc.speed}
+			tecs.Reset(in, tc.throttle, now)
+			out := tecs.Update(in, 150, cruiseSpeed, now.Add(20*time.Millisecond))
+			if out.Underspeed != tc.underspeed {
+				t.Errorf("underspeed %v, want %v", out.Underspeed, tc.underspeed)
+			}
+			if tc.underspeed && out.Pitch >= 0 {
+				t.Errorf("pitch %.1f° with the height demand above, want nose down", out.Pitch)
+			}
+		})
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mangle func(*Config)
+	}{
+		{"no time constant", func(c *Config) { c.TimeConst = 0 }},
+		{"no climb", func(c *Config) { c.MaxClimb = 0 }},
+		{"max sink below min", func(c *Config) { c.MaxSink = c.MinSink / 2 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testConfig
+			tc.mangle(&c)
+			if _, err := New(c); !errors.Is(err, ErrBadConfig) {
+				t.Errorf("got %v, want %v", err, ErrBadConfig)
+			}
+		})
+	}
+}